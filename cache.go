@@ -0,0 +1,103 @@
+package servemux
+
+import (
+	"container/list"
+	"net/http"
+	"sync"
+)
+
+// NewServeMuxWithCache is like the [NewServeMux], but the returned [ServeMux]
+// caches the results of up to size most recently matched requests, keyed by
+// their method, host and path, and checks the cache before its trees. The
+// cache is purged whenever patterns are registered or deregistered. A size
+// less than or equal to zero disables the cache.
+//
+// Only requests that match registered patterns are cached, which makes it
+// worthwhile for read-heavy services that see the same URLs over and over.
+// gRPC-Web requests are never cached.
+func NewServeMuxWithCache(size int, opts ...Option) *ServeMux {
+	mux := NewServeMux(opts...)
+	if size > 0 {
+		mux.cache = newRouteCache(size)
+	}
+	return mux
+}
+
+// routeCacheKey is a key of a [routeCache].
+type routeCacheKey struct {
+	method string
+	host   string
+	path   string
+}
+
+// routeCacheEntry is an entry of a [routeCache].
+type routeCacheEntry struct {
+	key           routeCacheKey
+	h             http.Handler
+	ht            *handlerTuple
+	pathVars      map[string]string
+	hostVars      []string
+	pathVarValues []string
+}
+
+// routeCache is a thread-safe LRU cache of matched requests.
+type routeCache struct {
+	mu      sync.Mutex
+	size    int
+	ll      *list.List
+	entries map[routeCacheKey]*list.Element
+}
+
+// newRouteCache returns a new [routeCache] holding up to size entries.
+func newRouteCache(size int) *routeCache {
+	return &routeCache{
+		size:    size,
+		ll:      list.New(),
+		entries: make(map[routeCacheKey]*list.Element, size),
+	}
+}
+
+// get returns the entry for the key and marks it as the most recently used.
+func (rc *routeCache) get(key routeCacheKey) (*routeCacheEntry, bool) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	e, ok := rc.entries[key]
+	if !ok {
+		return nil, false
+	}
+	rc.ll.MoveToFront(e)
+	return e.Value.(*routeCacheEntry), true
+}
+
+// add adds the rce to the rc, evicting the least recently used entry if the
+// rc is full.
+func (rc *routeCache) add(rce *routeCacheEntry) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if e, ok := rc.entries[rce.key]; ok {
+		e.Value = rce
+		rc.ll.MoveToFront(e)
+		return
+	}
+	rc.entries[rce.key] = rc.ll.PushFront(rce)
+	if rc.ll.Len() > rc.size {
+		e := rc.ll.Back()
+		rc.ll.Remove(e)
+		delete(rc.entries, e.Value.(*routeCacheEntry).key)
+	}
+}
+
+// purge removes all entries from the rc.
+func (rc *routeCache) purge() {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.ll.Init()
+	rc.entries = make(map[routeCacheKey]*list.Element, rc.size)
+}
+
+// len returns the number of entries in the rc.
+func (rc *routeCache) len() int {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return rc.ll.Len()
+}
@@ -0,0 +1,132 @@
+package servemux
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestNewServeMuxWithCache(t *testing.T) {
+	setParallel(t)
+
+	mux := NewServeMuxWithCache(2)
+	vars := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Result", fmt.Sprint(PathVars(r), SubdomainVars(r), PathVarSlice(r)))
+	}
+	mux.HandleFunc("GET /users/{id}", vars)
+	mux.HandleFunc("{sub}.example.org/", vars)
+
+	serve := func(url string) string {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, url, nil))
+		return rec.Header().Get("Result")
+	}
+	for i := 0; i < 2; i++ {
+		if got, want := serve("/users/1"), "map[id:1] [] [1]"; got != want {
+			t.Errorf("#%d /users/1 = %q, want %q", i, got, want)
+		}
+		if got, want := serve("/users/2"), "map[id:2] [] [2]"; got != want {
+			t.Errorf("#%d /users/2 = %q, want %q", i, got, want)
+		}
+		if got, want := serve("http://foo.example.org/x"), "map[sub:foo subdomain:foo] [foo] [x]"; got != want {
+			t.Errorf("#%d foo.example.org/x = %q, want %q", i, got, want)
+		}
+	}
+	if got, want := mux.cache.len(), 2; got != want {
+		t.Errorf("cache has %d entries, want %d", got, want)
+	}
+
+	mux.Handle("GET /users/{id:[0-9]+}", stringHandler("numeric"))
+	if got, want := mux.cache.len(), 0; got != want {
+		t.Errorf("after Handle(), cache has %d entries, want %d", got, want)
+	}
+	if got, want := serve("/users/1"), "numeric"; got != want {
+		t.Errorf("after Handle(), /users/1 = %q, want %q", got, want)
+	}
+
+	if err := mux.Deregister("GET /users/{id:[0-9]+}"); err != nil {
+		t.Fatalf("Deregister() = %v", err)
+	}
+	if got, want := serve("/users/1"), "map[id:1] [] [1]"; got != want {
+		t.Errorf("after Deregister(), /users/1 = %q, want %q", got, want)
+	}
+
+	serve("/nothing")
+	serve("/users/1")
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/users/1", nil))
+	if got, want := rec.Code, http.StatusMethodNotAllowed; got != want {
+		t.Errorf("POST /users/1 = %d, want %d", got, want)
+	}
+	if got, want := mux.cache.len(), 1; got != want {
+		t.Errorf("cache has %d entries, want %d", got, want)
+	}
+
+	clone := mux.Clone()
+	if clone.cache == nil || clone.cache == mux.cache || clone.cache.size != 2 {
+		t.Error("clone does not have its own cache")
+	}
+
+	if mux := NewServeMuxWithCache(0); mux.cache != nil {
+		t.Error("NewServeMuxWithCache(0) enabled the cache")
+	}
+}
+
+func TestNewServeMuxWithCacheConcurrent(t *testing.T) {
+	setParallel(t)
+
+	mux := NewServeMuxWithCache(4)
+	mux.HandleFunc("/items/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Result", PathVars(r)["id"])
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				id := fmt.Sprint((i + j) % 8)
+				rec := httptest.NewRecorder()
+				mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/items/"+id, nil))
+				if got := rec.Header().Get("Result"); got != id {
+					t.Errorf("/items/%s = %q", id, got)
+					return
+				}
+				if j%25 == 0 {
+					mux.Handle(fmt.Sprintf("/other/%d/%d", i, j), stringHandler("other"))
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func BenchmarkNewServeMuxWithCache(b *testing.B) {
+	for _, size := range []int{0, 128} {
+		name := "Uncached"
+		if size > 0 {
+			name = "Cached"
+		}
+		b.Run(name, func(b *testing.B) {
+			mux := NewServeMuxWithCache(size)
+			rs := make([]*http.Request, 100)
+			for i := range rs {
+				mux.Handle(fmt.Sprintf("GET /api/v%d/users/{id:[0-9]+}/posts/{post}/comments/{comment}", i), http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+				rs[i] = ConfigureRequestToStorePathVars(httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/v%d/users/1/posts/2/comments/3", i), nil))
+			}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				r := rs[i%len(rs)]
+				pathVars := PathVars(r)
+				for k := range pathVars {
+					delete(pathVars, k)
+				}
+				mux.Handler(r)
+			}
+		})
+	}
+}
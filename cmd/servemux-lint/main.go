@@ -0,0 +1,219 @@
+// Servemux-lint reports problems in files of ServeMux patterns.
+//
+// Usage:
+//
+//	servemux-lint [flags] file...
+//
+// Each line of a file holds a pattern optionally followed by whitespace and a
+// handler reference, which is carried over verbatim:
+//
+//	[METHOD ][HOST][PATH][ HANDLER]
+//
+// Blank lines and lines starting with # are ignored. Since a method and a
+// host-only pattern look alike, a leading alphanumeric word followed by more
+// text is always treated as a method.
+//
+// The flags are:
+//
+//	--strict
+//		Exit with a non-zero status on warnings, not only on errors.
+//	--json
+//		Print the diagnostics as a JSON array.
+//	--fix
+//		Rewrite the files with the automatically fixable problems fixed.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/aofei/servemux"
+)
+
+var (
+	strict  = flag.Bool("strict", false, "exit with a non-zero status on warnings")
+	jsonOut = flag.Bool("json", false, "print the diagnostics as a JSON array")
+	fix     = flag.Bool("fix", false, "rewrite the files with fixable problems fixed")
+)
+
+// methodRE is used to match a leading pattern method.
+var methodRE = regexp.MustCompile(`^[0-9A-Za-z]+$`)
+
+// diagnostic is a [servemux.Diagnostic] with its position.
+type diagnostic struct {
+	File string `json:"file"`
+	Line int    `json:"line"`
+	servemux.Diagnostic
+}
+
+// entry is a parsed line of a pattern file.
+type entry struct {
+	line    int
+	indent  string
+	pattern string
+	handler string
+}
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: servemux-lint [flags] file...")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var (
+		ds        []diagnostic
+		hasErrors bool
+	)
+	for _, name := range flag.Args() {
+		fds, err := lintFile(name)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "servemux-lint:", err)
+			os.Exit(2)
+		}
+		ds = append(ds, fds...)
+	}
+
+	if *jsonOut {
+		if ds == nil {
+			ds = []diagnostic{}
+		}
+		b, err := json.MarshalIndent(ds, "", "\t")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "servemux-lint:", err)
+			os.Exit(2)
+		}
+		os.Stdout.Write(append(b, '\n'))
+	} else {
+		for _, d := range ds {
+			fmt.Printf("%s:%d: %s\n", d.File, d.Line, d.Diagnostic)
+		}
+	}
+
+	for _, d := range ds {
+		if d.Severity == servemux.SeverityError || *strict {
+			hasErrors = true
+		}
+	}
+	if hasErrors {
+		os.Exit(1)
+	}
+}
+
+// lintFile lints the named file and rewrites it when the -fix is set.
+func lintFile(name string) ([]diagnostic, error) {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	lines := strings.SplitAfter(string(b), "\n")
+	var entries []entry
+	for i, l := range lines {
+		if e, ok := parseLine(strings.TrimRight(l, "\r\n")); ok {
+			e.line = i + 1
+			entries = append(entries, e)
+		}
+	}
+
+	var ds []diagnostic
+	patterns := make([]string, 0, len(entries))
+	for i, e := range entries {
+		for _, d := range servemux.PatternLint(e.pattern) {
+			if *fix && d.Fix != "" {
+				continue
+			}
+			ds = append(ds, diagnostic{name, e.line, d})
+		}
+		if *fix {
+			entries[i].pattern = fixPattern(e.pattern)
+		}
+		patterns = append(patterns, entries[i].pattern)
+	}
+
+	// Check the growing prefixes of the patterns so that each problem is
+	// attributed to the line that introduces it.
+	var nads int
+	for i, e := range entries {
+		ads := servemux.AmbiguityCheck(patterns[:i+1])
+		for _, d := range ads[nads:] {
+			ds = append(ds, diagnostic{name, e.line, d})
+		}
+		nads = len(ads)
+	}
+
+	sort.SliceStable(ds, func(i, j int) bool { return ds[i].Line < ds[j].Line })
+
+	if *fix {
+		for _, e := range entries {
+			l := e.indent + e.pattern
+			if e.handler != "" {
+				l += " " + e.handler
+			}
+			nl := lines[e.line-1][len(strings.TrimRight(lines[e.line-1], "\r\n")):]
+			lines[e.line-1] = l + nl
+		}
+		var buf bytes.Buffer
+		for _, l := range lines {
+			buf.WriteString(l)
+		}
+		if !bytes.Equal(buf.Bytes(), b) {
+			fi, err := os.Stat(name)
+			if err != nil {
+				return nil, err
+			}
+			if err := os.WriteFile(name, buf.Bytes(), fi.Mode()); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return ds, nil
+}
+
+// parseLine parses the l as an [entry]. It returns false if the l holds no
+// pattern.
+func parseLine(l string) (entry, bool) {
+	t := strings.TrimSpace(l)
+	if t == "" || t[0] == '#' {
+		return entry{}, false
+	}
+
+	e := entry{indent: l[:strings.Index(l, t)]}
+	fields := strings.Fields(t)
+	e.pattern = fields[0]
+	fields = fields[1:]
+	if len(fields) > 0 && methodRE.MatchString(e.pattern) {
+		e.pattern += " " + fields[0]
+		fields = fields[1:]
+	}
+	e.handler = strings.Join(fields, " ")
+
+	return e, true
+}
+
+// fixPattern applies all automatic fixes to the pattern.
+func fixPattern(pattern string) string {
+	for {
+		fixed := false
+		for _, d := range servemux.PatternLint(pattern) {
+			if d.Fix != "" && d.Fix != pattern {
+				pattern, fixed = d.Fix, true
+				break
+			}
+		}
+		if !fixed {
+			return pattern
+		}
+	}
+}
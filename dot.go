@@ -0,0 +1,118 @@
+package servemux
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// WriteDotGraph writes the radix trees of the mux to the w in the Graphviz DOT
+// format, for debugging how patterns are matched. Each node is labeled with its
+// prefix, its type, and the methods of the handlers registered at it.
+// Non-variable nodes are drawn as boxes, and variable nodes as ellipses.
+//
+// It returns the first error returned by the w.
+func (mux *ServeMux) WriteDotGraph(w io.Writer) error {
+	mux.mu.RLock()
+	defer mux.mu.RUnlock()
+
+	dw := &dotWriter{w: w}
+	dw.printf("digraph servemux {\n")
+	dw.printf("\tnode [shape=box];\n")
+	if mux.tree != nil {
+		dw.writeTree("(hostless)", mux.tree)
+	}
+	hosts := make([]string, 0, len(mux.hostTrees))
+	for host := range mux.hostTrees {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	for _, host := range hosts {
+		dw.writeTree(host, mux.hostTrees[host])
+	}
+	for _, vht := range mux.varHostTrees {
+		dw.writeTree(vht.host, vht.tree)
+	}
+	dw.printf("}\n")
+	return dw.err
+}
+
+// dotWriter writes DOT graphs. It stops writing after the first error.
+type dotWriter struct {
+	w      io.Writer
+	nextID int
+	err    error
+}
+
+// printf writes the formatted string to the dw unless an error has occurred.
+func (dw *dotWriter) printf(format string, args ...any) {
+	if dw.err == nil {
+		_, dw.err = fmt.Fprintf(dw.w, format, args...)
+	}
+}
+
+// writeTree writes the tree for the host to the dw.
+func (dw *dotWriter) writeTree(host string, tree *serveMuxNode) {
+	id := dw.nextID
+	dw.nextID++
+	dw.printf("\tn%d [label=\"%s\", shape=doubleoctagon];\n", id, dotEscape(host))
+	dw.writeNode(id, tree)
+}
+
+// writeNode writes the subtree rooted at the mn to the dw as a child of the
+// node with the parentID.
+func (dw *dotWriter) writeNode(parentID int, mn *serveMuxNode) {
+	if dw.err != nil {
+		return
+	}
+
+	id := dw.nextID
+	dw.nextID++
+
+	var typ, shape string
+	switch mn.typ {
+	case nonvarServeMuxNode:
+		typ, shape = "static", "box"
+	case constrainedVarServeMuxNode:
+		typ, shape = "constrained-var", "ellipse"
+	case unmodifiedVarServeMuxNode:
+		typ, shape = "unmodified-var", "ellipse"
+	case ellipsisModifiedVarServeMuxNode:
+		typ, shape = "ellipsis-var", "ellipse"
+	}
+	label := dotEscape(mn.prefix) + `\n` + typ
+	methods := mn.allowedMethods()
+	if ht := mn.catchAllHandlerTuple; ht != nil {
+		if ht.method == "" {
+			methods = append(methods, "*")
+		} else {
+			methods = append(methods, ht.method)
+		}
+	}
+	if len(methods) > 0 {
+		label += `\n[` + strings.Join(methods, ", ") + `]`
+	}
+	dw.printf("\tn%d [label=\"%s\", shape=%s];\n", id, label, shape)
+	dw.printf("\tn%d -> n%d;\n", parentID, id)
+
+	for _, n := range mn.nonvarChildren {
+		if n != nil {
+			dw.writeNode(id, n)
+		}
+	}
+	for _, n := range mn.constrainedVarChildren {
+		dw.writeNode(id, n)
+	}
+	if n := mn.unmodifiedVarChild; n != nil {
+		dw.writeNode(id, n)
+	}
+	if n := mn.ellipsisModifiedVarChild; n != nil {
+		dw.writeNode(id, n)
+	}
+}
+
+// dotEscape escapes the s for use in a quoted DOT string.
+func dotEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s)
+}
@@ -0,0 +1,45 @@
+package servemux
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestServeMuxWriteDotGraph(t *testing.T) {
+	setParallel(t)
+
+	mux := NewServeMux()
+	mux.Handle("GET /users/{id}", stringHandler("user"))
+	mux.Handle("POST /users/{id}", stringHandler("user"))
+	mux.Handle("/files/", stringHandler("files"))
+	mux.Handle("example.com/{id:[0-9]+}", stringHandler("example.com"))
+
+	var b strings.Builder
+	if err := mux.WriteDotGraph(&b); err != nil {
+		t.Fatalf("WriteDotGraph() = %v", err)
+	}
+	got := b.String()
+	for _, want := range []string{
+		"digraph servemux {\n",
+		`[label="(hostless)", shape=doubleoctagon];`,
+		`[label="example.com", shape=doubleoctagon];`,
+		`[label="{}\nunmodified-var\n[GET, HEAD, POST]", shape=ellipse];`,
+		`[label="{...}\nellipsis-var\n[*]", shape=ellipse];`,
+		`[label="{:[0-9]+}\nconstrained-var\n[*]", shape=ellipse];`,
+		`[label="files\nstatic\n[_tsr]", shape=box];`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("WriteDotGraph() output does not contain %q:\n%s", want, got)
+		}
+	}
+
+	if err := mux.WriteDotGraph(errWriter{}); err == nil {
+		t.Error("expected the writer error to be returned")
+	}
+}
+
+// errWriter is an [io.Writer] that always fails.
+type errWriter struct{}
+
+func (errWriter) Write([]byte) (int, error) { return 0, errors.New("write failed") }
@@ -0,0 +1,50 @@
+package servemux
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+)
+
+// exportedRoute is a registered pattern as exported by the
+// [ServeMux.ExportJSON].
+type exportedRoute struct {
+	Pattern      string   `json:"pattern"`
+	Method       string   `json:"method"`
+	Host         string   `json:"host"`
+	Path         string   `json:"path"`
+	PathVarNames []string `json:"pathVarNames"`
+	HandlerType  string   `json:"handlerType"`
+}
+
+// ExportJSON returns the registered patterns of the mux as a JSON array sorted
+// by the patterns, for debug endpoints like "/_routes". Each element has the
+// "pattern", its "method", "host" and "path", the "pathVarNames" of its named
+// variable path elements, and the "handlerType" of its handler as reported by
+// the [reflect.Type.String]. The redirects and HEAD handlers registered
+// internally are omitted. See also the [ServeMux.WriteDotGraph].
+func (mux *ServeMux) ExportJSON() ([]byte, error) {
+	mux.mu.RLock()
+	routes := []exportedRoute{}
+	mux.walk(func(ht *handlerTuple) bool {
+		er := exportedRoute{
+			Pattern:      ht.registeredPattern(),
+			Method:       ht.method,
+			Host:         ht.host,
+			Path:         ht.path,
+			PathVarNames: []string{},
+			HandlerType:  reflect.TypeOf(ht.handler).String(),
+		}
+		for _, name := range ht.pathVarNames {
+			if name != "" {
+				er.PathVarNames = append(er.PathVarNames, name)
+			}
+		}
+		routes = append(routes, er)
+		return true
+	})
+	mux.mu.RUnlock()
+
+	sort.Slice(routes, func(i, j int) bool { return routes[i].Pattern < routes[j].Pattern })
+	return json.Marshal(routes)
+}
@@ -0,0 +1,30 @@
+package servemux
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestServeMuxExportJSON(t *testing.T) {
+	setParallel(t)
+
+	mux := NewServeMux()
+	if b, err := mux.ExportJSON(); err != nil || string(b) != "[]" {
+		t.Errorf("ExportJSON() = %s, %v, want []", b, err)
+	}
+
+	mux.HandleFunc("GET /users/{id}/{}", func(http.ResponseWriter, *http.Request) {})
+	mux.Handle("example.com/static/", stringHandler("static"))
+
+	b, err := mux.ExportJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `[` +
+		`{"pattern":"GET /users/{id}/{}","method":"GET","host":"","path":"/users/{id}/{}","pathVarNames":["id"],"handlerType":"http.HandlerFunc"},` +
+		`{"pattern":"example.com/static/","method":"","host":"example.com","path":"/static/","pathVarNames":[],"handlerType":"servemux.stringHandler"}` +
+		`]`
+	if string(b) != want {
+		t.Errorf("got:\n%s\nwant:\n%s", b, want)
+	}
+}
@@ -0,0 +1,26 @@
+package servemux
+
+import "errors"
+
+// errFrozen is the error returned when registering patterns with a frozen
+// [ServeMux].
+var errFrozen = errors.New("http.ServeMux: cannot register patterns with a frozen mux")
+
+// Freeze prevents any further pattern from being registered with the mux,
+// typically once the server has started listening. Afterwards,
+// [ServeMux.Handle] and the other registration methods panic, and
+// [ServeMux.HandleE] returns an error. Unlike the [ServeMux.Precompile], the
+// settings of the mux can still be changed, and [ServeMux.Reset] unfreezes it.
+// Calling Freeze more than once has no further effect.
+func (mux *ServeMux) Freeze() {
+	mux.mu.Lock()
+	defer mux.mu.Unlock()
+	mux.frozen = true
+}
+
+// Frozen reports whether the mux has been frozen by the [ServeMux.Freeze].
+func (mux *ServeMux) Frozen() bool {
+	mux.mu.RLock()
+	defer mux.mu.RUnlock()
+	return mux.frozen
+}
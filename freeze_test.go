@@ -0,0 +1,57 @@
+package servemux
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestServeMuxFreeze(t *testing.T) {
+	setParallel(t)
+
+	mux := NewServeMux()
+	mux.Handle("/a", stringHandler("a"))
+	if mux.Frozen() {
+		t.Fatal("new mux is frozen")
+	}
+	mux.Freeze()
+	mux.Freeze()
+	if !mux.Frozen() {
+		t.Fatal("Frozen() = false after Freeze()")
+	}
+
+	for name, register := range map[string]func(){
+		"Handle":        func() { mux.Handle("/b", stringHandler("b")) },
+		"HandleFunc":    func() { mux.HandleFunc("/b", func(http.ResponseWriter, *http.Request) {}) },
+		"HandleGRPCWeb": func() { mux.HandleGRPCWeb("/b", stringHandler("b")) },
+		"Merge": func() {
+			other := NewServeMux()
+			other.Handle("/b", stringHandler("b"))
+			mux.Merge(other)
+		},
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s did not panic on a frozen mux", name)
+				}
+			}()
+			register()
+		}()
+	}
+	if err := mux.HandleE("/b", stringHandler("b")); err != errFrozen {
+		t.Errorf("HandleE() = %v, want %v", err, errFrozen)
+	}
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/a", nil))
+	if got := rec.Header().Get("Result"); got != "a" {
+		t.Errorf("/a = %q, want %q", got, "a")
+	}
+
+	mux.Reset()
+	if mux.Frozen() {
+		t.Error("Frozen() = true after Reset()")
+	}
+	mux.Handle("/b", stringHandler("b"))
+}
@@ -0,0 +1,131 @@
+package servemux
+
+import (
+	"net/http"
+	"strings"
+	"sync/atomic"
+)
+
+// Group is a group of routes of a [ServeMux] that share a pattern prefix and a
+// middleware stack.
+type Group struct {
+	mux         *ServeMux
+	parent      *Group
+	prefix      string
+	middlewares []func(http.Handler) http.Handler
+	children    []*Group
+	handlers    []*groupHandler
+}
+
+// Group returns a new [Group] of the mux for the prefix. The prefix is in the
+// form of `[host][path]`, and it is prepended to the host and path of each
+// pattern registered through the returned group.
+func (mux *ServeMux) Group(prefix string) *Group {
+	return &Group{mux: mux, prefix: prefix}
+}
+
+// Group returns a new nested [Group] of the g for the prefix. The prefix is
+// appended to the prefix of the g, and the middleware stack of the g wraps
+// that of the returned group.
+func (g *Group) Group(prefix string) *Group {
+	child := &Group{mux: g.mux, parent: g, prefix: g.expand(prefix)}
+	g.mux.mu.Lock()
+	defer g.mux.mu.Unlock()
+	g.children = append(g.children, child)
+	return child
+}
+
+// Handle registers the handler for the given pattern in the mux of the g. The
+// pattern is in the form of `[method ][path]`, and it is expanded to
+// `[method ][prefix][path]` before being registered, so the mux only ever
+// sees the fully expanded pattern.
+func (g *Group) Handle(pattern string, handler http.Handler) {
+	if handler == nil {
+		panic("http.ServeMux: nil handler")
+	}
+	method, path, ok := strings.Cut(pattern, " ")
+	if !ok {
+		method, path = "", method
+	}
+	pattern = g.expand(path)
+	if method != "" {
+		pattern = method + " " + pattern
+	}
+
+	gh := &groupHandler{g: g, h: handler}
+	g.mux.mu.Lock()
+	gh.build()
+	g.mux.mu.Unlock()
+	g.mux.Handle(pattern, gh)
+
+	// Rebuild in case the Use was called during the registration.
+	g.mux.mu.Lock()
+	defer g.mux.mu.Unlock()
+	g.handlers = append(g.handlers, gh)
+	gh.build()
+}
+
+// HandleFunc registers the handler function for the given pattern in the mux
+// of the g. See [Group.Handle].
+func (g *Group) HandleFunc(pattern string, handler func(http.ResponseWriter, *http.Request)) {
+	if handler == nil {
+		panic("http.ServeMux: nil handler")
+	}
+	g.Handle(pattern, http.HandlerFunc(handler))
+}
+
+// Use appends the middlewares to the middleware stack of the g. The stack only
+// wraps handlers registered through the g and its nested groups, including
+// those registered before the Use call, with the first middleware being the
+// outermost. The middleware stack of the mux of the g wraps that of the g.
+func (g *Group) Use(middlewares ...func(http.Handler) http.Handler) {
+	g.mux.mu.Lock()
+	defer g.mux.mu.Unlock()
+	g.middlewares = append(g.middlewares, middlewares...)
+	g.rebuild()
+}
+
+// rebuild rebuilds the middleware chains of the handlers registered through
+// the g and its nested groups. The caller must hold the g.mux.mu.
+func (g *Group) rebuild() {
+	for _, gh := range g.handlers {
+		gh.build()
+	}
+	for _, child := range g.children {
+		child.rebuild()
+	}
+}
+
+// expand expands the path with the prefix of the g.
+func (g *Group) expand(path string) string {
+	if strings.HasPrefix(path, "/") {
+		return strings.TrimSuffix(g.prefix, "/") + path
+	}
+	return g.prefix + path
+}
+
+// groupHandler is an [http.Handler] registered through a [Group].
+type groupHandler struct {
+	g *Group
+	h http.Handler
+
+	// chain is the h wrapped by the middleware stacks of the g and its
+	// parents.
+	chain atomic.Pointer[http.Handler]
+}
+
+// build builds the gh.chain. The caller must hold the gh.g.mux.mu.
+func (gh *groupHandler) build() {
+	h := gh.h
+	for g := gh.g; g != nil; g = g.parent {
+		for i := len(g.middlewares) - 1; i >= 0; i-- {
+			h = g.middlewares[i](h)
+		}
+	}
+	gh.chain.Store(&h)
+}
+
+// ServeHTTP implements the [http.Handler].
+func (gh *groupHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	(*gh.chain.Load()).ServeHTTP(w, r)
+}
@@ -0,0 +1,80 @@
+package servemux
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGroup(t *testing.T) {
+	setParallel(t)
+
+	middleware := func(name string) func(http.Handler) http.Handler {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Add("Middleware", name)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+
+	mux := NewServeMux()
+	mux.Use(middleware("mux"))
+	mux.Handle("/health", stringHandler("/health"))
+
+	api := mux.Group("/api/")
+	api.Handle("GET /users/{id}", stringHandler("GET /api/users/{id}"))
+	api.Use(middleware("api"))
+	v1 := api.Group("/v1")
+	v1.HandleFunc("POST /things", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Result", "POST /api/v1/things")
+	})
+	v1.Use(middleware("v1"))
+	mux.Group("example.org").Handle("/", stringHandler("example.org/"))
+
+	tests := []struct {
+		method     string
+		url        string
+		pattern    string
+		middleware string
+	}{
+		{"GET", "/health", "/health", "mux"},
+		{"GET", "/api/users/42", "GET /api/users/{id}", "mux,api"},
+		{"POST", "/api/v1/things", "POST /api/v1/things", "mux,api,v1"},
+		{"GET", "http://example.org/foo", "example.org/", "mux"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.url, nil)
+		if _, pattern := mux.Handler(req); pattern != tt.pattern {
+			t.Errorf("%s %s: pattern = %q, want %q", tt.method, tt.url, pattern, tt.pattern)
+		}
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		if got, want := rec.Header().Get("Result"), tt.pattern; got != want {
+			t.Errorf("%s %s: Result = %q, want %q", tt.method, tt.url, got, want)
+		}
+		if got, want := strings.Join(rec.Header()["Middleware"], ","), tt.middleware; got != want {
+			t.Errorf("%s %s: Middleware = %q, want %q", tt.method, tt.url, got, want)
+		}
+	}
+
+	if h, _ := mux.HandlerAt("GET /api/users/{id}"); h != stringHandler("GET /api/users/{id}") {
+		t.Errorf("HandlerAt returned %#v, want the registered handler", h)
+	}
+
+	var built int
+	api.Use(func(next http.Handler) http.Handler {
+		built++
+		return next
+	})
+	if built != 2 {
+		t.Errorf("api middleware built %d times on Use, want 2", built)
+	}
+	for i := 0; i < 3; i++ {
+		mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/api/v1/things", nil))
+	}
+	if built != 2 {
+		t.Errorf("api middleware built %d times after serving, want 2", built)
+	}
+}
@@ -0,0 +1,179 @@
+package servemux
+
+import (
+	"encoding/binary"
+	"net/http"
+	"net/textproto"
+	"sort"
+	"strings"
+)
+
+// HandleGRPCWeb registers the grpcHandler for the given pattern, but only for
+// requests whose Content-Type is application/grpc-web or one of its
+// subtypes, such as application/grpc-web+proto. Other requests keep being
+// matched against the patterns registered by [ServeMux.Handle], so a gRPC-Web
+// service and a REST API can share the same URLs.
+//
+// The grpcHandler is expected to speak standard gRPC, like a
+// *grpc.Server does. It is wrapped with the adapter set by
+// [ServeMux.SetGRPCWebAdapter], or with the [GRPCWebTranscoder] by default.
+func (mux *ServeMux) HandleGRPCWeb(pattern string, grpcHandler http.Handler) {
+	if grpcHandler == nil {
+		panic("http.ServeMux: nil handler")
+	}
+
+	mux.mu.Lock()
+	if mux.sealed.Load() {
+		mux.mu.Unlock()
+		panic(errPrecompiled.Error())
+	}
+	if mux.frozen {
+		mux.mu.Unlock()
+		panic(errFrozen.Error())
+	}
+	if mux.grpcWeb == nil {
+		mux.grpcWeb = NewServeMux()
+	}
+	grpcWeb, adapter := mux.grpcWeb, mux.grpcWebAdapter
+	mux.mu.Unlock()
+
+	if adapter == nil {
+		adapter = GRPCWebTranscoder
+	}
+	grpcWeb.Handle(pattern, adapter(grpcHandler))
+}
+
+// SetGRPCWebAdapter sets the adapter that translates between gRPC-Web and
+// standard gRPC for the handlers registered by [ServeMux.HandleGRPCWeb] after
+// it. A nil adapter restores the [GRPCWebTranscoder].
+func (mux *ServeMux) SetGRPCWebAdapter(adapter func(grpcHandler http.Handler) http.Handler) {
+	mux.mu.Lock()
+	defer mux.mu.Unlock()
+	mux.grpcWebAdapter = adapter
+}
+
+// isGRPCWebRequest reports whether the r is a gRPC-Web request.
+func isGRPCWebRequest(r *http.Request) bool {
+	ct := r.Header.Get("Content-Type")
+	return ct == "application/grpc-web" || strings.HasPrefix(ct, "application/grpc-web+") ||
+		ct == "application/grpc-web-text" || strings.HasPrefix(ct, "application/grpc-web-text+")
+}
+
+// GRPCWebTranscoder wraps the grpcHandler so that it can serve gRPC-Web
+// requests using the binary wire format.
+//
+// Since the message framing of gRPC-Web is identical to that of gRPC, the
+// request is passed through as an HTTP/2 gRPC request, and the response
+// trailers are appended to the response body as a trailer frame. Requests
+// using the base64-encoded text wire format are rejected with status
+// 415 (Unsupported Media Type).
+func GRPCWebTranscoder(grpcHandler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ct := r.Header.Get("Content-Type")
+		if strings.HasPrefix(ct, "application/grpc-web-text") {
+			http.Error(w, "415 unsupported media type", http.StatusUnsupportedMediaType)
+			return
+		}
+
+		r2 := r.Clone(r.Context())
+		r2.Proto, r2.ProtoMajor, r2.ProtoMinor = "HTTP/2.0", 2, 0
+		r2.Header.Set("Content-Type", "application/grpc"+strings.TrimPrefix(ct, "application/grpc-web"))
+		r2.Header.Set("Te", "trailers")
+		r2.Header.Del("Content-Length")
+
+		gw := &grpcWebResponseWriter{ResponseWriter: w}
+		grpcHandler.ServeHTTP(gw, r2)
+		gw.writeTrailers()
+	})
+}
+
+// grpcWebResponseWriter is an [http.ResponseWriter] that translates a gRPC
+// response into a gRPC-Web response.
+type grpcWebResponseWriter struct {
+	http.ResponseWriter
+	wroteHeader   bool
+	trailerFields []string
+}
+
+// WriteHeader implements the [http.ResponseWriter].
+func (gw *grpcWebResponseWriter) WriteHeader(code int) {
+	if gw.wroteHeader {
+		return
+	}
+	gw.wroteHeader = true
+
+	h := gw.Header()
+	for _, v := range h["Trailer"] {
+		for _, f := range strings.Split(v, ",") {
+			if f = strings.TrimSpace(f); f != "" {
+				gw.trailerFields = append(gw.trailerFields, textproto.CanonicalMIMEHeaderKey(f))
+			}
+		}
+	}
+	h.Del("Trailer")
+	if ct := h.Get("Content-Type"); strings.HasPrefix(ct, "application/grpc") {
+		h.Set("Content-Type", "application/grpc-web"+strings.TrimPrefix(ct, "application/grpc"))
+	}
+
+	gw.ResponseWriter.WriteHeader(code)
+}
+
+// Write implements the [http.ResponseWriter].
+func (gw *grpcWebResponseWriter) Write(b []byte) (int, error) {
+	gw.WriteHeader(http.StatusOK)
+	return gw.ResponseWriter.Write(b)
+}
+
+// Flush implements the [http.Flusher].
+func (gw *grpcWebResponseWriter) Flush() {
+	gw.WriteHeader(http.StatusOK)
+	if f, ok := gw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// writeTrailers writes the trailers of the gw as a gRPC-Web trailer frame.
+func (gw *grpcWebResponseWriter) writeTrailers() {
+	wroteHeader := gw.wroteHeader
+	gw.WriteHeader(http.StatusOK)
+
+	h := gw.Header()
+	trailers := http.Header{}
+	if wroteHeader {
+		for _, f := range gw.trailerFields {
+			if v, ok := h[f]; ok {
+				trailers[f] = v
+			}
+		}
+	}
+	for k, v := range h {
+		if strings.HasPrefix(k, http.TrailerPrefix) {
+			trailers[textproto.CanonicalMIMEHeaderKey(strings.TrimPrefix(k, http.TrailerPrefix))] = v
+		}
+	}
+	if len(trailers) == 0 {
+		return
+	}
+
+	keys := make([]string, 0, len(trailers))
+	for k := range trailers {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	for _, k := range keys {
+		for _, v := range trailers[k] {
+			b.WriteString(strings.ToLower(k))
+			b.WriteString(": ")
+			b.WriteString(v)
+			b.WriteString("\r\n")
+		}
+	}
+
+	frame := make([]byte, 5, 5+b.Len())
+	frame[0] = 1 << 7
+	binary.BigEndian.PutUint32(frame[1:], uint32(b.Len()))
+	frame = append(frame, b.String()...)
+	gw.ResponseWriter.Write(frame)
+}
@@ -0,0 +1,58 @@
+package servemux
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestServeMuxHandleGRPCWeb(t *testing.T) {
+	setParallel(t)
+
+	mux := NewServeMux()
+	mux.Handle("POST /greeter.Greeter/SayHello", stringHandler("rest"))
+	mux.HandleGRPCWeb("POST /greeter.Greeter/SayHello", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got, want := r.Header.Get("Content-Type"), "application/grpc+proto"; got != want {
+			t.Errorf("Content-Type = %q, want %q", got, want)
+		}
+		if got, want := r.ProtoMajor, 2; got != want {
+			t.Errorf("ProtoMajor = %d, want %d", got, want)
+		}
+		w.Header().Set("Content-Type", "application/grpc+proto")
+		w.Header().Set("Trailer", "Grpc-Status")
+		w.Header().Set("Result", "grpc")
+		w.Write([]byte{0, 0, 0, 0, 0})
+		w.Header().Set("Grpc-Status", "0")
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/greeter.Greeter/SayHello", strings.NewReader("\x00\x00\x00\x00\x00"))
+	req.Header.Set("Content-Type", "application/grpc-web+proto")
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	if got, want := rec.Header().Get("Result"), "grpc"; got != want {
+		t.Errorf("Result = %q, want %q", got, want)
+	}
+	if got, want := rec.Header().Get("Content-Type"), "application/grpc-web+proto"; got != want {
+		t.Errorf("Content-Type = %q, want %q", got, want)
+	}
+	if got, want := rec.Body.String(), "\x00\x00\x00\x00\x00\x80\x00\x00\x00\x10grpc-status: 0\r\n"; got != want {
+		t.Errorf("Body = %q, want %q", got, want)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/greeter.Greeter/SayHello", strings.NewReader("{}"))
+	req.Header.Set("Content-Type", "application/json")
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	if got, want := rec.Header().Get("Result"), "rest"; got != want {
+		t.Errorf("Result = %q, want %q", got, want)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/greeter.Greeter/SayHello", strings.NewReader("AAAAAAA="))
+	req.Header.Set("Content-Type", "application/grpc-web-text")
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	if got, want := rec.Code, http.StatusUnsupportedMediaType; got != want {
+		t.Errorf("Status = %d, want %d", got, want)
+	}
+}
@@ -0,0 +1,130 @@
+package servemux
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// HandleOption is an option of registering a pattern using the
+// [ServeMux.HandleWith].
+type HandleOption func(opts *handleWithOptions)
+
+// handleWithOptions are the options of the [ServeMux.HandleWith].
+type handleWithOptions struct {
+	name            string
+	meta            map[string]string
+	timeout         time.Duration
+	bodyLimit       int64
+	bodyLimited     bool
+	middlewares     []func(http.Handler) http.Handler
+	responseHeaders http.Header
+}
+
+// WithName returns a [HandleOption] that associates the name with the pattern,
+// as the [ServeMux.HandleNamed] does.
+func WithName(name string) HandleOption {
+	return func(opts *handleWithOptions) { opts.name = name }
+}
+
+// WithMeta returns a [HandleOption] that adds the metadata entry of the k and
+// v to the pattern, as the [ServeMux.HandleWithMeta] does.
+func WithMeta(k, v string) HandleOption {
+	return func(opts *handleWithOptions) {
+		if opts.meta == nil {
+			opts.meta = map[string]string{}
+		}
+		opts.meta[k] = v
+	}
+}
+
+// WithTimeout returns a [HandleOption] that wraps the handler with the
+// [http.TimeoutHandler] using the timeout and the default message, as the
+// [ServeMux.HandleWithTimeout] does.
+func WithTimeout(timeout time.Duration) HandleOption {
+	return func(opts *handleWithOptions) { opts.timeout = timeout }
+}
+
+// WithBodyLimit returns a [HandleOption] that limits the request bodies read
+// by the handler to the maxBytes, as the [ServeMux.HandleWithBodyLimit] does.
+func WithBodyLimit(maxBytes int64) HandleOption {
+	return func(opts *handleWithOptions) { opts.bodyLimit, opts.bodyLimited = maxBytes, true }
+}
+
+// WithMiddleware returns a [HandleOption] that wraps the handler with the
+// middlewares, with the first middleware being the outermost. They are
+// wrapped by the middlewares added by the [ServeMux.Use].
+func WithMiddleware(middlewares ...func(http.Handler) http.Handler) HandleOption {
+	return func(opts *handleWithOptions) {
+		opts.middlewares = append(opts.middlewares, middlewares...)
+	}
+}
+
+// WithResponseHeaders returns a [HandleOption] that sets the header on every
+// response before calling the handler, which can still change them. The
+// header is copied.
+func WithResponseHeaders(header http.Header) HandleOption {
+	header = header.Clone()
+	return func(opts *handleWithOptions) {
+		if opts.responseHeaders == nil {
+			opts.responseHeaders = http.Header{}
+		}
+		for k, vs := range header {
+			opts.responseHeaders[k] = vs
+		}
+	}
+}
+
+// HandleWith is like the [ServeMux.Handle], but it also applies the opts, so
+// that per-pattern features can be combined in a single call. From the
+// outermost, the handler is wrapped by the timeout, the body limit, the
+// middlewares, and then the response headers.
+func (mux *ServeMux) HandleWith(pattern string, handler http.Handler, opts ...HandleOption) {
+	if handler == nil {
+		panic("http.ServeMux: nil handler")
+	}
+
+	var hwo handleWithOptions
+	for _, opt := range opts {
+		opt(&hwo)
+	}
+	if hwo.bodyLimit < 0 {
+		panic("http.ServeMux: negative body limit")
+	}
+
+	if len(hwo.responseHeaders) > 0 {
+		next, header := handler, hwo.responseHeaders
+		handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for k, vs := range header {
+				w.Header()[k] = append([]string(nil), vs...)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+	for i := len(hwo.middlewares) - 1; i >= 0; i-- {
+		handler = hwo.middlewares[i](handler)
+	}
+	if hwo.bodyLimit > 0 {
+		handler = bodyLimitHandler{hwo.bodyLimit, handler}
+	}
+	if hwo.timeout > 0 {
+		handler = http.TimeoutHandler(handler, hwo.timeout, "")
+	}
+
+	mux.mu.Lock()
+	defer mux.mu.Unlock()
+	if hwo.name != "" {
+		if registeredPattern, ok := mux.namedPatterns[hwo.name]; ok {
+			panic(fmt.Sprintf("http.ServeMux: name %q for pattern %q is already used by %q", hwo.name, pattern, registeredPattern))
+		}
+	}
+	if err := mux.handle(pattern, handler, handleOptions{meta: hwo.meta, bodyLimited: hwo.bodyLimited}); err != nil {
+		panic(err.Error())
+	}
+	if hwo.name != "" {
+		if mux.namedPatterns == nil {
+			mux.namedPatterns = map[string]string{}
+		}
+		mux.namedPatterns[hwo.name] = pattern
+	}
+}
@@ -0,0 +1,73 @@
+package servemux
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServeMuxHandleWith(t *testing.T) {
+	setParallel(t)
+
+	var order []string
+	middleware := func(name string) func(http.Handler) http.Handler {
+		return func(h http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				order = append(order, name)
+				h.ServeHTTP(w, r)
+			})
+		}
+	}
+
+	mux := NewServeMux()
+	mux.HandleWith("POST /users/{id}", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := io.ReadAll(r.Body); err != nil {
+			return
+		}
+		w.Header().Set("Result", RouteMeta(r)["owner"])
+	}),
+		WithName("user"),
+		WithMeta("owner", "team-a"),
+		WithBodyLimit(4),
+		WithMiddleware(middleware("a"), middleware("b")),
+		WithResponseHeaders(http.Header{"Cache-Control": {"no-store"}}),
+	)
+	mux.HandleWith("/slow", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}), WithTimeout(10*time.Millisecond))
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/users/1", strings.NewReader("1234")))
+	if rec.Code != http.StatusOK || rec.Header().Get("Result") != "team-a" || rec.Header().Get("Cache-Control") != "no-store" {
+		t.Errorf("POST /users/1 = %d %v", rec.Code, rec.Header())
+	}
+	if got := strings.Join(order, ","); got != "a,b" {
+		t.Errorf("middleware order = %q, want %q", got, "a,b")
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/users/1", strings.NewReader("12345")))
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("POST /users/1 with a large body = %d, want %d", rec.Code, http.StatusRequestEntityTooLarge)
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/slow", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("GET /slow = %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+
+	if u, err := mux.Reverse("user", map[string]string{"id": "1"}, nil); err != nil || u != "/users/1" {
+		t.Errorf("Reverse() = %q, %v, want %q", u, err, "/users/1")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("expected reusing a name to panic")
+		}
+	}()
+	mux.HandleWith("/other", stringHandler("other"), WithName("user"))
+}
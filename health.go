@@ -0,0 +1,31 @@
+package servemux
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// HandleHealthCheck registers "GET " + pattern to serve a health check
+// response like {"status":"ok","version":"...","commit":"...","uptime":"1h2m3s"}
+// as JSON, where the uptime is the time elapsed since the HandleHealthCheck
+// call, rounded to seconds. The pattern must have no method. If the resulting
+// pattern is already registered, HandleHealthCheck panics.
+func (mux *ServeMux) HandleHealthCheck(pattern, version, commit string) {
+	if method, _, _ := splitPattern(pattern); method != "" {
+		panic(fmt.Sprintf("http.ServeMux: health check pattern %q must have no method", pattern))
+	}
+
+	start := time.Now()
+	mux.HandleFunc(http.MethodGet+" "+pattern, func(w http.ResponseWriter, r *http.Request) {
+		b, _ := json.Marshal(struct {
+			Status  string `json:"status"`
+			Version string `json:"version"`
+			Commit  string `json:"commit"`
+			Uptime  string `json:"uptime"`
+		}{"ok", version, commit, time.Since(start).Round(time.Second).String()})
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(b)
+	})
+}
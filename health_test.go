@@ -0,0 +1,52 @@
+package servemux
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestServeMuxHandleHealthCheck(t *testing.T) {
+	setParallel(t)
+
+	mux := NewServeMux()
+	mux.HandleHealthCheck("/healthz", "v1.2.3", "abc123")
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /healthz = %d", rec.Code)
+	}
+	if got, want := rec.Header().Get("Content-Type"), "application/json"; got != want {
+		t.Errorf("Content-Type = %q, want %q", got, want)
+	}
+	var got map[string]string
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got["status"] != "ok" || got["version"] != "v1.2.3" || got["commit"] != "abc123" {
+		t.Errorf("got %v", got)
+	}
+	if _, err := time.ParseDuration(got["uptime"]); err != nil {
+		t.Errorf("invalid uptime %q: %v", got["uptime"], err)
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/healthz", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST /healthz = %d, want %d", rec.Code, http.StatusMethodNotAllowed)
+	}
+
+	for _, pattern := range []string{"/healthz", "GET /other"} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("expected HandleHealthCheck(%q) to panic", pattern)
+				}
+			}()
+			mux.HandleHealthCheck(pattern, "", "")
+		}()
+	}
+}
@@ -0,0 +1,72 @@
+package servemux
+
+import (
+	"net/http"
+	"net/url"
+)
+
+// InspectionResult is the result of the [ServeMux.InspectRequest].
+type InspectionResult struct {
+	// MatchedPattern is the pattern that the request matches, or "" if it
+	// matches none.
+	MatchedPattern string
+
+	// PathVars is the path variables resolved for the MatchedPattern.
+	PathVars map[string]string
+
+	// WouldRedirect reports whether the request would be redirected, either
+	// to the canonical form of its path, or from a path like "/subtree" to
+	// "/subtree/".
+	WouldRedirect bool
+
+	// RedirectTarget is the URL that the request would be redirected to, if
+	// the WouldRedirect is true.
+	RedirectTarget string
+
+	// MatchPhase is "host-specific" if the MatchedPattern has a host,
+	// "generic" if it has none, and "not-found" if there is no
+	// MatchedPattern.
+	MatchPhase string
+
+	// AllowedMethods is the sorted methods allowed for the request host and
+	// path, as returned by the [ServeMux.AllowedMethods].
+	AllowedMethods []string
+}
+
+// InspectRequest reports how the r would be routed, for use by diagnostic
+// endpoints. Like the [ServeMux.Match], it neither calls any handler nor
+// modifies the r, and it only holds the read lock of the mux.
+func (mux *ServeMux) InspectRequest(r *http.Request) InspectionResult {
+	path := mux.cleanRequestPath(r.Method, r.URL.Path)
+
+	ir := InspectionResult{MatchPhase: "not-found"}
+	pathVars := map[string]string{}
+
+	mux.mu.RLock()
+	_, ht := mux.lookup(path, r, pathVars, nil, nil)
+	ir.AllowedMethods = mux.allowedMethods(r.Host, path)
+	mux.mu.RUnlock()
+
+	if ht != nil {
+		ir.MatchedPattern = ht.pattern
+		ir.PathVars = pathVars
+		ir.MatchPhase = "generic"
+		if _, host, _ := splitPattern(ht.pattern); host != "" {
+			ir.MatchPhase = "host-specific"
+		}
+	}
+
+	switch {
+	case path != r.URL.Path && !mux.noPathCleaning.Load():
+		if mux.caseInsensitive {
+			path = foldPathCase(path, ht)
+		}
+		ir.WouldRedirect = true
+		ir.RedirectTarget = (&url.URL{Path: path, RawQuery: r.URL.RawQuery}).String()
+	case ht != nil && ht.method == "_tsr":
+		ir.WouldRedirect = true
+		ir.RedirectTarget = tsrURL(r)
+	}
+
+	return ir
+}
@@ -0,0 +1,65 @@
+package servemux
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestServeMuxInspectRequest(t *testing.T) {
+	setParallel(t)
+
+	mux := NewServeMux()
+	mux.Handle("GET /users/{id}", stringHandler("user"))
+	mux.Handle("POST /users/{id}", stringHandler("user"))
+	mux.Handle("/subtree/", stringHandler("subtree"))
+	mux.Handle("example.net/{path...}", stringHandler("example.net"))
+
+	tests := []struct {
+		method string
+		url    string
+		want   InspectionResult
+	}{
+		{http.MethodGet, "/users/1", InspectionResult{
+			MatchedPattern: "GET /users/{id}",
+			PathVars:       map[string]string{"id": "1"},
+			MatchPhase:     "generic",
+			AllowedMethods: []string{"GET", "HEAD", "POST"},
+		}},
+		{http.MethodDelete, "/users/1", InspectionResult{
+			MatchPhase:     "not-found",
+			AllowedMethods: []string{"GET", "HEAD", "POST"},
+		}},
+		{http.MethodGet, "/users/../users/1?x=y", InspectionResult{
+			MatchedPattern: "GET /users/{id}",
+			PathVars:       map[string]string{"id": "1"},
+			WouldRedirect:  true,
+			RedirectTarget: "/users/1?x=y",
+			MatchPhase:     "generic",
+			AllowedMethods: []string{"GET", "HEAD", "POST"},
+		}},
+		{http.MethodGet, "/subtree", InspectionResult{
+			MatchedPattern: "/subtree/",
+			PathVars:       map[string]string{},
+			WouldRedirect:  true,
+			RedirectTarget: "/subtree/",
+			MatchPhase:     "generic",
+		}},
+		{http.MethodGet, "http://example.net/a/b", InspectionResult{
+			MatchedPattern: "example.net/{path...}",
+			PathVars:       map[string]string{"path": "a/b"},
+			MatchPhase:     "host-specific",
+			AllowedMethods: []string{"*"},
+		}},
+		{http.MethodGet, "/missing", InspectionResult{
+			MatchPhase: "not-found",
+		}},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, tt.url, nil)
+		if got := mux.InspectRequest(r); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s %s = %+v, want %+v", tt.method, tt.url, got, tt.want)
+		}
+	}
+}
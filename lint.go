@@ -0,0 +1,404 @@
+package servemux
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp/syntax"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Severity is the severity of a [Diagnostic].
+type Severity int
+
+// The severities of [Diagnostic].
+const (
+	SeverityWarning Severity = iota + 1
+	SeverityError
+)
+
+// String implements the [fmt.Stringer].
+func (s Severity) String() string {
+	switch s {
+	case SeverityWarning:
+		return "warning"
+	case SeverityError:
+		return "error"
+	}
+	return fmt.Sprintf("Severity(%d)", int(s))
+}
+
+// MarshalText implements the [encoding.TextMarshaler].
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// Diagnostic is a problem found in a pattern by [PatternLint] or
+// [AmbiguityCheck].
+type Diagnostic struct {
+	Pattern  string   `json:"pattern"`
+	Severity Severity `json:"severity"`
+	Message  string   `json:"message"`
+
+	// Fix is the corrected pattern. It is empty if the problem cannot be
+	// fixed automatically.
+	Fix string `json:"fix,omitempty"`
+}
+
+// String implements the [fmt.Stringer].
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s: %q: %s", d.Severity, d.Pattern, d.Message)
+}
+
+// ValidatePattern reports whether the pattern can be registered with a
+// [ServeMux]. It returns the same error that [ServeMux.Handle] would panic
+// with, except that conflicts with other patterns are not checked. The error
+// of an invalid pattern states the byte offset of its offending part, such as
+// the invalid method, host label or path element, and quotes it.
+func ValidatePattern(pattern string) error {
+	if pattern == "" {
+		return errors.New("http.ServeMux: empty pattern")
+	}
+	_, _, _, _, _, err := parsePattern(pattern)
+	return err
+}
+
+// standardMethods is the set of methods defined by RFC 9110 and RFC 5789.
+var standardMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodPost:    true,
+	http.MethodPut:     true,
+	http.MethodPatch:   true,
+	http.MethodDelete:  true,
+	http.MethodConnect: true,
+	http.MethodOptions: true,
+	http.MethodTrace:   true,
+}
+
+// PatternLint reports suspicious but valid constructs in the pattern. An
+// invalid pattern results in a single [SeverityError] diagnostic.
+func PatternLint(pattern string) []Diagnostic {
+	if err := ValidatePattern(pattern); err != nil {
+		return []Diagnostic{{Pattern: pattern, Severity: SeverityError, Message: err.Error()}}
+	}
+
+	method, host, path := splitPattern(pattern)
+
+	join := func(method, host, path string) string {
+		if method != "" {
+			return method + " " + host + path
+		}
+		return host + path
+	}
+
+	var ds []Diagnostic
+	if method != "" {
+		if um := strings.ToUpper(method); um != method {
+			ds = append(ds, Diagnostic{
+				Pattern:  pattern,
+				Severity: SeverityWarning,
+				Message:  "method is not upper case and will not match requests using the canonical method",
+				Fix:      join(um, host, path),
+			})
+		} else if !standardMethods[method] {
+			ds = append(ds, Diagnostic{
+				Pattern:  pattern,
+				Severity: SeverityWarning,
+				Message:  fmt.Sprintf("method %q is not a standard HTTP method", method),
+			})
+		}
+	}
+
+	if host != "" {
+		if lh := strings.ToLower(host); lh != host {
+			ds = append(ds, Diagnostic{
+				Pattern:  pattern,
+				Severity: SeverityWarning,
+				Message:  "host is not lower case",
+				Fix:      join(method, lh, path),
+			})
+		}
+		if strings.Contains(host, ":") && method != http.MethodConnect {
+			ds = append(ds, Diagnostic{
+				Pattern:  pattern,
+				Severity: SeverityWarning,
+				Message:  "host has a port, which is stripped from non-CONNECT requests before matching",
+			})
+		}
+	}
+
+	if strings.Contains(path, "//") {
+		cp := path
+		for strings.Contains(cp, "//") {
+			cp = strings.ReplaceAll(cp, "//", "/")
+		}
+		ds = append(ds, Diagnostic{
+			Pattern:  pattern,
+			Severity: SeverityWarning,
+			Message:  "path has consecutive slashes, which never survive request path cleaning",
+			Fix:      join(method, host, cp),
+		})
+	}
+
+	walkPath(path, func(_, elem string, _ int) bool {
+		switch elem {
+		case ".", "..":
+			ds = append(ds, Diagnostic{
+				Pattern:  pattern,
+				Severity: SeverityWarning,
+				Message:  fmt.Sprintf("path has a %q element, which never survives request path cleaning", elem),
+			})
+		case "{}":
+			ds = append(ds, Diagnostic{
+				Pattern:  pattern,
+				Severity: SeverityWarning,
+				Message:  "path has an unnamed variable, whose value will be silently dropped",
+			})
+		}
+		return true
+	})
+
+	if strings.HasSuffix(path, "/{...}") {
+		ds = append(ds, Diagnostic{
+			Pattern:  pattern,
+			Severity: SeverityWarning,
+			Message:  `trailing "/{...}" is equivalent to a trailing "/"`,
+			Fix:      join(method, host, strings.TrimSuffix(path, "{...}")),
+		})
+	}
+
+	return ds
+}
+
+// AmbiguityCheck reports the patterns that cannot be registered together
+// with a [ServeMux]. Invalid patterns are skipped, use [ValidatePattern] or
+// [PatternLint] for them.
+//
+// A pattern that conflicts with an earlier one results in a [SeverityError]
+// diagnostic. A method-less pattern that shares its host and path with a
+// method-specific one results in a [SeverityWarning] diagnostic, since the
+// method-less one silently handles all other methods.
+func AmbiguityCheck(patterns []string) []Diagnostic {
+	var (
+		ds                  []Diagnostic
+		cleanedPatterns     = map[string]string{}
+		methodlessPatterns  = map[string]string{}
+		methodfulPatterns   = map[string]string{}
+		reportedMethodPaths = map[string]bool{}
+	)
+	for _, pattern := range patterns {
+		if pattern == "" {
+			continue
+		}
+		method, host, path, _, _, err := parsePattern(pattern)
+		if err != nil {
+			continue
+		}
+
+		cleanedPattern := method + " " + host + path
+		if registeredPattern, ok := cleanedPatterns[cleanedPattern]; ok {
+			ds = append(ds, Diagnostic{
+				Pattern:  pattern,
+				Severity: SeverityError,
+				Message:  fmt.Sprintf("conflicts with %q", registeredPattern),
+			})
+			continue
+		}
+		cleanedPatterns[cleanedPattern] = pattern
+
+		hostpath := host + path
+		if method == "" {
+			methodlessPatterns[hostpath] = pattern
+		} else if _, ok := methodfulPatterns[hostpath]; !ok {
+			methodfulPatterns[hostpath] = pattern
+		}
+		if reportedMethodPaths[hostpath] {
+			continue
+		}
+		mlp, ok1 := methodlessPatterns[hostpath]
+		mfp, ok2 := methodfulPatterns[hostpath]
+		if ok1 && ok2 {
+			reportedMethodPaths[hostpath] = true
+			ds = append(ds, Diagnostic{
+				Pattern:  mlp,
+				Severity: SeverityWarning,
+				Message:  fmt.Sprintf("handles every method not registered by patterns like %q", mfp),
+			})
+		}
+	}
+	return ds
+}
+
+// PatternWarning is a suspicious route configuration found in a [ServeMux] by
+// the [ServeMux.ValidateRegistrations].
+type PatternWarning struct {
+	Severity Severity `json:"severity"`
+	Pattern  string   `json:"pattern"`
+	Message  string   `json:"message"`
+}
+
+// String implements the [fmt.Stringer].
+func (pw PatternWarning) String() string {
+	return fmt.Sprintf("%s: %q: %s", pw.Severity, pw.Pattern, pw.Message)
+}
+
+// ValidateRegistrations reports the suspicious route configurations among
+// the registered patterns, which are meant to be checked after registering
+// all of them. It reports:
+//
+//   - A pattern that is unreachable because another pattern always matches
+//     first, such as "/users/{id}" with "/users/{name:.*}" registered, as a
+//     [SeverityError] warning.
+//   - A pattern whose host has a port, which is stripped from non-CONNECT
+//     requests before matching, so that these requests fall through to the
+//     broader patterns.
+//   - A pattern like "/subtree/" whose redirect from "/subtree" to
+//     "/subtree/" is overridden by a pattern like "POST /subtree", which
+//     stops the redirect for all methods.
+//   - A pattern with a host variable label whose path has a variable named
+//     "subdomain", which shadows the built-in "subdomain" path variable.
+//
+// The warnings are sorted by their patterns.
+func (mux *ServeMux) ValidateRegistrations() []PatternWarning {
+	type registration struct {
+		method, host, path string
+		elems              []string
+		pattern            string
+	}
+
+	mux.mu.RLock()
+	var (
+		regs        []registration
+		tsrPatterns = map[string]string{}
+	)
+	for cleanedPattern, pattern := range mux.registeredPatterns {
+		method, hostpath, _ := strings.Cut(cleanedPattern, " ")
+		host, path := hostpath, ""
+		if i := strings.IndexByte(hostpath, '/'); i >= 0 {
+			host, path = hostpath[:i], hostpath[i:]
+		}
+		if method == "_tsr" {
+			tsrPatterns[hostpath] = pattern
+			continue
+		}
+		regs = append(regs, registration{
+			method:  method,
+			host:    host,
+			path:    path,
+			elems:   strings.Split(path, "/"),
+			pattern: pattern,
+		})
+	}
+	mux.mu.RUnlock()
+
+	sort.Slice(regs, func(i, j int) bool { return regs[i].pattern < regs[j].pattern })
+
+	var pws []PatternWarning
+	for _, reg := range regs {
+		for _, other := range regs {
+			if other.pattern != reg.pattern &&
+				other.host == reg.host &&
+				(other.method == "" || other.method == reg.method) &&
+				shadowsPathElems(other.elems, reg.elems) {
+				pws = append(pws, PatternWarning{
+					Severity: SeverityError,
+					Pattern:  reg.pattern,
+					Message:  fmt.Sprintf("is unreachable, since %q always matches first", other.pattern),
+				})
+				break
+			}
+		}
+
+		if strings.Contains(reg.host, ":") && reg.method != http.MethodConnect {
+			pws = append(pws, PatternWarning{
+				Severity: SeverityWarning,
+				Pattern:  reg.pattern,
+				Message:  "host has a port, which is stripped from non-CONNECT requests before matching, so they fall through to the broader patterns",
+			})
+		}
+
+		if tsrPattern, ok := tsrPatterns[reg.host+reg.path]; ok {
+			pws = append(pws, PatternWarning{
+				Severity: SeverityWarning,
+				Pattern:  tsrPattern,
+				Message:  fmt.Sprintf("redirect from %q to %q is overridden by %q for all methods", reg.path, reg.path+"/", reg.pattern),
+			})
+		}
+
+		if _, _, _, hostVarNames, pathVarNames, err := parsePattern(reg.pattern); err == nil && len(hostVarNames) > 0 {
+			for _, name := range pathVarNames {
+				if name == "subdomain" {
+					pws = append(pws, PatternWarning{
+						Severity: SeverityWarning,
+						Pattern:  reg.pattern,
+						Message:  `path variable "subdomain" shadows the built-in one holding the value of the first host variable label`,
+					})
+				}
+			}
+		}
+	}
+
+	sort.SliceStable(pws, func(i, j int) bool { return pws[i].Pattern < pws[j].Pattern })
+
+	return pws
+}
+
+// shadowsPathElems reports whether the path elements a always match before
+// the path elements b, which is the case when they only differ in that a has
+// a constrained variable that matches every path element where b has an
+// unmodified variable.
+func shadowsPathElems(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	shadows := false
+	for i := range a {
+		if a[i] == b[i] {
+			continue
+		}
+		if b[i] != "{}" || !strings.HasPrefix(a[i], "{:") || !matchesAnyPathElem(a[i][2:len(a[i])-1]) {
+			return false
+		}
+		shadows = true
+	}
+	return shadows
+}
+
+// matchesAnyPathElem reports whether the constraint of a constrained variable
+// path element matches every path element, including the empty one.
+func matchesAnyPathElem(constraint string) bool {
+	re, err := syntax.Parse(constraint, syntax.Perl)
+	if err != nil {
+		return false
+	}
+	re = re.Simplify()
+	for re.Op == syntax.OpCapture {
+		re = re.Sub[0]
+	}
+	if re.Op != syntax.OpStar {
+		return false
+	}
+	switch sub := re.Sub[0]; sub.Op {
+	case syntax.OpAnyChar, syntax.OpAnyCharNotNL:
+		return true
+	case syntax.OpCharClass:
+		// The class must cover every rune, except the '\n' and the '/'
+		// that are unlikely to appear in path elements.
+		next := rune(0)
+		for i := 0; i+1 < len(sub.Rune); i += 2 {
+			for ; next < sub.Rune[i]; next++ {
+				if next != '\n' && next != '/' {
+					return false
+				}
+			}
+			if next <= sub.Rune[i+1] {
+				next = sub.Rune[i+1] + 1
+			}
+		}
+		return next > unicode.MaxRune
+	}
+	return false
+}
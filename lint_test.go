@@ -0,0 +1,190 @@
+package servemux
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestValidatePattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		ok      bool
+	}{
+		{"/", true},
+		{"GET /foo/{bar}", true},
+		{"example.com/foo/{bar...}", true},
+		{"/foo/{$}", true},
+		{"/foo/{bar?}", true},
+		{"", false},
+		{"GE-T /", false},
+		{"/foo/{bar", false},
+		{"/foo/{1bar}", false},
+		{"/foo/{bar}/{bar}", false},
+		{"/foo/{bar...}/baz", false},
+		{"/foo/{bar$}", false},
+		{"/foo/{bar*}", false},
+		{"/foo/{bar?}/baz", false},
+		{"/{bar?}", false},
+		{"/foo/{bar?:[0-9]+}", false},
+	}
+	for _, tt := range tests {
+		if err := ValidatePattern(tt.pattern); (err == nil) != tt.ok {
+			t.Errorf("ValidatePattern(%q) = %v, want ok = %t", tt.pattern, err, tt.ok)
+		}
+	}
+
+	mux := NewServeMux()
+	mux.Handle("/foo/{bar}", serve(200))
+	if err := ValidatePattern("/foo/{baz}"); err != nil {
+		t.Errorf("ValidatePattern must not check conflicts, got %v", err)
+	}
+}
+
+func TestValidatePatternError(t *testing.T) {
+	tests := []struct {
+		pattern string
+		want    string
+	}{
+		{"/", ""},
+		{"", "http.ServeMux: empty pattern"},
+		{"GE-T /", `http.ServeMux: a pattern method must be either empty or alphanumeric at position 0 in pattern "GE-T /": "GE-T"`},
+		{"{a.example.com/", `http.ServeMux: each label in a pattern host must either be a variable or not at position 0 in pattern "{a.example.com/": "{a"`},
+		{"GET {a}.{b.example.com/", `http.ServeMux: each label in a pattern host must either be a variable or not at position 8 in pattern "GET {a}.{b.example.com/": "{b"`},
+		{"{1}.example.com/", `http.ServeMux: the name of a variable label in a pattern host must be either empty or a Go identifier at position 0 in pattern "{1}.example.com/": "{1}"`},
+		{"/foo/{bar", `http.ServeMux: each path element in a pattern path must either be a variable or not at position 5 in pattern "/foo/{bar": "{bar"`},
+		{"/foo/{bar}/{bar}", `http.ServeMux: all variable path elements within the same pattern path must have unique names at position 11 in pattern "/foo/{bar}/{bar}": "{bar}"`},
+		{"/foo/{bar...}/baz", `http.ServeMux: a ...-modified variable can only be the last path element in a pattern path at position 5 in pattern "/foo/{bar...}/baz": "{bar...}"`},
+		{"/foo/{bar*}", `http.ServeMux: the name of a variable path element in a pattern path must be either empty or a Go identifier at position 5 in pattern "/foo/{bar*}": "{bar*}"`},
+		{"/foo/{id:[0-9}", "http.ServeMux: the constraint \"[0-9\" of a variable path element in a pattern path is not a valid regular expression: error parsing regexp: missing closing ]: `[0-9` at position 5 in pattern \"/foo/{id:[0-9}\": \"{id:[0-9}\""},
+		{"{id}.example.com/{id}/x", `http.ServeMux: the variable labels in a pattern host and the variable path elements in a pattern path must have unique names at position 17 in pattern "{id}.example.com/{id}/x": "{id}"`},
+	}
+	for _, tt := range tests {
+		err := ValidatePattern(tt.pattern)
+		if got := fmt.Sprint(err); err == nil && tt.want != "" || err != nil && got != tt.want {
+			t.Errorf("ValidatePattern(%q) = %v, want %s", tt.pattern, err, tt.want)
+		}
+	}
+}
+
+func TestPatternLint(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		severity Severity
+		fix      string
+	}{
+		{"get /foo", SeverityWarning, "GET /foo"},
+		{"PURGE /foo", SeverityWarning, ""},
+		{"Example.com/foo", SeverityWarning, "example.com/foo"},
+		{"example.com:8080/foo", SeverityWarning, ""},
+		{"/foo//bar", SeverityWarning, "/foo/bar"},
+		{"/foo/../bar", SeverityWarning, ""},
+		{"/foo/{}", SeverityWarning, ""},
+		{"/foo/{...}", SeverityWarning, "/foo/"},
+		{"/foo/{bar", SeverityError, ""},
+	}
+	for _, tt := range tests {
+		ds := PatternLint(tt.pattern)
+		if len(ds) != 1 {
+			t.Errorf("PatternLint(%q) = %v, want 1 diagnostic", tt.pattern, ds)
+			continue
+		}
+		if got, want := ds[0].Severity, tt.severity; got != want {
+			t.Errorf("PatternLint(%q) severity = %v, want %v", tt.pattern, got, want)
+		}
+		if got, want := ds[0].Fix, tt.fix; got != want {
+			t.Errorf("PatternLint(%q) fix = %q, want %q", tt.pattern, got, want)
+		}
+	}
+
+	for _, pattern := range []string{"/", "GET /foo/{bar}", "CONNECT example.com:8080/", "/foo/{bar...}"} {
+		if ds := PatternLint(pattern); len(ds) > 0 {
+			t.Errorf("PatternLint(%q) = %v, want none", pattern, ds)
+		}
+	}
+}
+
+func TestAmbiguityCheck(t *testing.T) {
+	ds := AmbiguityCheck([]string{
+		"GET /foo/{bar}",
+		"GET /foo/{baz}",
+		"/foo/{bar...}",
+		"/foo/",
+		"/qux",
+		"POST /qux",
+		"PUT /qux",
+		"/foo/{bar",
+	})
+	want := []Diagnostic{
+		{Pattern: "GET /foo/{baz}", Severity: SeverityError},
+		{Pattern: "/foo/", Severity: SeverityError},
+		{Pattern: "/qux", Severity: SeverityWarning},
+	}
+	if len(ds) != len(want) {
+		t.Fatalf("got %v, want %d diagnostics", ds, len(want))
+	}
+	for i := range want {
+		if ds[i].Pattern != want[i].Pattern || ds[i].Severity != want[i].Severity {
+			t.Errorf("#%d: got %v, want %q with %v", i, ds[i], want[i].Pattern, want[i].Severity)
+		}
+	}
+}
+
+func TestServeMuxValidateRegistrations(t *testing.T) {
+	mux := NewServeMux()
+	for _, pattern := range []string{
+		"GET /users/{id}",
+		"/users/{name:.*}",
+		"/orders/{id}",
+		"/orders/{id:[0-9]+}",
+		"/files/{f}/x",
+		"/files/{f:.*}/y",
+		"example.com:8080/",
+		"CONNECT example.com:8443/",
+		"/subtree/",
+		"POST /subtree",
+		"/other/",
+		"{tenant}.example.com/{subdomain}",
+		"/{subdomain}",
+		"example.org",
+		"CONNECT example.net:8080",
+	} {
+		mux.Handle(pattern, stringHandler(pattern))
+	}
+
+	want := []PatternWarning{
+		{Severity: SeverityWarning, Pattern: "/subtree/"},
+		{Severity: SeverityError, Pattern: "GET /users/{id}"},
+		{Severity: SeverityWarning, Pattern: "example.com:8080/"},
+		{Severity: SeverityWarning, Pattern: "{tenant}.example.com/{subdomain}"},
+	}
+	pws := mux.ValidateRegistrations()
+	if len(pws) != len(want) {
+		t.Fatalf("got %v, want %d warnings", pws, len(want))
+	}
+	for i := range want {
+		if pws[i].Pattern != want[i].Pattern || pws[i].Severity != want[i].Severity || pws[i].Message == "" {
+			t.Errorf("#%d: got %v, want %q with %v", i, pws[i], want[i].Pattern, want[i].Severity)
+		}
+	}
+}
+
+func TestMatchesAnyPathElem(t *testing.T) {
+	for _, tt := range []struct {
+		constraint string
+		want       bool
+	}{
+		{".*", true},
+		{"(.*)", true},
+		{"(?s).*", true},
+		{`[\s\S]*`, true},
+		{`[^\n]*`, true},
+		{".+", false},
+		{`[\s\S]+`, false},
+		{"[a-z]*", false},
+		{"[0-9]+", false},
+	} {
+		if got := matchesAnyPathElem(tt.constraint); got != tt.want {
+			t.Errorf("matchesAnyPathElem(%q) = %t, want %t", tt.constraint, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package servemux
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+)
+
+// WithLogger returns an [Option] that makes a [ServeMux] log each request
+// dispatched by the [ServeMux.ServeHTTP] to the logger at the debug level,
+// with the attributes "method", "path", "pattern", "duration" and "status".
+// The pattern is "" if the request did not match any pattern. The logger also
+// receives the warnings about overlapping patterns described in the
+// [WithSilentPatternOverlap], which are otherwise logged using the [log].
+func WithLogger(logger *slog.Logger) Option {
+	return func(mux *ServeMux) { mux.logger = logger }
+}
+
+// WithLogAttrs returns an [Option] that makes a [ServeMux] add the attributes
+// returned by the fn to the requests logged because of the [WithLogger]. The
+// fn is called with the request, the matched pattern and the duration of the
+// handler.
+func WithLogAttrs(fn func(r *http.Request, pattern string, duration time.Duration) []slog.Attr) Option {
+	return func(mux *ServeMux) { mux.logAttrs = fn }
+}
+
+// logRequest logs the r dispatched to the pattern at the start. It must be
+// called with the sw that wrapped the response writer of the r.
+func (mux *ServeMux) logRequest(ctx context.Context, r *http.Request, pattern string, start time.Time, sw *statusResponseWriter) {
+	duration := time.Since(start)
+	attrs := []slog.Attr{
+		slog.String("method", r.Method),
+		slog.String("path", r.URL.Path),
+		slog.String("pattern", pattern),
+		slog.Duration("duration", duration),
+		slog.Int("status", sw.status()),
+	}
+	if mux.logAttrs != nil {
+		attrs = append(attrs, mux.logAttrs(r, pattern, duration)...)
+	}
+	mux.logger.LogAttrs(ctx, slog.LevelDebug, "http: dispatched request", attrs...)
+}
+
+// statusResponseWriter is an [http.ResponseWriter] that records the status
+// code of the response.
+type statusResponseWriter struct {
+	http.ResponseWriter
+	code int
+}
+
+// WriteHeader implements the [http.ResponseWriter].
+func (sw *statusResponseWriter) WriteHeader(code int) {
+	if sw.code == 0 && code >= 200 {
+		sw.code = code
+	}
+	sw.ResponseWriter.WriteHeader(code)
+}
+
+// Write implements the [http.ResponseWriter].
+func (sw *statusResponseWriter) Write(b []byte) (int, error) {
+	if sw.code == 0 {
+		sw.code = http.StatusOK
+	}
+	return sw.ResponseWriter.Write(b)
+}
+
+// Flush implements the [http.Flusher].
+func (sw *statusResponseWriter) Flush() {
+	if sw.code == 0 {
+		sw.code = http.StatusOK
+	}
+	if f, ok := sw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack implements the [http.Hijacker]. It returns an error wrapping the
+// [http.ErrNotSupported] if the underlying [http.ResponseWriter] does not
+// support hijacking.
+func (sw *statusResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(sw.ResponseWriter).Hijack()
+}
+
+// ReadFrom implements the [io.ReaderFrom], so that the underlying
+// [http.ResponseWriter] can still copy from files efficiently.
+func (sw *statusResponseWriter) ReadFrom(src io.Reader) (int64, error) {
+	if sw.code == 0 {
+		sw.code = http.StatusOK
+	}
+	if rf, ok := sw.ResponseWriter.(io.ReaderFrom); ok {
+		return rf.ReadFrom(src)
+	}
+	return io.Copy(writerOnly{sw.ResponseWriter}, src)
+}
+
+// writerOnly hides the optional interfaces of an [io.Writer], so that the
+// [io.Copy] does not call the ReadFrom of it.
+type writerOnly struct {
+	io.Writer
+}
+
+// Unwrap returns the underlying [http.ResponseWriter], for the
+// [http.ResponseController].
+func (sw *statusResponseWriter) Unwrap() http.ResponseWriter {
+	return sw.ResponseWriter
+}
+
+// status returns the recorded status code, which is 200 if nothing has been
+// written, just like the [http.Server] would respond.
+func (sw *statusResponseWriter) status() int {
+	if sw.code == 0 {
+		return http.StatusOK
+	}
+	return sw.code
+}
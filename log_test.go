@@ -0,0 +1,167 @@
+package servemux
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWithLogger(t *testing.T) {
+	setParallel(t)
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	mux := NewServeMux(
+		WithLogger(logger),
+		WithLogAttrs(func(r *http.Request, pattern string, _ time.Duration) []slog.Attr {
+			return []slog.Attr{slog.String("id", PathVars(r)["id"])}
+		}),
+	)
+	mux.HandleFunc("GET /users/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	})
+	mux.HandleFunc("GET /ok", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+
+	tests := []struct {
+		method  string
+		path    string
+		pattern string
+		status  int
+		id      string
+	}{
+		{http.MethodGet, "/users/1", "GET /users/{id}", http.StatusAccepted, "1"},
+		{http.MethodGet, "/ok", "GET /ok", http.StatusOK, ""},
+		{http.MethodGet, "/nothing", "", http.StatusNotFound, ""},
+		{http.MethodPost, "/users/1", "", http.StatusMethodNotAllowed, ""},
+	}
+	for _, tt := range tests {
+		buf.Reset()
+		mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(tt.method, tt.path, nil))
+
+		var entry struct {
+			Level    string
+			Method   string
+			Path     string
+			Pattern  string
+			Duration time.Duration
+			Status   int
+			ID       string
+		}
+		if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+			t.Fatalf("%s %s: unexpected log %q: %v", tt.method, tt.path, buf.String(), err)
+		}
+		if entry.Level != "DEBUG" ||
+			entry.Method != tt.method ||
+			entry.Path != tt.path ||
+			entry.Pattern != tt.pattern ||
+			entry.Status != tt.status ||
+			entry.ID != tt.id {
+			t.Errorf("%s %s: unexpected log %q", tt.method, tt.path, buf.String())
+		}
+	}
+
+	buf.Reset()
+	mux = NewServeMux(WithLogger(slog.New(slog.NewJSONHandler(&buf, nil))))
+	mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	if buf.Len() != 0 {
+		t.Errorf("logged %q above the debug level", buf.String())
+	}
+}
+
+func TestWithLoggerHijack(t *testing.T) {
+	setParallel(t)
+
+	var buf bytes.Buffer
+	mux := NewServeMux(WithLogger(slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))))
+	mux.HandleFunc("GET /hijack", func(w http.ResponseWriter, r *http.Request) {
+		hj, ok := w.(http.Hijacker)
+		if !ok {
+			t.Error("response writer does not implement http.Hijacker")
+			return
+		}
+		conn, _, err := hj.Hijack()
+		if err != nil {
+			t.Errorf("Hijack() = %v", err)
+			return
+		}
+		defer conn.Close()
+		conn.Write([]byte("HTTP/1.1 204 No Content\r\nConnection: close\r\n\r\n"))
+	})
+	mux.HandleFunc("GET /copy", func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := w.(io.ReaderFrom); !ok {
+			t.Error("response writer does not implement io.ReaderFrom")
+		}
+		io.Copy(w, strings.NewReader("copied"))
+	})
+	s := httptest.NewServer(mux)
+	defer s.Close()
+
+	res, err := http.Get(s.URL + "/hijack")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusNoContent {
+		t.Errorf("hijacked status = %d, want %d", res.StatusCode, http.StatusNoContent)
+	}
+
+	res, err = http.Get(s.URL + "/copy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+	if string(b) != "copied" {
+		t.Errorf("copied body = %q, want %q", b, "copied")
+	}
+
+	rec := httptest.NewRecorder()
+	sw := &statusResponseWriter{ResponseWriter: rec}
+	if _, _, err := sw.Hijack(); !errors.Is(err, http.ErrNotSupported) {
+		t.Errorf("Hijack() = %v, want %v", err, http.ErrNotSupported)
+	}
+	if n, err := sw.ReadFrom(strings.NewReader("body")); n != 4 || err != nil || rec.Body.String() != "body" || sw.status() != http.StatusOK {
+		t.Errorf("ReadFrom() = %d, %v with body %q and status %d", n, err, rec.Body.String(), sw.status())
+	}
+}
+
+func TestServeMuxPatternOverlapWarning(t *testing.T) {
+	setParallel(t)
+
+	for _, tt := range []struct {
+		opts     []Option
+		patterns []string
+		want     []string
+	}{
+		{nil, []string{"GET /users", "/users"}, []string{"method-less", "GET /users"}},
+		{nil, []string{"/users", "GET /users"}, []string{"method-less", "GET /users"}},
+		{nil, []string{"GET /users", "POST /users", "/subtree/", "/subtree"}, nil},
+		{[]Option{WithSilentPatternOverlap()}, []string{"GET /users", "/users"}, nil},
+	} {
+		var buf bytes.Buffer
+		logger := slog.New(slog.NewTextHandler(&buf, nil))
+		mux := NewServeMux(append(tt.opts, WithLogger(logger))...)
+		for _, pattern := range tt.patterns {
+			mux.Handle(pattern, stringHandler(pattern))
+		}
+
+		got := buf.String()
+		if (got != "") != (tt.want != nil) || bytes.Count(buf.Bytes(), []byte("level=WARN")) > 1 {
+			t.Errorf("%q: got log %q", tt.patterns, got)
+		}
+		for _, want := range tt.want {
+			if !bytes.Contains(buf.Bytes(), []byte(want)) {
+				t.Errorf("%q: log %q does not contain %q", tt.patterns, got, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package servemux
+
+import (
+	"time"
+)
+
+// RegisterMetrics adds the reporter to be called after each request dispatched
+// by the [ServeMux.ServeHTTP] has been handled, with the method of the request,
+// the matched pattern rather than the request path to keep the cardinality of
+// metrics bounded, the status code of the response, and the duration of the
+// handling. The pattern is "" if the request did not match any pattern, and the
+// status code is 200 if the handler wrote nothing. Reporters are called in the
+// order they were added. RegisterMetrics panics if the mux has been
+// precompiled.
+func (mux *ServeMux) RegisterMetrics(reporter func(method, pattern string, status int, duration time.Duration)) {
+	if reporter == nil {
+		panic("http.ServeMux: nil metrics reporter")
+	}
+	mux.mu.Lock()
+	defer mux.mu.Unlock()
+	if mux.sealed.Load() {
+		panic(errPrecompiled.Error())
+	}
+	mux.metricsReporters = append(mux.metricsReporters, reporter)
+}
+
+// loadMetricsReporters returns the mux.metricsReporters.
+func (mux *ServeMux) loadMetricsReporters() []func(string, string, int, time.Duration) {
+	if mux.sealed.Load() {
+		return mux.metricsReporters
+	}
+	mux.mu.RLock()
+	defer mux.mu.RUnlock()
+	return mux.metricsReporters
+}
+
+// reportMetrics calls the reporters with the request of the method dispatched
+// to the pattern at the start. It must be called with the sw that wrapped the
+// response writer of the request.
+func reportMetrics(reporters []func(string, string, int, time.Duration), method, pattern string, start time.Time, sw *statusResponseWriter) {
+	duration := time.Since(start)
+	for _, reporter := range reporters {
+		reporter(method, pattern, sw.status(), duration)
+	}
+}
@@ -0,0 +1,57 @@
+package servemux
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestServeMuxRegisterMetrics(t *testing.T) {
+	mux := NewServeMux()
+	mux.HandleFunc("GET /users/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+	mux.Handle("POST /users", serve(201))
+
+	var got []string
+	for _, name := range []string{"a", "b"} {
+		name := name
+		mux.RegisterMetrics(func(method, pattern string, status int, duration time.Duration) {
+			if duration < 0 {
+				t.Errorf("got negative duration %v", duration)
+			}
+			got = append(got, fmt.Sprintf("%s %s %q %d", name, method, pattern, status))
+		})
+	}
+
+	for _, tt := range []struct {
+		method, path string
+		want         []string
+	}{
+		{"GET", "/users/42", []string{`a GET "GET /users/{id}" 200`, `b GET "GET /users/{id}" 200`}},
+		{"POST", "/users", []string{`a POST "POST /users" 201`, `b POST "POST /users" 201`}},
+		{"GET", "/nope", []string{`a GET "" 404`, `b GET "" 404`}},
+	} {
+		got = nil
+		mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(tt.method, tt.path, nil))
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("%s %s: got %q, want %q", tt.method, tt.path, got, tt.want)
+		}
+	}
+
+	c := mux.Clone()
+	got = nil
+	c.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/users", nil))
+	if len(got) != 2 {
+		t.Errorf("Clone: got %q, want 2 reports", got)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("RegisterMetrics(nil) did not panic")
+		}
+	}()
+	mux.RegisterMetrics(nil)
+}
@@ -0,0 +1,17 @@
+package servemux
+
+import "net/http"
+
+// Chain returns a middleware that applies the middlewares in order, with the
+// first one being the outermost. That is, Chain(m1, m2, m3)(h) is equivalent
+// to m1(m2(m3(h))). Chain() returns a middleware that returns its handler
+// unchanged.
+func Chain(middlewares ...func(http.Handler) http.Handler) func(http.Handler) http.Handler {
+	middlewares = append([]func(http.Handler) http.Handler(nil), middlewares...)
+	return func(h http.Handler) http.Handler {
+		for i := len(middlewares) - 1; i >= 0; i-- {
+			h = middlewares[i](h)
+		}
+		return h
+	}
+}
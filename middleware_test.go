@@ -0,0 +1,100 @@
+package servemux
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestChain(t *testing.T) {
+	setParallel(t)
+
+	middleware := func(name string) func(http.Handler) http.Handler {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Add("Middleware", name)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+
+	h := stringHandler("h")
+	tests := []struct {
+		h    http.Handler
+		want string
+	}{
+		{Chain(middleware("m1"), middleware("m2"), middleware("m3"))(h), "m1,m2,m3"},
+		{middleware("m1")(middleware("m2")(middleware("m3")(h))), "m1,m2,m3"},
+		{Chain()(h), ""},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		tt.h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		if got := strings.Join(rec.Header().Values("Middleware"), ","); got != tt.want {
+			t.Errorf("Middleware = %q, want %q", got, tt.want)
+		}
+		if got := rec.Header().Get("Result"); got != "h" {
+			t.Errorf("Result = %q, want %q", got, "h")
+		}
+	}
+}
+
+func TestServeMuxUseBeforeRouting(t *testing.T) {
+	setParallel(t)
+
+	middleware := func(name string) func(http.Handler) http.Handler {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Add("Middleware", name)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+
+	mux := NewServeMux()
+	mux.Use(middleware("post"))
+	mux.Handle("/admin/{page}", stringHandler("admin"))
+	mux.HandleFunc("/users/{page}", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Result", "users "+PathVars(r)["page"])
+	})
+	mux.UseBeforeRouting(middleware("pre1"))
+	mux.UseBeforeRouting(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if len(PathVars(r)) > 0 || MatchedPattern(r.Context()) != "" {
+				t.Error("request routed before the pre-routing middleware")
+			}
+			w.Header().Add("Middleware", "pre2")
+			if r.Header.Get("Role") != "admin" && strings.HasPrefix(r.URL.Path, "/admin/") {
+				r.URL.Path = "/users/" + strings.TrimPrefix(r.URL.Path, "/admin/")
+			}
+			next.ServeHTTP(w, r)
+		})
+	})
+
+	for _, tt := range []struct {
+		role       string
+		want       string
+		middleware string
+	}{
+		{"admin", "admin", "pre1,pre2,post"},
+		{"", "users settings", "pre1,pre2,post"},
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/admin/settings", nil)
+		r.Header.Set("Role", tt.role)
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, r)
+		if got := rec.Header().Get("Result"); got != tt.want {
+			t.Errorf("role %q: Result = %q, want %q", tt.role, got, tt.want)
+		}
+		if got := strings.Join(rec.Header().Values("Middleware"), ","); got != tt.middleware {
+			t.Errorf("role %q: Middleware = %q, want %q", tt.role, got, tt.middleware)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	mux.Clone().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/nowhere", nil))
+	if got := strings.Join(rec.Header().Values("Middleware"), ","); rec.Code != http.StatusNotFound || got != "pre1,pre2" {
+		t.Errorf("clone: got %d with Middleware = %q", rec.Code, got)
+	}
+}
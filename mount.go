@@ -0,0 +1,97 @@
+package servemux
+
+import (
+	"io/fs"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Mount registers the h for all request paths under the prefix, stripping the
+// prefix from the request path before calling the h. The prefix is in the form
+// of `[host][path]`, and "/{...}" is appended to it to form the registered
+// pattern. The prefix must not end with a variable path element, since the
+// number of path elements stripped is fixed.
+//
+// When the h is a [*ServeMux], it stores its path variables in the same map as
+// the mux, so [PathVars] sees the variables of both the prefix and the pattern
+// matched by the h.
+func (mux *ServeMux) Mount(prefix string, h http.Handler) {
+	if h == nil {
+		panic("http.ServeMux: nil handler")
+	}
+
+	_, _, path := splitPattern(prefix)
+	trimmedPath := strings.TrimRight(path, "/")
+	if elem := trimmedPath[strings.LastIndexByte(trimmedPath, '/')+1:]; strings.HasPrefix(elem, "{") {
+		panic("http.ServeMux: a mount prefix must not end with a variable path element")
+	}
+	n := strings.Count(trimmedPath, "/")
+
+	mux.Handle(prefix[:len(prefix)-len(path)]+trimmedPath+"/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r2 := new(http.Request)
+		*r2 = *r
+		r2.URL = new(url.URL)
+		*r2.URL = *r.URL
+		r2.URL.Path = stripPathElems(r.URL.Path, n)
+		r2.URL.RawPath = ""
+		h.ServeHTTP(w, r2)
+	}))
+}
+
+// ServeFiles registers a file server for the pattern that serves the files
+// in the fsys, using the rest of the request path matched by the trailing "/"
+// or "/{[name]...}" of the pattern as the file name. E.g., with the pattern
+// "/static/", the request path "/static/css/site.css" serves the file
+// "css/site.css". If the pattern path ends with neither, ServeFiles panics.
+//
+// A pattern without a method is registered with the GET method, so that the
+// file server only handles GET and, as usual, HEAD requests.
+func (mux *ServeMux) ServeFiles(pattern string, fsys fs.FS) {
+	if fsys == nil {
+		panic("http.ServeMux: nil file system")
+	}
+
+	method, _, path := splitPattern(pattern)
+	if method == "" {
+		pattern = http.MethodGet + " " + pattern
+	}
+	dir := path
+	if !strings.HasSuffix(path, "/") {
+		i := strings.LastIndexByte(path, '/')
+		if elem := path[i+1:]; !strings.HasPrefix(elem, "{") || !strings.HasSuffix(elem, "...}") {
+			panic(`http.ServeMux: a file server pattern must end with either "/" or a ...-modified variable path element`)
+		}
+		dir = path[:i+1]
+	}
+	n := strings.Count(strings.TrimRight(dir, "/"), "/")
+
+	// The http.FileServerFS is equivalent, but it requires Go 1.22.
+	fileServer := http.FileServer(http.FS(fsys))
+	mux.Handle(pattern, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r2 := new(http.Request)
+		*r2 = *r
+		r2.URL = new(url.URL)
+		*r2.URL = *r.URL
+		r2.URL.Path = stripPathElems(r.URL.Path, n)
+		r2.URL.RawPath = ""
+		fileServer.ServeHTTP(w, r2)
+	}))
+}
+
+// stripPathElems returns the path with its first n path elements removed.
+func stripPathElems(path string, n int) string {
+	i := 0
+	for ; n > 0 && i < len(path); n-- {
+		j := strings.IndexByte(path[i+1:], '/')
+		if j < 0 {
+			i = len(path)
+			break
+		}
+		i += j + 1
+	}
+	if i == len(path) {
+		return "/"
+	}
+	return path[i:]
+}
@@ -0,0 +1,102 @@
+package servemux
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+)
+
+func TestServeMuxMount(t *testing.T) {
+	setParallel(t)
+
+	inner := NewServeMux()
+	inner.HandleFunc("/users/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Result", r.URL.Path+" "+PathVars(r)["tenant"]+" "+PathVars(r)["id"])
+	})
+	inner.HandleFunc("/{$}", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Result", r.URL.Path)
+	})
+
+	mux := NewServeMux()
+	mux.Mount("/tenants/{tenant}/api", inner)
+	mux.Mount("/static/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Result", "static "+r.URL.Path)
+	}))
+
+	tests := []struct {
+		path string
+		code int
+		want string
+	}{
+		{"/tenants/acme/api/users/42", http.StatusOK, "/users/42 acme 42"},
+		{"/tenants/acme/api/", http.StatusOK, "/"},
+		{"/static/css/site.css", http.StatusOK, "static /css/site.css"},
+		{"/static", http.StatusMovedPermanently, ""},
+		{"/tenants/acme/api/nothing", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if rec.Code != tt.code {
+			t.Errorf("%s: Status = %d, want %d", tt.path, rec.Code, tt.code)
+		}
+		if got := rec.Header().Get("Result"); got != tt.want {
+			t.Errorf("%s: Result = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("expected mounting at a prefix ending with a variable to panic")
+		}
+	}()
+	mux.Mount("/things/{id}", inner)
+}
+
+func TestServeMuxServeFiles(t *testing.T) {
+	setParallel(t)
+
+	fsys := fstest.MapFS{
+		"site.css":      {Data: []byte("body{}")},
+		"js/app.js":     {Data: []byte("app()")},
+		"docs/index.md": {Data: []byte("# docs")},
+	}
+	mux := NewServeMux()
+	mux.ServeFiles("GET /static/", fsys)
+	mux.ServeFiles("/{lang}/assets/{file...}", fsys)
+
+	tests := []struct {
+		method string
+		path   string
+		code   int
+		body   string
+	}{
+		{http.MethodGet, "/static/site.css", http.StatusOK, "body{}"},
+		{http.MethodGet, "/static/js/app.js", http.StatusOK, "app()"},
+		{http.MethodHead, "/static/js/app.js", http.StatusOK, ""},
+		{http.MethodGet, "/static/missing.css", http.StatusNotFound, "404 page not found\n"},
+		{http.MethodGet, "/en/assets/docs/index.md", http.StatusOK, "# docs"},
+		{http.MethodHead, "/en/assets/docs/index.md", http.StatusOK, ""},
+		{http.MethodPost, "/en/assets/docs/index.md", http.StatusMethodNotAllowed, "405 method not allowed\n"},
+		{http.MethodDelete, "/static/site.css", http.StatusMethodNotAllowed, "405 method not allowed\n"},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, nil))
+		if rec.Code != tt.code || rec.Body.String() != tt.body {
+			t.Errorf("%s %s = %d, %q, want %d, %q", tt.method, tt.path, rec.Code, rec.Body.String(), tt.code, tt.body)
+		}
+	}
+
+	for _, pattern := range []string{"/files", "/files/{name}"} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("ServeFiles(%q) did not panic", pattern)
+				}
+			}()
+			mux.ServeFiles(pattern, fsys)
+		}()
+	}
+}
@@ -0,0 +1,261 @@
+package servemux
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PathVarInt returns the path variable of the r for the name parsed as a
+// base-10 int. The ok is false if the variable is not found or cannot be
+// parsed; use the [PathVars] to tell the two cases apart.
+func PathVarInt(r *http.Request, name string) (i int, ok bool) {
+	v, ok := PathVars(r)[name]
+	if !ok {
+		return 0, false
+	}
+	i, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, false
+	}
+	return i, true
+}
+
+// PathVarInt64 is like the [PathVarInt], but for an int64.
+func PathVarInt64(r *http.Request, name string) (i int64, ok bool) {
+	v, ok := PathVars(r)[name]
+	if !ok {
+		return 0, false
+	}
+	i, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return i, true
+}
+
+// PathVarFloat64 returns the path variable of the r for the name parsed as a
+// float64 using the [strconv.ParseFloat], so negative numbers and scientific
+// notation are accepted. The ok is false if the variable is not found or
+// cannot be parsed; use the [PathVars] to tell the two cases apart.
+func PathVarFloat64(r *http.Request, name string) (f float64, ok bool) {
+	v, ok := PathVars(r)[name]
+	if !ok {
+		return 0, false
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return 0, false
+	}
+	return f, true
+}
+
+// PathVarBool returns the path variable of the r for the name parsed as a bool
+// using the [strconv.ParseBool]. The ok is false if the variable is not found
+// or cannot be parsed, so a variable parsed as false results in false, true.
+func PathVarBool(r *http.Request, name string) (b bool, ok bool) {
+	v, ok := PathVars(r)[name]
+	if !ok {
+		return false, false
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, false
+	}
+	return b, true
+}
+
+// PathVarTime returns the path variable of the r for the name parsed as a
+// [time.Time] using the [time.Parse] with the layout, such as "2006-01-02" for
+// dates like "2024-03-15", or the [time.RFC3339] for timestamps like
+// "2024-03-15T10:30:00Z". The ok is false if the variable is not found or
+// cannot be parsed, or if it is parsed as the zero time, so the t is never the
+// zero time when the ok is true.
+func PathVarTime(r *http.Request, name, layout string) (t time.Time, ok bool) {
+	v, ok := PathVars(r)[name]
+	if !ok {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(layout, v)
+	if err != nil || t.IsZero() {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// PathVarType is the constraint of the types that the [PathVar] can parse path
+// variables as.
+type PathVarType interface {
+	~int | ~int8 | ~int16 | ~int32 | ~int64 |
+		~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64 |
+		~float64 | ~bool | ~string
+}
+
+// PathVar returns the path variable of the r for the name parsed as a T, in the
+// same way as the [BindPathVars] parses it for a field of type T. The ok is
+// false if the variable is not found or cannot be parsed, including when it
+// is out of the range of the T.
+func PathVar[T PathVarType](r *http.Request, name string) (t T, ok bool) {
+	v, ok := PathVars(r)[name]
+	if !ok {
+		return t, false
+	}
+	if err := setPathVarField(reflect.ValueOf(&t).Elem(), v); err != nil {
+		var zero T
+		return zero, false
+	}
+	return t, true
+}
+
+// PathVarOr returns the path variable of the r for the name, or the
+// defaultValue if the variable is not found or empty.
+func PathVarOr(r *http.Request, name, defaultValue string) string {
+	if v := PathVars(r)[name]; v != "" {
+		return v
+	}
+	return defaultValue
+}
+
+// PathVarIntOr is like the [PathVarInt], but it returns the defaultValue if
+// the variable is not found or cannot be parsed.
+func PathVarIntOr(r *http.Request, name string, defaultValue int) int {
+	if i, ok := PathVarInt(r, name); ok {
+		return i
+	}
+	return defaultValue
+}
+
+// PathVarUUID returns the path variable of the r for the name parsed as a UUID
+// in the canonical xxxxxxxx-xxxx-xxxx-xxxx-xxxxxxxxxxxx form, where the hex
+// digits may be in either case. The ok is false if the variable is not found
+// or cannot be parsed.
+func PathVarUUID(r *http.Request, name string) (uuid [16]byte, ok bool) {
+	v, ok := PathVars(r)[name]
+	if !ok || len(v) != 36 || v[8] != '-' || v[13] != '-' || v[18] != '-' || v[23] != '-' {
+		return [16]byte{}, false
+	}
+	for j, i := range uuidByteOffsets {
+		hi, ok1 := fromHexChar(v[i])
+		lo, ok2 := fromHexChar(v[i+1])
+		if !ok1 || !ok2 {
+			return [16]byte{}, false
+		}
+		uuid[j] = hi<<4 | lo
+	}
+	return uuid, true
+}
+
+// uuidByteOffsets is the offsets of the bytes in a canonical UUID string.
+var uuidByteOffsets = [16]int{0, 2, 4, 6, 9, 11, 14, 16, 19, 21, 24, 26, 28, 30, 32, 34}
+
+// fromHexChar converts a hex character into its value.
+func fromHexChar(c byte) (byte, bool) {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0', true
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10, true
+	case 'A' <= c && c <= 'F':
+		return c - 'A' + 10, true
+	}
+	return 0, false
+}
+
+// BindPathVars populates the exported fields of the struct pointed to by the
+// dst that have a `pathvar:"name"` tag with the path variables of the r. The
+// supported field types are strings, integers, floats, bools, and [time.Time]s,
+// where a [time.Time] is parsed as an ISO 8601 date or date-time.
+//
+// It returns an error if a path variable is missing or cannot be parsed,
+// unless the tag has the omitempty option, as in `pathvar:"name,omitempty"`,
+// in which case a missing or empty path variable leaves the field untouched.
+func BindPathVars(r *http.Request, dst any) error {
+	rv := reflect.ValueOf(dst)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return errors.New("http.ServeMux: BindPathVars requires a non-nil pointer to a struct")
+	}
+	rv = rv.Elem()
+
+	pathVars := PathVars(r)
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		sf := rt.Field(i)
+		tag, ok := sf.Tag.Lookup("pathvar")
+		if !ok || !sf.IsExported() {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = sf.Name
+		}
+
+		v, ok := pathVars[name]
+		if !ok || v == "" {
+			if opts == "omitempty" {
+				continue
+			}
+			if !ok {
+				return fmt.Errorf("http.ServeMux: missing path variable %q for field %s", name, sf.Name)
+			}
+		}
+
+		if err := setPathVarField(rv.Field(i), v); err != nil {
+			return fmt.Errorf("http.ServeMux: cannot bind path variable %q to field %s: %w", name, sf.Name, err)
+		}
+	}
+	return nil
+}
+
+// timeType is the [reflect.Type] of [time.Time].
+var timeType = reflect.TypeOf(time.Time{})
+
+// setPathVarField sets the v parsed according to the type of the fv to the fv.
+func setPathVarField(fv reflect.Value, v string) error {
+	if fv.Type() == timeType {
+		t, err := time.Parse(time.RFC3339Nano, v)
+		if err != nil {
+			var err2 error
+			if t, err2 = time.Parse(time.DateOnly, v); err2 != nil {
+				return err
+			}
+		}
+		fv.Set(reflect.ValueOf(t))
+		return nil
+	}
+
+	switch fv.Kind() {
+	case reflect.String:
+		fv.SetString(v)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(v, 10, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(v, 10, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(v, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetFloat(f)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return err
+		}
+		fv.SetBool(b)
+	default:
+		return fmt.Errorf("unsupported field type %s", fv.Type())
+	}
+	return nil
+}
@@ -0,0 +1,262 @@
+package servemux
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newPathVarsRequest returns a new request that has been matched against the
+// pattern with the path.
+func newPathVarsRequest(t *testing.T, pattern, path string) *http.Request {
+	t.Helper()
+	mux := NewServeMux()
+	mux.Handle(pattern, stringHandler(pattern))
+	r := ConfigureRequestToStorePathVars(httptest.NewRequest(http.MethodGet, path, nil))
+	if _, got := mux.Handler(r); got != pattern {
+		t.Fatalf("%s: pattern = %q, want %q", path, got, pattern)
+	}
+	return r
+}
+
+func TestPathVars(t *testing.T) {
+	r := newPathVarsRequest(t, "/{a}", "/x")
+	if got := PathVars(r); len(got) != 1 || got["a"] != "x" {
+		t.Errorf("PathVars() = %v, want map[a:x]", got)
+	}
+
+	r = httptest.NewRequest(http.MethodGet, "/", nil)
+	if got := PathVars(r); got == nil || len(got) != 0 {
+		t.Errorf("PathVars() = %#v, want an empty map", got)
+	}
+}
+
+func TestPathVarSlice(t *testing.T) {
+	r := newPathVarsRequest(t, "/{a}/{}/{c...}", "/x/y/z/w")
+	got := PathVarSlice(r)
+	if want := []string{"x", "y", "z/w"}; strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("PathVarSlice() = %q, want %q", got, want)
+	}
+	got[0] = "changed"
+	if PathVarSlice(r)[0] != "x" {
+		t.Error("PathVarSlice() returned a slice shared with the r")
+	}
+
+	if got := PathVarSlice(newPathVarsRequest(t, "/static", "/static")); got != nil {
+		t.Errorf("PathVarSlice() without variables = %q, want nil", got)
+	}
+	if got := PathVarSlice(httptest.NewRequest(http.MethodGet, "/", nil)); got != nil {
+		t.Errorf("PathVarSlice() without matching = %q, want nil", got)
+	}
+}
+
+func TestPathVarInt(t *testing.T) {
+	r := newPathVarsRequest(t, "/{a}/{b}/{c}", "/42/9223372036854775807/x")
+
+	tests := []struct {
+		name string
+		i    int64
+		ok   bool
+	}{
+		{"a", 42, true},
+		{"b", 9223372036854775807, true},
+		{"c", 0, false},
+		{"d", 0, false},
+	}
+	for _, tt := range tests {
+		if i, ok := PathVarInt64(r, tt.name); i != tt.i || ok != tt.ok {
+			t.Errorf("PathVarInt64(%q) = %d, %t, want %d, %t", tt.name, i, ok, tt.i, tt.ok)
+		}
+	}
+	if i, ok := PathVarInt(r, "a"); i != 42 || !ok {
+		t.Errorf("PathVarInt(%q) = %d, %t, want %d, %t", "a", i, ok, 42, true)
+	}
+	if i, ok := PathVarInt(httptest.NewRequest(http.MethodGet, "/", nil), "a"); i != 0 || ok {
+		t.Errorf("PathVarInt(%q) = %d, %t, want %d, %t", "a", i, ok, 0, false)
+	}
+}
+
+func TestPathVarFloat64(t *testing.T) {
+	r := newPathVarsRequest(t, "/{a}/{b}/{c}/{d}", "/-2.5/1.5e3/42/x")
+
+	tests := []struct {
+		name string
+		f    float64
+		ok   bool
+	}{
+		{"a", -2.5, true},
+		{"b", 1500, true},
+		{"c", 42, true},
+		{"d", 0, false},
+		{"e", 0, false},
+	}
+	for _, tt := range tests {
+		if f, ok := PathVarFloat64(r, tt.name); f != tt.f || ok != tt.ok {
+			t.Errorf("PathVarFloat64(%q) = %g, %t, want %g, %t", tt.name, f, ok, tt.f, tt.ok)
+		}
+	}
+}
+
+func TestPathVarBool(t *testing.T) {
+	r := newPathVarsRequest(t, "/{a}/{b}/{c}/{d}/{e}", "/TRUE/f/1/0/yes")
+
+	tests := []struct {
+		name string
+		b    bool
+		ok   bool
+	}{
+		{"a", true, true},
+		{"b", false, true},
+		{"c", true, true},
+		{"d", false, true},
+		{"e", false, false},
+		{"f", false, false},
+	}
+	for _, tt := range tests {
+		if b, ok := PathVarBool(r, tt.name); b != tt.b || ok != tt.ok {
+			t.Errorf("PathVarBool(%q) = %t, %t, want %t, %t", tt.name, b, ok, tt.b, tt.ok)
+		}
+	}
+}
+
+func TestPathVarTime(t *testing.T) {
+	r := newPathVarsRequest(t, "/{a}/{b}/{c}/{d}", "/2024-03-15/2024-03-15T10:30:00Z/2024-13-01/0001-01-01")
+
+	tests := []struct {
+		name   string
+		layout string
+		want   time.Time
+		ok     bool
+	}{
+		{"a", "2006-01-02", time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC), true},
+		{"b", time.RFC3339, time.Date(2024, 3, 15, 10, 30, 0, 0, time.UTC), true},
+		{"a", time.RFC3339, time.Time{}, false},
+		{"c", "2006-01-02", time.Time{}, false},
+		{"d", "2006-01-02", time.Time{}, false},
+		{"e", "2006-01-02", time.Time{}, false},
+	}
+	for _, tt := range tests {
+		if got, ok := PathVarTime(r, tt.name, tt.layout); !got.Equal(tt.want) || ok != tt.ok {
+			t.Errorf("PathVarTime(%q, %q) = %v, %t, want %v, %t", tt.name, tt.layout, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestPathVar(t *testing.T) {
+	r := newPathVarsRequest(t, "/{a}/{b}/{c}/{d}/{e}", "/42/300/-1.5/true/x")
+
+	type userID int64
+	if got, ok := PathVar[userID](r, "a"); got != 42 || !ok {
+		t.Errorf("PathVar[userID](a) = %d, %t, want 42, true", got, ok)
+	}
+	if got, ok := PathVar[uint8](r, "b"); got != 0 || ok {
+		t.Errorf("PathVar[uint8](b) = %d, %t, want 0, false", got, ok)
+	}
+	if got, ok := PathVar[uint16](r, "b"); got != 300 || !ok {
+		t.Errorf("PathVar[uint16](b) = %d, %t, want 300, true", got, ok)
+	}
+	if got, ok := PathVar[float64](r, "c"); got != -1.5 || !ok {
+		t.Errorf("PathVar[float64](c) = %g, %t, want -1.5, true", got, ok)
+	}
+	if got, ok := PathVar[bool](r, "d"); !got || !ok {
+		t.Errorf("PathVar[bool](d) = %t, %t, want true, true", got, ok)
+	}
+	if got, ok := PathVar[string](r, "e"); got != "x" || !ok {
+		t.Errorf("PathVar[string](e) = %q, %t, want %q, true", got, ok, "x")
+	}
+	if got, ok := PathVar[int](r, "e"); got != 0 || ok {
+		t.Errorf("PathVar[int](e) = %d, %t, want 0, false", got, ok)
+	}
+	if got, ok := PathVar[string](r, "f"); got != "" || ok {
+		t.Errorf("PathVar[string](f) = %q, %t, want \"\", false", got, ok)
+	}
+}
+
+func TestPathVarOr(t *testing.T) {
+	r := newPathVarsRequest(t, "/{a}/{b}/{c}", "/7/x/")
+
+	if got, want := PathVarOr(r, "a", "1"), "7"; got != want {
+		t.Errorf("PathVarOr(a) = %q, want %q", got, want)
+	}
+	if got, want := PathVarOr(r, "c", "1"), "1"; got != want {
+		t.Errorf("PathVarOr(c) = %q, want %q", got, want)
+	}
+	if got, want := PathVarOr(r, "d", "1"), "1"; got != want {
+		t.Errorf("PathVarOr(d) = %q, want %q", got, want)
+	}
+	if got, want := PathVarIntOr(r, "a", 1), 7; got != want {
+		t.Errorf("PathVarIntOr(a) = %d, want %d", got, want)
+	}
+	if got, want := PathVarIntOr(r, "b", 1), 1; got != want {
+		t.Errorf("PathVarIntOr(b) = %d, want %d", got, want)
+	}
+	if got, want := PathVarIntOr(r, "d", 1), 1; got != want {
+		t.Errorf("PathVarIntOr(d) = %d, want %d", got, want)
+	}
+
+	r = httptest.NewRequest(http.MethodGet, "/", nil)
+	if got, want := PathVarOr(r, "a", "1"), "1"; got != want {
+		t.Errorf("PathVarOr(a) without path vars = %q, want %q", got, want)
+	}
+	if got, want := PathVarIntOr(r, "a", 1), 1; got != want {
+		t.Errorf("PathVarIntOr(a) without path vars = %d, want %d", got, want)
+	}
+}
+
+func TestPathVarUUID(t *testing.T) {
+	r := newPathVarsRequest(t, "/{a}/{b}/{c}/{d}", "/123e4567-E89B-12d3-a456-426614174000/123e4567e89b12d3a456426614174000/123e4567-e89b-12d3-a456-42661417400g/x")
+
+	want := [16]byte{0x12, 0x3e, 0x45, 0x67, 0xe8, 0x9b, 0x12, 0xd3, 0xa4, 0x56, 0x42, 0x66, 0x14, 0x17, 0x40, 0x00}
+	if got, ok := PathVarUUID(r, "a"); got != want || !ok {
+		t.Errorf("PathVarUUID(a) = %x, %t, want %x, true", got, ok, want)
+	}
+	for _, name := range []string{"b", "c", "d", "e"} {
+		if got, ok := PathVarUUID(r, name); got != [16]byte{} || ok {
+			t.Errorf("PathVarUUID(%q) = %x, %t, want zero, false", name, got, ok)
+		}
+	}
+}
+
+func TestBindPathVars(t *testing.T) {
+	r := newPathVarsRequest(t, "/{name}/{id}/{big}/{ratio}/{ok}/{at}/{day}", "/bob/-42/18446744073709551615/1.5e3/true/2024-01-02T03:04:05Z/2024-01-02")
+
+	var dst struct {
+		Name     string    `pathvar:"name"`
+		ID       int       `pathvar:"id"`
+		Big      uint64    `pathvar:"big"`
+		Ratio    float64   `pathvar:"ratio"`
+		OK       bool      `pathvar:"ok"`
+		At       time.Time `pathvar:"at"`
+		Day      time.Time `pathvar:"day"`
+		Page     int64     `pathvar:"page,omitempty"`
+		Untagged string
+	}
+	dst.Page = 7
+	if err := BindPathVars(r, &dst); err != nil {
+		t.Fatalf("BindPathVars() = %v", err)
+	}
+	if dst.Name != "bob" || dst.ID != -42 || dst.Big != 18446744073709551615 || dst.Ratio != 1500 || !dst.OK ||
+		!dst.At.Equal(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)) ||
+		!dst.Day.Equal(time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)) ||
+		dst.Page != 7 || dst.Untagged != "" {
+		t.Errorf("BindPathVars() = %+v", dst)
+	}
+
+	var missing struct {
+		Page int `pathvar:"page"`
+	}
+	if err := BindPathVars(r, &missing); err == nil || !strings.Contains(err.Error(), `"page"`) {
+		t.Errorf("BindPathVars() with a missing variable = %v", err)
+	}
+	var invalid struct {
+		ID uint8 `pathvar:"id"`
+	}
+	if err := BindPathVars(r, &invalid); err == nil {
+		t.Error("expected an error binding an unparseable variable")
+	}
+	if err := BindPathVars(r, dst); err == nil {
+		t.Error("expected an error binding to a non-pointer")
+	}
+}
@@ -0,0 +1,98 @@
+package servemux
+
+import (
+	"net/http"
+)
+
+// Pattern is a pattern that has been validated by the [ParsePattern], so that
+// it can be registered using the [ServeMux.HandlePattern] without syntax
+// errors. The zero value is not a valid pattern.
+type Pattern struct {
+	s            string
+	method       string
+	host         string
+	path         string
+	pathVarNames []string
+}
+
+// ParsePattern parses the s as a pattern. It returns the same error as the
+// [ValidatePattern] if the s is invalid.
+func ParsePattern(s string) (Pattern, error) {
+	if err := ValidatePattern(s); err != nil {
+		return Pattern{}, err
+	}
+
+	p := Pattern{s: s}
+	p.method, p.host, p.path = splitPattern(s)
+	_, _, _, _, pathVarNames, _ := parsePattern(s)
+	for _, name := range pathVarNames {
+		if name != "" {
+			p.pathVarNames = append(p.pathVarNames, name)
+		}
+	}
+	return p, nil
+}
+
+// MustParsePattern is like the [ParsePattern], but it panics if the s is
+// invalid. It is intended for patterns known at compile time.
+func MustParsePattern(s string) Pattern {
+	p, err := ParsePattern(s)
+	if err != nil {
+		panic(err.Error())
+	}
+	return p
+}
+
+// String returns the p as it was parsed.
+func (p Pattern) String() string {
+	return p.s
+}
+
+// Method returns the method of the p, or "" if the p has none.
+func (p Pattern) Method() string {
+	return p.method
+}
+
+// Host returns the host of the p, or "" if the p has none.
+func (p Pattern) Host() string {
+	return p.host
+}
+
+// Path returns the path of the p, or "" if the p has none.
+func (p Pattern) Path() string {
+	return p.path
+}
+
+// PathVarNames returns the names of the named variable path elements of the p
+// in the order they appear.
+func (p Pattern) PathVarNames() []string {
+	return append([]string(nil), p.pathVarNames...)
+}
+
+// PathVarNamesFor returns the names of the named variable path elements of the
+// pattern in the order they appear, without registering the pattern with any
+// [ServeMux], for code generators that build accessors for them. If the
+// pattern is invalid, it returns the same error as the [ValidatePattern],
+// which states the position of the first offending part of the pattern.
+func PathVarNamesFor(pattern string) ([]string, error) {
+	p, err := ParsePattern(pattern)
+	if err != nil {
+		return nil, err
+	}
+	return p.pathVarNames, nil
+}
+
+// HandlePattern is like the [ServeMux.Handle], but it takes a [Pattern], whose
+// syntax is already known to be valid.
+func (mux *ServeMux) HandlePattern(pattern Pattern, handler http.Handler) {
+	mux.Handle(pattern.s, handler)
+}
+
+// HandlePatternFunc is like the [ServeMux.HandleFunc], but it takes a
+// [Pattern], whose syntax is already known to be valid.
+func (mux *ServeMux) HandlePatternFunc(pattern Pattern, handler func(http.ResponseWriter, *http.Request)) {
+	if handler == nil {
+		panic("http.ServeMux: nil handler")
+	}
+	mux.HandlePattern(pattern, http.HandlerFunc(handler))
+}
@@ -0,0 +1,105 @@
+package servemux
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParsePattern(t *testing.T) {
+	tests := []struct {
+		s            string
+		method       string
+		host         string
+		path         string
+		pathVarNames []string
+	}{
+		{"/", "", "", "/", nil},
+		{"GET /users/{id}", "GET", "", "/users/{id}", []string{"id"}},
+		{"{tenant}.example.com/files/{}/{path...}", "", "{tenant}.example.com", "/files/{}/{path...}", []string{"path"}},
+		{"POST example.com", "POST", "example.com", "", nil},
+	}
+	for _, tt := range tests {
+		p, err := ParsePattern(tt.s)
+		if err != nil {
+			t.Errorf("ParsePattern(%q) = %v", tt.s, err)
+			continue
+		}
+		if p.String() != tt.s ||
+			p.Method() != tt.method ||
+			p.Host() != tt.host ||
+			p.Path() != tt.path ||
+			fmt.Sprint(p.PathVarNames()) != fmt.Sprint(tt.pathVarNames) {
+			t.Errorf("ParsePattern(%q) = %q, %q, %q, %q, %q", tt.s, p, p.Method(), p.Host(), p.Path(), p.PathVarNames())
+		}
+	}
+
+	for _, s := range []string{"", "GE-T /", "/{bar"} {
+		if _, err := ParsePattern(s); err == nil {
+			t.Errorf("ParsePattern(%q) succeeded", s)
+		}
+	}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("MustParsePattern() did not panic")
+			}
+		}()
+		MustParsePattern("/{bar")
+	}()
+}
+
+func TestPathVarNamesFor(t *testing.T) {
+	tests := []struct {
+		pattern string
+		want    []string
+		err     string
+	}{
+		{"/", nil, ""},
+		{"GET /users/{id}/posts/{postID:[0-9]+}", []string{"id", "postID"}, ""},
+		{"{tenant}.example.com/files/{}/{path...}", []string{"path"}, ""},
+		{"/archive/{date?}", []string{"date"}, ""},
+		{"/users/{id}/{1bad}", nil, `at position 12 in pattern "/users/{id}/{1bad}": "{1bad}"`},
+	}
+	for _, tt := range tests {
+		got, err := PathVarNamesFor(tt.pattern)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("PathVarNamesFor(%q) error = %v, want containing %q", tt.pattern, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("PathVarNamesFor(%q) = %q, %v, want %q", tt.pattern, got, err, tt.want)
+		}
+	}
+}
+
+func TestServeMuxHandlePattern(t *testing.T) {
+	setParallel(t)
+
+	mux := NewServeMux()
+	mux.HandlePattern(MustParsePattern("GET /users/{id}"), stringHandler("user"))
+	mux.HandlePatternFunc(MustParsePattern("/posts/{id}"), func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Result", "post "+PathVars(r)["id"])
+	})
+
+	for url, want := range map[string]string{"/users/1": "user", "/posts/2": "post 2"} {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, url, nil))
+		if got := rec.Header().Get("Result"); got != want {
+			t.Errorf("%s = %q, want %q", url, got, want)
+		}
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("HandlePattern() with the zero Pattern did not panic")
+		}
+	}()
+	mux.HandlePattern(Pattern{}, stringHandler("zero"))
+}
@@ -0,0 +1,143 @@
+package servemux
+
+import (
+	"errors"
+	"net/http"
+)
+
+// errPrecompiled is the error returned when modifying a precompiled
+// [ServeMux].
+var errPrecompiled = errors.New("http.ServeMux: cannot modify a precompiled mux")
+
+// Precompile optimizes the routing trees of the mux for matching and seals
+// it, so that requests are matched without locking. It returns an error if
+// the mux has already been precompiled.
+//
+// After Precompile, the mux is read-only: [ServeMux.Handle] and the other
+// registration methods panic, and [ServeMux.HandleE] and
+// [ServeMux.Deregister] return an error. Use the [ServeMux.Clone] to get a
+// modifiable copy.
+func (mux *ServeMux) Precompile() error {
+	mux.mu.Lock()
+	defer mux.mu.Unlock()
+	if mux.sealed.Load() {
+		return errPrecompiled
+	}
+
+	if mux.tree != nil {
+		mux.tree.precompile()
+	}
+	for _, tree := range mux.hostTrees {
+		tree.precompile()
+	}
+	for _, vht := range mux.varHostTrees {
+		vht.tree.precompile()
+	}
+	if mux.grpcWeb != nil && !mux.grpcWeb.sealed.Load() {
+		if err := mux.grpcWeb.Precompile(); err != nil {
+			return err
+		}
+	}
+
+	mux.sealed.Store(true)
+	return nil
+}
+
+// precompile compacts the subtree rooted at the mn and computes the
+// methodBits of its nodes.
+func (mn *serveMuxNode) precompile() {
+	// Merge chains of nonvar nodes that carry nothing but a single nonvar
+	// child. Root nodes are kept as is since their prefixes may be empty.
+	for mn.parent != nil && mn.typ == nonvarServeMuxNode && !mn.hasAtLeastOneHandler {
+		c := mn.onlyChild()
+		if c == nil || c.typ != nonvarServeMuxNode {
+			break
+		}
+		mn.prefix += c.prefix
+		mn.nonvarChildren = c.nonvarChildren
+		mn.constrainedVarChildren = c.constrainedVarChildren
+		mn.unmodifiedVarChild = c.unmodifiedVarChild
+		mn.ellipsisModifiedVarChild = c.ellipsisModifiedVarChild
+		mn.hasAtLeastOneChild = c.hasAtLeastOneChild
+		mn.handlerTuples = c.handlerTuples
+		mn.catchAllHandlerTuple = c.catchAllHandlerTuple
+		mn.hasAtLeastOneHandler = c.hasAtLeastOneHandler
+		for _, n := range mn.children() {
+			n.parent = mn
+		}
+	}
+
+	mn.methodBits = 0
+	for _, p := range mn.handlerTuples {
+		mn.methodBits |= methodBit(p.method)
+	}
+	if mn.methodBits != 0 {
+		// Mark the bitset as known even if only nonstandard methods are
+		// registered.
+		mn.methodBits |= 1 << 15
+	}
+
+	for _, n := range mn.children() {
+		n.precompile()
+	}
+}
+
+// onlyChild returns the only child node of the mn. It returns nil if the mn
+// has no or more than one child node.
+func (mn *serveMuxNode) onlyChild() *serveMuxNode {
+	var only *serveMuxNode
+	for _, n := range mn.children() {
+		if only != nil {
+			return nil
+		}
+		only = n
+	}
+	return only
+}
+
+// children returns the child nodes of the mn in matching order.
+func (mn *serveMuxNode) children() []*serveMuxNode {
+	if !mn.hasAtLeastOneChild {
+		return nil
+	}
+	var ns []*serveMuxNode
+	for _, n := range mn.nonvarChildren {
+		if n != nil {
+			ns = append(ns, n)
+		}
+	}
+	ns = append(ns, mn.constrainedVarChildren...)
+	if mn.unmodifiedVarChild != nil {
+		ns = append(ns, mn.unmodifiedVarChild)
+	}
+	if mn.ellipsisModifiedVarChild != nil {
+		ns = append(ns, mn.ellipsisModifiedVarChild)
+	}
+	return ns
+}
+
+// methodBit returns the bit of the method in the methodBits of a
+// [serveMuxNode]. It returns zero if the method is not a standard one.
+func methodBit(method string) uint16 {
+	switch method {
+	case http.MethodGet:
+		return 1 << 0
+	case http.MethodHead:
+		return 1 << 1
+	case http.MethodPost:
+		return 1 << 2
+	case http.MethodPut:
+		return 1 << 3
+	case http.MethodPatch:
+		return 1 << 4
+	case http.MethodDelete:
+		return 1 << 5
+	case http.MethodConnect:
+		return 1 << 6
+	case http.MethodOptions:
+		return 1 << 7
+	case http.MethodTrace:
+		return 1 << 8
+	}
+	return 0
+}
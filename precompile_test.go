@@ -0,0 +1,144 @@
+package servemux
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestServeMuxPrecompile(t *testing.T) {
+	setParallel(t)
+
+	mux := NewServeMux()
+	mux.Handle("GET /api/v1/users/{id}", stringHandler("GET /api/v1/users/{id}"))
+	mux.Handle("GET /api/v1/users/{id:[0-9]+}/posts", stringHandler("GET /api/v1/users/{id:[0-9]+}/posts"))
+	mux.Handle("/api/v1/users/{id}/posts", stringHandler("/api/v1/users/{id}/posts"))
+	mux.Handle("PROPFIND /api/v1/files/{path...}", stringHandler("PROPFIND /api/v1/files/{path...}"))
+	mux.Handle("/api/v1/status/healthz", stringHandler("/api/v1/status/healthz"))
+	mux.Handle("/api/v1/status/readyz", stringHandler("/api/v1/status/readyz"))
+	mux.Handle("example.net/", stringHandler("example.net/"))
+	mux.Handle("{sub}.example.org/{$}", stringHandler("{sub}.example.org/{$}"))
+	if err := mux.Deregister("/api/v1/status/readyz"); err != nil {
+		t.Fatalf("Deregister() = %v", err)
+	}
+
+	if err := mux.Precompile(); err != nil {
+		t.Fatalf("Precompile() = %v", err)
+	}
+	if err := mux.Precompile(); err == nil || err.Error() != "http.ServeMux: cannot modify a precompiled mux" {
+		t.Errorf("second Precompile() = %v", err)
+	}
+
+	tests := []struct {
+		method string
+		url    string
+		code   int
+		want   string
+	}{
+		{http.MethodGet, "/api/v1/users/foo", http.StatusOK, "GET /api/v1/users/{id}"},
+		{http.MethodHead, "/api/v1/users/foo", http.StatusOK, "GET /api/v1/users/{id}"},
+		{http.MethodPost, "/api/v1/users/foo", http.StatusMethodNotAllowed, ""},
+		{http.MethodGet, "/api/v1/users/1/posts", http.StatusOK, "GET /api/v1/users/{id:[0-9]+}/posts"},
+		{http.MethodPost, "/api/v1/users/1/posts", http.StatusOK, "/api/v1/users/{id}/posts"},
+		{http.MethodGet, "/api/v1/users/foo/posts", http.StatusOK, "/api/v1/users/{id}/posts"},
+		{"PROPFIND", "/api/v1/files/a/b", http.StatusOK, "PROPFIND /api/v1/files/{path...}"},
+		{http.MethodGet, "/api/v1/files/a/b", http.StatusMethodNotAllowed, ""},
+		{http.MethodGet, "/api/v1/status/healthz", http.StatusOK, "/api/v1/status/healthz"},
+		{http.MethodGet, "/api/v1/status/readyz", http.StatusNotFound, ""},
+		{http.MethodGet, "http://example.net/anything", http.StatusOK, "example.net/"},
+		{http.MethodGet, "http://foo.example.org/", http.StatusOK, "{sub}.example.org/{$}"},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.url, nil))
+		if rec.Code != tt.code {
+			t.Errorf("%s %s: code = %d, want %d", tt.method, tt.url, rec.Code, tt.code)
+		}
+		if got := rec.Header().Get("Result"); got != tt.want {
+			t.Errorf("%s %s: result = %q, want %q", tt.method, tt.url, got, tt.want)
+		}
+	}
+
+	if err := mux.HandleE("/new", stringHandler("new")); err == nil {
+		t.Error("HandleE() after Precompile() succeeded")
+	}
+	if err := mux.Deregister("/api/v1/status/healthz"); err == nil {
+		t.Error("Deregister() after Precompile() succeeded")
+	}
+	for name, f := range map[string]func(){
+		"Handle":                     func() { mux.Handle("/new", stringHandler("new")) },
+		"Use":                        func() { mux.Use(func(h http.Handler) http.Handler { return h }) },
+		"SetNotFoundHandler":         func() { mux.SetNotFoundHandler(stringHandler("not found")) },
+		"SetMethodNotAllowedHandler": func() { mux.SetMethodNotAllowedHandler(stringHandler("not allowed")) },
+		"HandleGRPCWeb":              func() { mux.HandleGRPCWeb("/grpc", stringHandler("grpc")) },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s() after Precompile() did not panic", name)
+				}
+			}()
+			f()
+		}()
+	}
+
+	clone := mux.Clone()
+	if err := clone.HandleE("/new", stringHandler("new")); err != nil {
+		t.Errorf("HandleE() on clone of precompiled mux = %v", err)
+	}
+}
+
+func TestServeMuxPrecompileConcurrentServe(t *testing.T) {
+	setParallel(t)
+
+	mux := NewServeMux()
+	mux.Handle("GET /users/{id}", stringHandler("user"))
+	mux.Handle("/files/{path...}", stringHandler("file"))
+	if err := mux.Precompile(); err != nil {
+		t.Fatalf("Precompile() = %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				for url, want := range map[string]string{"/users/1": "user", "/files/a/b": "file"} {
+					rec := httptest.NewRecorder()
+					mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, url, nil))
+					if got := rec.Header().Get("Result"); got != want {
+						t.Errorf("GET %s = %q, want %q", url, got, want)
+						return
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func BenchmarkServeMuxPrecompiled(b *testing.B) {
+	for _, precompiled := range []bool{false, true} {
+		name := "Locked"
+		if precompiled {
+			name = "Precompiled"
+		}
+		b.Run(name, func(b *testing.B) {
+			mux := NewServeMux()
+			mux.Handle("GET /api/v1/users/{id}/posts/{post}", http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+			mux.Handle("/api/v1/status/healthz", http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+			if precompiled {
+				mux.Precompile()
+			}
+			r := httptest.NewRequest(http.MethodGet, "/api/v1/users/1/posts/2", nil)
+			b.ReportAllocs()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					mux.Handler(r)
+				}
+			})
+		})
+	}
+}
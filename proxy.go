@@ -0,0 +1,101 @@
+package servemux
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ProxyOption is an option of the [ServeMux.ReverseProxy].
+type ProxyOption func(opts *proxyOptions)
+
+// proxyOptions are the options of the [ServeMux.ReverseProxy].
+type proxyOptions struct {
+	timeout        time.Duration
+	transport      http.RoundTripper
+	modifyResponse func(*http.Response) error
+	errorHandler   func(http.ResponseWriter, *http.Request, error)
+}
+
+// WithProxyTimeout returns a [ProxyOption] that limits each proxied request to
+// the d, after which it is canceled and responded as an error. A d of zero
+// means no limit.
+func WithProxyTimeout(d time.Duration) ProxyOption {
+	return func(opts *proxyOptions) { opts.timeout = d }
+}
+
+// WithProxyTransport returns a [ProxyOption] that sets the transport used to
+// make the proxied requests, see the [httputil.ReverseProxy.Transport].
+func WithProxyTransport(t http.RoundTripper) ProxyOption {
+	return func(opts *proxyOptions) { opts.transport = t }
+}
+
+// WithModifyResponse returns a [ProxyOption] that sets the fn to modify the
+// responses of the target, see the [httputil.ReverseProxy.ModifyResponse].
+func WithModifyResponse(fn func(*http.Response) error) ProxyOption {
+	return func(opts *proxyOptions) { opts.modifyResponse = fn }
+}
+
+// WithProxyErrorHandler returns a [ProxyOption] that sets the fn to handle
+// errors of reaching the target or of the fn of the [WithModifyResponse], see
+// the [httputil.ReverseProxy.ErrorHandler].
+func WithProxyErrorHandler(fn func(w http.ResponseWriter, r *http.Request, err error)) ProxyOption {
+	return func(opts *proxyOptions) { opts.errorHandler = fn }
+}
+
+// ReverseProxy registers an [httputil.ReverseProxy] for the pattern that
+// forwards requests to the target, with the fixed path elements of the pattern
+// stripped from the request path and the rest joined to the path of the
+// target. The fixed path elements are all but the trailing "/" or
+// "/{[name]...}" of the pattern. E.g., with the pattern "/api/" and the target
+// "http://backend/v1", the request path "/api/users" is forwarded as
+// "http://backend/v1/users". The Host header of the forwarded requests is set
+// to the host of the target.
+//
+// The pattern is registered as if by the [ServeMux.HandleE], whose error is
+// returned.
+func (mux *ServeMux) ReverseProxy(pattern string, target *url.URL, opts ...ProxyOption) error {
+	if target == nil {
+		return errors.New("http.ServeMux: nil reverse proxy target")
+	}
+	var po proxyOptions
+	for _, opt := range opts {
+		opt(&po)
+	}
+
+	_, _, path := splitPattern(pattern)
+	dir := path
+	if i := strings.LastIndexByte(path, '/'); i >= 0 {
+		if elem := path[i+1:]; strings.HasPrefix(elem, "{") && strings.HasSuffix(elem, "...}") {
+			dir = path[:i+1]
+		}
+	}
+	n := strings.Count(strings.TrimRight(dir, "/"), "/")
+
+	rp := httputil.NewSingleHostReverseProxy(target)
+	director := rp.Director
+	rp.Director = func(r *http.Request) {
+		r.URL.Path = stripPathElems(r.URL.Path, n)
+		r.URL.RawPath = ""
+		director(r)
+		r.Host = target.Host
+	}
+	rp.Transport = po.transport
+	rp.ModifyResponse = po.modifyResponse
+	rp.ErrorHandler = po.errorHandler
+
+	var h http.Handler = rp
+	if timeout := po.timeout; timeout > 0 {
+		h = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, cancel := context.WithTimeout(r.Context(), timeout)
+			defer cancel()
+			rp.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+
+	return mux.HandleE(pattern, h)
+}
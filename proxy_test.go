@@ -0,0 +1,75 @@
+package servemux
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestServeMuxReverseProxy(t *testing.T) {
+	setParallel(t)
+
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/slow" {
+			<-r.Context().Done()
+			return
+		}
+		w.Header().Set("Backend-Path", r.URL.RequestURI())
+		w.Header().Set("Backend-Host", r.Host)
+	}))
+	defer backend.Close()
+	target, _ := url.Parse(backend.URL + "/v1")
+
+	mux := NewServeMux()
+	if err := mux.ReverseProxy("/api/", target,
+		WithProxyTimeout(50*time.Millisecond),
+		WithModifyResponse(func(res *http.Response) error {
+			res.Header.Set("Modified", "true")
+			return nil
+		}),
+		WithProxyErrorHandler(func(w http.ResponseWriter, r *http.Request, err error) {
+			w.WriteHeader(http.StatusGatewayTimeout)
+		}),
+	); err != nil {
+		t.Fatal(err)
+	}
+	if err := mux.ReverseProxy("GET /files/{path...}", target, WithProxyTransport(http.DefaultTransport)); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		path     string
+		code     int
+		want     string
+		modified string
+	}{
+		{"/api/users?q=1", http.StatusOK, "/v1/users?q=1", "true"},
+		{"/api/", http.StatusOK, "/v1/", "true"},
+		{"/files/a/b.txt", http.StatusOK, "/v1/a/b.txt", ""},
+		{"/api/slow", http.StatusGatewayTimeout, "", ""},
+	} {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if got := rec.Header().Get("Backend-Path"); rec.Code != tt.code || got != tt.want {
+			t.Errorf("%s = %d %q, want %d %q", tt.path, rec.Code, got, tt.code, tt.want)
+		}
+		if got := rec.Header().Get("Modified"); got != tt.modified {
+			t.Errorf("%s: Modified = %q, want %q", tt.path, got, tt.modified)
+		}
+		if tt.code == http.StatusOK && rec.Header().Get("Backend-Host") != target.Host {
+			t.Errorf("%s: Backend-Host = %q, want %q", tt.path, rec.Header().Get("Backend-Host"), target.Host)
+		}
+	}
+
+	if err := mux.ReverseProxy("/api/", target); err == nil {
+		t.Error("expected a conflicting pattern to fail")
+	}
+	if err := mux.ReverseProxy("/other/{bad", target); err == nil {
+		t.Error("expected an invalid pattern to fail")
+	}
+	if err := mux.ReverseProxy("/nil/", nil); err == nil {
+		t.Error("expected a nil target to fail")
+	}
+}
@@ -0,0 +1,34 @@
+package servemux
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// HandleHTTPSRedirect returns a new [ServeMux] that redirects all requests to
+// "https://" + httpsAddr + the request URI with status 301 (Moved
+// Permanently), which is typically served on port 80 alongside the HTTPS
+// server. If the httpsAddr is empty, the request host without its port is
+// used. Requests that were already made over HTTPS, including those with the
+// "X-Forwarded-Proto: https" header, are responded with status 404 (Not
+// Found) instead of being redirected.
+func HandleHTTPSRedirect(httpsAddr string) *ServeMux {
+	mux := NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS != nil || strings.EqualFold(r.Header.Get("X-Forwarded-Proto"), "https") {
+			http.NotFound(w, r)
+			return
+		}
+
+		addr := httpsAddr
+		if addr == "" {
+			addr = r.Host
+			if host, _, err := net.SplitHostPort(addr); err == nil {
+				addr = host
+			}
+		}
+		http.Redirect(w, r, "https://"+addr+r.URL.RequestURI(), http.StatusMovedPermanently)
+	})
+	return mux
+}
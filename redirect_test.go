@@ -0,0 +1,40 @@
+package servemux
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHandleHTTPSRedirect(t *testing.T) {
+	tests := []struct {
+		httpsAddr string
+		url       string
+		tls       bool
+		proto     string
+		code      int
+		location  string
+	}{
+		{"example.com:8443", "http://example.com/a/b?c=d", false, "", http.StatusMovedPermanently, "https://example.com:8443/a/b?c=d"},
+		{"", "http://example.com:8080/a", false, "", http.StatusMovedPermanently, "https://example.com/a"},
+		{"example.com", "http://example.com/a", true, "", http.StatusNotFound, ""},
+		{"example.com", "http://example.com/a", false, "HTTPS", http.StatusNotFound, ""},
+		{"example.com", "http://example.com/a", false, "http", http.StatusMovedPermanently, "https://example.com/a"},
+	}
+	for _, tt := range tests {
+		mux := HandleHTTPSRedirect(tt.httpsAddr)
+		r := httptest.NewRequest(http.MethodGet, tt.url, nil)
+		if tt.tls {
+			r.TLS = &tls.ConnectionState{}
+		}
+		if tt.proto != "" {
+			r.Header.Set("X-Forwarded-Proto", tt.proto)
+		}
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, r)
+		if got := rec.Header().Get("Location"); rec.Code != tt.code || got != tt.location {
+			t.Errorf("%s = %d %q, want %d %q", tt.url, rec.Code, got, tt.code, tt.location)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package servemux
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// HandleNamed is like the [ServeMux.Handle], but it also associates the name
+// with the pattern, so that URLs for the pattern can be generated using the
+// [ServeMux.Reverse]. If the name is already in use, HandleNamed panics.
+func (mux *ServeMux) HandleNamed(name, pattern string, handler http.Handler) {
+	mux.mu.Lock()
+	defer mux.mu.Unlock()
+	if registeredPattern, ok := mux.namedPatterns[name]; ok {
+		panic(fmt.Sprintf("http.ServeMux: name %q for pattern %q is already used by %q", name, pattern, registeredPattern))
+	}
+	if err := mux.handle(pattern, handler, handleOptions{}); err != nil {
+		panic(err.Error())
+	}
+	if mux.namedPatterns == nil {
+		mux.namedPatterns = map[string]string{}
+	}
+	mux.namedPatterns[name] = pattern
+}
+
+// Reverse returns the URL path of the pattern registered with the name by the
+// [ServeMux.HandleNamed], with its variable path elements substituted by the
+// vars, and the query appended. Each value is escaped using the
+// [url.PathEscape], except that the "/" in the values of ...-modified
+// variables is kept. The host of the pattern is not included.
+//
+// It returns an error if the name is unknown, if any value required by the
+// pattern is missing from the vars, or if any value does not satisfy the
+// constraint of its variable.
+func (mux *ServeMux) Reverse(name string, vars map[string]string, query url.Values) (string, error) {
+	mux.mu.RLock()
+	pattern, ok := mux.namedPatterns[name]
+	mux.mu.RUnlock()
+	if !ok {
+		return "", fmt.Errorf("http.ServeMux: no pattern is named %q", name)
+	}
+	return buildURL(pattern, vars, query)
+}
+
+// BuildURL returns the URL path of the pattern, with its variable path elements
+// substituted by the vars, and the query appended, just like the
+// [ServeMux.Reverse] does for named patterns. Unlike the [ServeMux.Reverse], it
+// also returns an error if the pattern is invalid, or if the vars contain a
+// name that is not a path variable of the pattern.
+func BuildURL(pattern string, vars map[string]string, query url.Values) (string, error) {
+	p, err := ParsePattern(pattern)
+	if err != nil {
+		return "", err
+	}
+
+	names := make([]string, 0, len(vars))
+	for name := range vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+NameLoop:
+	for _, name := range names {
+		for _, pvn := range p.pathVarNames {
+			if pvn == name {
+				continue NameLoop
+			}
+		}
+		return "", fmt.Errorf("http.ServeMux: pattern %q has no path variable %q", pattern, name)
+	}
+
+	return buildURL(pattern, vars, query)
+}
+
+// buildURL builds a URL path and query for the pattern. See the
+// [ServeMux.Reverse].
+func buildURL(pattern string, vars map[string]string, query url.Values) (string, error) {
+	_, _, path := splitPattern(pattern)
+	if path == "" {
+		path = "/"
+	}
+
+	var (
+		b         strings.Builder
+		err       error
+		dollarEnd bool
+	)
+	walkPath(path, func(recentlyPassedSlashes, elem string, _ int) bool {
+		if elem[0] != '{' {
+			b.WriteString(recentlyPassedSlashes)
+			b.WriteString(elem)
+			return true
+		}
+
+		varName, varModifier, varConstraint := elem[1:len(elem)-1], "", ""
+		if i := strings.IndexByte(varName, ':'); i >= 0 {
+			varName, varConstraint = varName[:i], varName[i+1:]
+		}
+		if i := strings.IndexAny(varName, ".$?"); i >= 0 {
+			varName, varModifier = varName[:i], varName[i:]
+		}
+		if varModifier == "?" && vars[varName] == "" {
+			return false // Build the shorter path for an empty ?-modified variable
+		}
+		b.WriteString(recentlyPassedSlashes)
+		if varModifier == "$" {
+			dollarEnd = true
+			return false
+		}
+		if varName == "" {
+			err = fmt.Errorf("http.ServeMux: pattern %q has an unnamed variable path element, which cannot be substituted", pattern)
+			return false
+		}
+
+		value, ok := vars[varName]
+		if !ok {
+			err = fmt.Errorf("http.ServeMux: missing value for path variable %q of pattern %q", varName, pattern)
+			return false
+		}
+		if varConstraint != "" && !compileConstraint(varConstraint).MatchString(value) {
+			err = fmt.Errorf("http.ServeMux: value %q for path variable %q of pattern %q does not satisfy its constraint %q", value, varName, pattern, varConstraint)
+			return false
+		}
+		if varModifier == "..." {
+			segments := strings.Split(value, "/")
+			for i, segment := range segments {
+				segments[i] = url.PathEscape(segment)
+			}
+			b.WriteString(strings.Join(segments, "/"))
+		} else {
+			b.WriteString(url.PathEscape(value))
+		}
+
+		return true
+	})
+	if err != nil {
+		return "", err
+	}
+	if !dollarEnd {
+		b.WriteString(path[len(strings.TrimRight(path, "/")):])
+	}
+
+	u := b.String()
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	return u, nil
+}
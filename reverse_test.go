@@ -0,0 +1,87 @@
+package servemux
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestServeMuxReverse(t *testing.T) {
+	setParallel(t)
+
+	mux := NewServeMux()
+	mux.HandleNamed("users.show", "GET /users/{id}", stringHandler("users.show"))
+	mux.HandleNamed("files", "example.com/files/{path...}", stringHandler("files"))
+	mux.HandleNamed("root", "/{$}", stringHandler("root"))
+	mux.HandleNamed("subtree", "/subtree/", stringHandler("subtree"))
+	mux.HandleNamed("unnamed", "/things/{}", stringHandler("unnamed"))
+	mux.HandleNamed("orders.show", "/orders/{id:[0-9]+}", stringHandler("orders.show"))
+	mux.Handle("GET /users/{id}/posts", stringHandler("unnamed route"))
+
+	tests := []struct {
+		name  string
+		vars  map[string]string
+		query url.Values
+		want  string
+		ok    bool
+	}{
+		{"users.show", map[string]string{"id": "42"}, nil, "/users/42", true},
+		{"users.show", map[string]string{"id": "a b/c"}, url.Values{"q": {"x y"}}, "/users/a%20b%2Fc?q=x+y", true},
+		{"files", map[string]string{"path": "a b/c.txt"}, nil, "/files/a%20b/c.txt", true},
+		{"root", nil, nil, "/", true},
+		{"subtree", nil, nil, "/subtree/", true},
+		{"orders.show", map[string]string{"id": "7"}, nil, "/orders/7", true},
+		{"orders.show", map[string]string{"id": "x"}, nil, "", false},
+		{"users.show", nil, nil, "", false},
+		{"unnamed", nil, nil, "", false},
+		{"missing", nil, nil, "", false},
+	}
+	for _, tt := range tests {
+		got, err := mux.Reverse(tt.name, tt.vars, tt.query)
+		if (err == nil) != tt.ok {
+			t.Errorf("Reverse(%q) error = %v, want ok = %t", tt.name, err, tt.ok)
+		}
+		if got != tt.want {
+			t.Errorf("Reverse(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("expected reusing a name to panic")
+		}
+	}()
+	mux.HandleNamed("users.show", "GET /people/{id}", stringHandler("users.show"))
+}
+
+func TestBuildURL(t *testing.T) {
+	tests := []struct {
+		pattern string
+		vars    map[string]string
+		query   url.Values
+		want    string
+		ok      bool
+	}{
+		{"GET /users/{id}", map[string]string{"id": "a b/c"}, url.Values{"q": {"x y"}}, "/users/a%20b%2Fc?q=x+y", true},
+		{"example.com/files/{path...}", map[string]string{"path": "a/b.txt"}, nil, "/files/a/b.txt", true},
+		{"/orders/{id:[0-9]+}", map[string]string{"id": "7"}, nil, "/orders/7", true},
+		{"/{$}", nil, nil, "/", true},
+		{"/users/{id?}", map[string]string{"id": "42"}, nil, "/users/42", true},
+		{"/users/{id?}", nil, nil, "/users", true},
+		{"/pages/{n:[0-9]?}/x", map[string]string{"n": ""}, nil, "/pages//x", true},
+		{"/pages/{n:[0-9]?}/x", map[string]string{"n": "3"}, nil, "/pages/3/x", true},
+		{"/pages/{n:[0-9]?}/x", nil, nil, "", false},
+		{"/users/{id}", nil, nil, "", false},
+		{"/users/{id}", map[string]string{"id": "1", "extra": "2"}, nil, "", false},
+		{"/orders/{id:[0-9]+}", map[string]string{"id": "x"}, nil, "", false},
+		{"/users/{id", map[string]string{"id": "1"}, nil, "", false},
+	}
+	for _, tt := range tests {
+		got, err := BuildURL(tt.pattern, tt.vars, tt.query)
+		if (err == nil) != tt.ok {
+			t.Errorf("BuildURL(%q) error = %v, want ok = %t", tt.pattern, err, tt.ok)
+		}
+		if got != tt.want {
+			t.Errorf("BuildURL(%q) = %q, want %q", tt.pattern, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,27 @@
+package servemux
+
+import (
+	"io"
+	"net/http"
+)
+
+// HandleRobotsTxt registers "GET /robots.txt" to serve a robots.txt that
+// disallows all robots from crawling if the disallowAll is true, or allows
+// them to crawl everything otherwise. If "GET /robots.txt" is already
+// registered, HandleRobotsTxt panics.
+func (mux *ServeMux) HandleRobotsTxt(disallowAll bool) {
+	if disallowAll {
+		mux.HandleRobotsTxtContent("User-agent: *\nDisallow: /")
+	} else {
+		mux.HandleRobotsTxtContent("User-agent: *\nAllow: /")
+	}
+}
+
+// HandleRobotsTxtContent is like the [ServeMux.HandleRobotsTxt], but it serves
+// the content as the robots.txt.
+func (mux *ServeMux) HandleRobotsTxtContent(content string) {
+	mux.HandleFunc("GET /robots.txt", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		io.WriteString(w, content)
+	})
+}
@@ -0,0 +1,42 @@
+package servemux
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestServeMuxHandleRobotsTxt(t *testing.T) {
+	setParallel(t)
+
+	tests := []struct {
+		register func(mux *ServeMux)
+		want     string
+	}{
+		{func(mux *ServeMux) { mux.HandleRobotsTxt(true) }, "User-agent: *\nDisallow: /"},
+		{func(mux *ServeMux) { mux.HandleRobotsTxt(false) }, "User-agent: *\nAllow: /"},
+		{func(mux *ServeMux) { mux.HandleRobotsTxtContent("User-agent: *\nDisallow: /private/\n") }, "User-agent: *\nDisallow: /private/\n"},
+	}
+	for _, tt := range tests {
+		mux := NewServeMux()
+		tt.register(mux)
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/robots.txt", nil))
+		if rec.Code != http.StatusOK || rec.Body.String() != tt.want {
+			t.Errorf("GET /robots.txt = %d %q, want %d %q", rec.Code, rec.Body.String(), http.StatusOK, tt.want)
+		}
+		if got, want := rec.Header().Get("Content-Type"), "text/plain; charset=utf-8"; got != want {
+			t.Errorf("Content-Type = %q, want %q", got, want)
+		}
+	}
+
+	mux := NewServeMux()
+	mux.Handle("GET /robots.txt", stringHandler("robots"))
+	defer func() {
+		want := `http.ServeMux: pattern "GET /robots.txt" conflicts with "GET /robots.txt"`
+		if got := recover(); got != want {
+			t.Errorf("recover() = %v, want %q", got, want)
+		}
+	}()
+	mux.HandleRobotsTxt(true)
+}
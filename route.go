@@ -0,0 +1,105 @@
+package servemux
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// Middleware wraps an [http.Handler] with additional behavior.
+type Middleware func(http.Handler) http.Handler
+
+// Route is a registration of a pattern with a [ServeMux], as returned by the
+// [ServeMux.Handle] and the [ServeMux.HandleFunc]. Its methods amend the
+// registration under the write lock of the mux and return the Route itself,
+// so that they can be chained:
+//
+//	mux.Handle("GET /api/users", h).Use(auth, ratelimit).Name("users.list").Meta("tier", "premium")
+//
+// They panic if the pattern is no longer registered or if the mux has been
+// precompiled.
+type Route struct {
+	mux     *ServeMux
+	pattern string
+}
+
+// Pattern returns the pattern of the r.
+func (r *Route) Pattern() string {
+	return r.pattern
+}
+
+// Handler returns the handler currently registered for the r, without the
+// middlewares added by the [Route.Use], as the [ServeMux.HandlerAt] does. It
+// returns nil if the pattern of the r is no longer registered.
+func (r *Route) Handler() http.Handler {
+	h, _ := r.mux.HandlerAt(r.pattern)
+	return h
+}
+
+// Use adds the middlewares to the r, with the first middleware being the
+// outermost. They wrap the handler of the r inside the middlewares added by
+// the [ServeMux.Use], and they are dropped if the handler is replaced by the
+// [ServeMux.ReplaceHandler].
+func (r *Route) Use(middlewares ...Middleware) *Route {
+	r.mux.mu.Lock()
+	defer r.mux.mu.Unlock()
+	if r.mux.sealed.Load() {
+		panic(errPrecompiled.Error())
+	}
+
+	if err := r.mux.amendHandlerTuple(r.pattern, func(ht *handlerTuple) {
+		if ht.routeHandler == nil {
+			ht.routeHandler = ht.handler
+		}
+		ht.routeMiddlewares = append(ht.routeMiddlewares[:len(ht.routeMiddlewares):len(ht.routeMiddlewares)], middlewares...)
+		h := ht.routeHandler
+		for i := len(ht.routeMiddlewares) - 1; i >= 0; i-- {
+			h = ht.routeMiddlewares[i](h)
+		}
+		ht.handler = h
+	}); err != nil {
+		panic(err.Error())
+	}
+	return r
+}
+
+// Name associates the name with the r, as the [ServeMux.HandleNamed] does. If
+// the name is already in use, Name panics.
+func (r *Route) Name(name string) *Route {
+	r.mux.mu.Lock()
+	defer r.mux.mu.Unlock()
+	if r.mux.sealed.Load() {
+		panic(errPrecompiled.Error())
+	}
+	if registeredPattern, ok := r.mux.namedPatterns[name]; ok {
+		panic(fmt.Sprintf("http.ServeMux: name %q for pattern %q is already used by %q", name, r.pattern, registeredPattern))
+	}
+	if _, _, err := r.mux.registeredHandlerTuple(r.pattern); err != nil {
+		panic(err.Error())
+	}
+	if r.mux.namedPatterns == nil {
+		r.mux.namedPatterns = map[string]string{}
+	}
+	r.mux.namedPatterns[name] = r.pattern
+	return r
+}
+
+// Meta adds the metadata entry of the k and v to the r, as the
+// [ServeMux.HandleWithMeta] does.
+func (r *Route) Meta(k, v string) *Route {
+	r.mux.mu.Lock()
+	defer r.mux.mu.Unlock()
+	if r.mux.sealed.Load() {
+		panic(errPrecompiled.Error())
+	}
+	if err := r.mux.amendHandlerTuple(r.pattern, func(ht *handlerTuple) {
+		meta := make(map[string]string, len(ht.meta)+1)
+		for k, v := range ht.meta {
+			meta[k] = v
+		}
+		meta[k] = v
+		ht.meta = meta
+	}); err != nil {
+		panic(err.Error())
+	}
+	return r
+}
@@ -0,0 +1,114 @@
+package servemux
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRoute(t *testing.T) {
+	setParallel(t)
+
+	middleware := func(name string) Middleware {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Add("Middleware", name)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+
+	mux := NewServeMux()
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Tier", RouteMeta(r)["tier"])
+	})
+	route := mux.Handle("GET /api/users", h).
+		Use(middleware("a"), middleware("b")).
+		Use(middleware("c")).
+		Name("users.list").
+		Meta("tier", "premium").
+		Meta("owner", "team")
+	if got := route.Pattern(); got != "GET /api/users" {
+		t.Errorf("Pattern() = %q", got)
+	}
+	if _, ok := route.Handler().(http.HandlerFunc); !ok {
+		t.Errorf("Handler() = %T, want the original handler", route.Handler())
+	}
+
+	for _, method := range []string{http.MethodGet, http.MethodHead} {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(method, "/api/users", nil))
+		if got := strings.Join(rec.Header().Values("Middleware"), ","); got != "a,b,c" {
+			t.Errorf("%s: Middleware = %q, want %q", method, got, "a,b,c")
+		}
+		if got := rec.Header().Get("Tier"); got != "premium" {
+			t.Errorf("%s: Tier = %q, want %q", method, got, "premium")
+		}
+	}
+	if got, err := mux.Reverse("users.list", nil, nil); err != nil || got != "/api/users" {
+		t.Errorf("Reverse() = %q, %v", got, err)
+	}
+
+	c := mux.Clone()
+	mux.Handle("/other", stringHandler("other")).Meta("tier", "free")
+	route.Meta("tier", "basic")
+	r := httptest.NewRequest(http.MethodGet, "/api/users", nil)
+	rec := httptest.NewRecorder()
+	c.ServeHTTP(rec, r)
+	if got := rec.Header().Get("Tier"); got != "premium" {
+		t.Errorf("clone: Tier = %q, want %q", got, "premium")
+	}
+
+	for _, f := range []func(){
+		func() { mux.Handle("/foo", stringHandler("foo")).Name("users.list") },
+		func() {
+			mux.Deregister("GET /api/users")
+			route.Use(middleware("d"))
+		},
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Error("expected a panic")
+				}
+			}()
+			f()
+		}()
+	}
+}
+
+func TestRouteUseAfterReplaceHandler(t *testing.T) {
+	setParallel(t)
+
+	middleware := func(name string) Middleware {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Add("Middleware", name)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+
+	mux := NewServeMux()
+	route := mux.Handle("/r", stringHandler("old")).Use(middleware("a"))
+	if err := mux.ReplaceHandler("/r", stringHandler("new")); err != nil {
+		t.Fatal(err)
+	}
+	if got := route.Handler(); got != stringHandler("new") {
+		t.Errorf("Handler() = %v, want the replaced handler", got)
+	}
+	route.Use(middleware("b")).Use(middleware("c"))
+	if got := route.Handler(); got != stringHandler("new") {
+		t.Errorf("Handler() after Use = %v, want the replaced handler", got)
+	}
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/r", nil))
+	if got := rec.Header().Get("Result"); got != "new" {
+		t.Errorf("Result = %q, want %q", got, "new")
+	}
+	if got := strings.Join(rec.Header().Values("Middleware"), ","); got != "b,c" {
+		t.Errorf("Middleware = %q, want %q", got, "b,c")
+	}
+}
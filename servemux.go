@@ -2,39 +2,134 @@ package servemux
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"log"
+	"log/slog"
 	"net"
 	"net/http"
 	"net/url"
 	"path"
 	"regexp"
+	"runtime"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // contextKey is a key for a context value.
 type contextKey struct{ name string }
 
 // The context keys.
-var pathVarsContextKey = &contextKey{"path-vars"}
+var (
+	pathVarsContextKey       = &contextKey{"path-vars"}
+	hostVarsContextKey       = &contextKey{"host-vars"}
+	pathVarValuesContextKey  = &contextKey{"path-var-values"}
+	allowedMethodsContextKey = &contextKey{"allowed-methods"}
+	matchedRouteContextKey   = &contextKey{"matched-route"}
+)
 
-// PathVars returns path variables of the r for the name. It returns nil if not
-// found.
+// PathVars returns path variables of the r for the name. It returns an empty
+// map if not found, so the result can always be read without a nil check.
+// Writes to that empty map are not stored in the r.
 func PathVars(r *http.Request) map[string]string {
 	pathVars, ok := r.Context().Value(pathVarsContextKey).(map[string]string)
 	if !ok {
-		return nil
+		return map[string]string{}
 	}
 	return pathVars
 }
 
+// RouteMeta returns the metadata of the pattern that the r has been dispatched
+// to by the [ServeMux.ServeHTTP], as registered by the
+// [ServeMux.HandleWithMeta]. The returned map must not be modified. It returns
+// nil if not found.
+func RouteMeta(r *http.Request) map[string]string {
+	ht, ok := r.Context().Value(matchedRouteContextKey).(*handlerTuple)
+	if !ok {
+		return nil
+	}
+	return ht.meta
+}
+
+// MatchedPattern returns the pattern that the request with the ctx has been
+// dispatched to by the [ServeMux.ServeHTTP]. It returns "" if not found, such
+// as before the request has been routed.
+func MatchedPattern(ctx context.Context) string {
+	ht, ok := ctx.Value(matchedRouteContextKey).(*handlerTuple)
+	if !ok {
+		return ""
+	}
+	return ht.pattern
+}
+
+// SubdomainVar returns the first host variable of the r. It returns "" if not
+// found.
+//
+// Host variables are the labels captured by the variable labels of a pattern
+// host, such as the "*" in "*.example.com". The first host variable is also
+// available as the "subdomain" path variable, unless the pattern path has a
+// variable of that name.
+func SubdomainVar(r *http.Request) string {
+	if hostVars := SubdomainVars(r); len(hostVars) > 0 {
+		return hostVars[0]
+	}
+	return ""
+}
+
+// SubdomainVars returns all host variables of the r in the order they appear
+// in the matched pattern host. It returns nil if not found.
+func SubdomainVars(r *http.Request) []string {
+	hostVars, ok := r.Context().Value(hostVarsContextKey).(*[]string)
+	if !ok {
+		return nil
+	}
+	return *hostVars
+}
+
+// AllowedMethodsFromContext returns the methods allowed for the request path
+// from the ctx. It is only available to the handler set by the
+// [ServeMux.SetMethodNotAllowedHandler]. It returns nil if not found.
+func AllowedMethodsFromContext(ctx context.Context) []string {
+	methods, _ := ctx.Value(allowedMethodsContextKey).([]string)
+	return methods
+}
+
+// PathVarSlice returns the values of all path variables of the r, including
+// those of unnamed variables, in the order they appear in the matched pattern
+// path. The returned slice is a copy. It returns nil if not found, such as
+// when the matched pattern path has no variables.
+func PathVarSlice(r *http.Request) []string {
+	pathVarValues, ok := r.Context().Value(pathVarValuesContextKey).(*[]string)
+	if !ok || len(*pathVarValues) == 0 {
+		return nil
+	}
+	return append([]string(nil), *pathVarValues...)
+}
+
 // ConfigureRequestToStorePathVars configures the r so that it can be used to
-// store path variables.
+// store path variables and host variables.
 func ConfigureRequestToStorePathVars(r *http.Request) *http.Request {
-	if _, ok := r.Context().Value(pathVarsContextKey).(map[string]string); ok {
+	ctx := r.Context()
+	_, ok1 := ctx.Value(pathVarsContextKey).(map[string]string)
+	_, ok2 := ctx.Value(hostVarsContextKey).(*[]string)
+	_, ok3 := ctx.Value(pathVarValuesContextKey).(*[]string)
+	if ok1 && ok2 && ok3 {
 		return r
 	}
-	return r.WithContext(context.WithValue(r.Context(), pathVarsContextKey, map[string]string{}))
+	if !ok1 {
+		ctx = context.WithValue(ctx, pathVarsContextKey, map[string]string{})
+	}
+	if !ok2 {
+		ctx = context.WithValue(ctx, hostVarsContextKey, new([]string))
+	}
+	if !ok3 {
+		ctx = context.WithValue(ctx, pathVarValuesContextKey, new([]string))
+	}
+	return r.WithContext(ctx)
 }
 
 // ServeMux is an HTTP request multiplexer. It matches the URL of each incoming
@@ -43,52 +138,254 @@ func ConfigureRequestToStorePathVars(r *http.Request) *http.Request {
 //
 // ...
 type ServeMux struct {
-	mu                 sync.RWMutex
-	tree               *serveMuxNode
-	hostTrees          map[string]*serveMuxNode
-	registeredPatterns map[string]string
-	maxPathVars        int
-	pathVarValuesPool  sync.Pool
+	mu                      sync.RWMutex
+	tree                    *serveMuxNode
+	hostTrees               map[string]*serveMuxNode
+	varHostTrees            []*varHostTree
+	registeredPatterns      map[string]string
+	maxPathVars             int
+	pathVarValuesPool       sync.Pool
+	grpcWeb                 *ServeMux
+	grpcWebAdapter          func(http.Handler) http.Handler
+	panicEncoder            func(v any) (statusCode int, body []byte, contentType string)
+	panicHandler            func(w http.ResponseWriter, r *http.Request, recovered any)
+	redirectHandler         func(w http.ResponseWriter, r *http.Request, url string, code int)
+	strictVarUsage          bool
+	caseInsensitive         bool
+	noTrailingSlashRedirect bool
+	noAutoOptions           bool
+	methodOverride          bool
+	silentPatternOverlap    bool
+	noPathCleaning          atomic.Bool
+	maxBodySize             atomic.Int64
+	pathCleaningWarned      bool
+	sealed                  atomic.Bool
+	frozen                  bool
+	cache                   *routeCache
+	logger                  *slog.Logger
+	logAttrs                func(*http.Request, string, time.Duration) []slog.Attr
+	metricsReporters        []func(method, pattern string, status int, duration time.Duration)
+	active                  atomic.Int64
+	draining                atomic.Bool
+	drainMu                 sync.Mutex
+	drained                 chan struct{}
+	notFound                http.Handler
+	methodNotAllowed        http.Handler
+	middlewares             []func(http.Handler) http.Handler
+	preRoutingMiddlewares   []func(http.Handler) http.Handler
+	preRoutingHandler       http.Handler
+	namedPatterns           map[string]string
+	pathVarValidators       map[string][]func(string) bool
+	hostAliases             map[string]string
+	watchers                map[chan RouteEvent]struct{}
+}
+
+// Option is an option of a [ServeMux].
+type Option func(mux *ServeMux)
+
+// WithPanicRecovery returns an [Option] that makes a [ServeMux] recover
+// panicking handlers in the [ServeMux.ServeHTTP]. The recovered value is
+// logged alongside the matched pattern, and then mapped to a response by the
+// encoder.
+//
+// If the encoder is nil or returns a zero status code, the status code 500 is
+// used. Panics with [http.ErrAbortHandler] are never recovered, so that
+// aborted responses keep working.
+func WithPanicRecovery(encoder func(v any) (statusCode int, body []byte, contentType string)) Option {
+	return func(mux *ServeMux) {
+		if encoder == nil {
+			encoder = func(any) (int, []byte, string) {
+				return http.StatusInternalServerError, []byte("500 internal server error\n"), "text/plain; charset=utf-8"
+			}
+		}
+		mux.panicEncoder = encoder
+	}
+}
+
+// WithStrictVarUsage returns an [Option] that makes a [ServeMux] reject, rather
+// than warn about, handlers implementing the [HandlerWithVarUsage] whose used
+// path variable names do not match the path variable names of their patterns.
+func WithStrictVarUsage() Option {
+	return func(mux *ServeMux) { mux.strictVarUsage = true }
+}
+
+// WithCaseInsensitive returns an [Option] that makes a [ServeMux] match the
+// non-variable path elements of request paths regardless of the case of their
+// ASCII letters. Patterns are folded to lower case when registered, so two
+// patterns that differ only in case conflict, and the non-variable path
+// elements of redirects to canonical paths are lower-cased. Path variable
+// values keep their original case.
+func WithCaseInsensitive() Option {
+	return func(mux *ServeMux) { mux.caseInsensitive = true }
+}
+
+// WithNoTrailingSlashRedirect returns an [Option] that makes a [ServeMux] never
+// redirect request paths like "/subtree" to "/subtree/" for patterns like
+// "/subtree/", so that the two can be treated as independent resources. See
+// also the [ServeMux.HandleNoRedirect].
+func WithNoTrailingSlashRedirect() Option {
+	return func(mux *ServeMux) { mux.noTrailingSlashRedirect = true }
+}
+
+// WithAutoOptions returns an [Option] that sets whether a [ServeMux] responds
+// to OPTIONS requests for request paths that have no OPTIONS handler with
+// status 204 (No Content) and an Allow header listing the allowed methods. It
+// is enabled by default.
+func WithAutoOptions(enabled bool) Option {
+	return func(mux *ServeMux) { mux.noAutoOptions = !enabled }
+}
+
+// WithMethodOverride returns an [Option] that makes a [ServeMux] match POST
+// requests using the method in their X-HTTP-Method-Override header or, if it
+// is absent, their _method form value, for clients that cannot send methods
+// like PUT or DELETE. The r.Method is left unchanged, so handlers still see
+// POST. Override methods that are not alphanumeric are ignored.
+//
+// Note that looking up the _method form value parses the request body, as
+// the [http.Request.ParseForm] does, when the Content-Type is
+// application/x-www-form-urlencoded.
+func WithMethodOverride() Option {
+	return func(mux *ServeMux) { mux.methodOverride = true }
+}
+
+// WithSilentPatternOverlap returns an [Option] that makes a [ServeMux] not warn
+// when a method-less pattern and a method-specific one are registered for the
+// same host and path, for muxes where the method-less one is meant to handle
+// all other methods.
+func WithSilentPatternOverlap() Option {
+	return func(mux *ServeMux) { mux.silentPatternOverlap = true }
+}
+
+// HandlerWithVarUsage is an [http.Handler] that declares the path variables it
+// uses. When such a handler is registered, the [ServeMux] verifies that the
+// declared names are exactly the named path variables of the pattern, and
+// logs a warning otherwise. See [WithStrictVarUsage].
+type HandlerWithVarUsage interface {
+	http.Handler
+
+	// UsedPathVarNames returns the names of the path variables used by
+	// the handler.
+	UsedPathVarNames() []string
 }
 
 // NewServeMux allocates and returns a new ServeMux.
-func NewServeMux() *ServeMux { return new(ServeMux) }
+func NewServeMux(opts ...Option) *ServeMux {
+	mux := new(ServeMux)
+	for _, opt := range opts {
+		opt(mux)
+	}
+	return mux
+}
 
 var (
 	// serveMuxMethodRE is used to match valid method for the
-	// [ServeMux.parsePattern].
+	// [parsePattern].
 	serveMuxMethodRE = regexp.MustCompile(`^[0-9A-Za-z]+$`)
 
 	// serveMuxPathVarNameRE is used to match valid path variable name for
-	// the [ServeMux.parsePattern].
+	// the [parsePattern].
 	serveMuxPathVarNameRE = regexp.MustCompile(`^[_\pL][_\pL\p{Nd}]*$`)
 )
 
-// parsePattern parses the pattern. It panics when something goes wrong.
-func (mux *ServeMux) parsePattern(pattern string) (method, host, path string, pathVarNames []string) {
+// splitPattern splits the pattern into its method, host and path without
+// validating them.
+func splitPattern(pattern string) (method, host, path string) {
 	method, hostpath, ok := strings.Cut(pattern, " ")
 	if !ok {
 		method, hostpath = "", method
 	}
+	if i := strings.Index(hostpath, "/"); i >= 0 {
+		return method, hostpath[:i], hostpath[i:]
+	}
+	return method, hostpath, ""
+}
+
+// patternError is an error in a pattern. Its message states the violated
+// rule, and the near is the offending part of the pattern, which starts at the
+// byte offset pos of the pattern.
+type patternError struct {
+	msg     string
+	pattern string
+	pos     int
+	near    string
+}
+
+// patternErrorf returns a new [patternError] for the near at the pos of the
+// pattern, with its message formatted according to the format.
+func patternErrorf(pattern string, pos int, near, format string, a ...any) error {
+	return &patternError{msg: fmt.Sprintf(format, a...), pattern: pattern, pos: pos, near: near}
+}
+
+// Error implements the [error].
+func (pe *patternError) Error() string {
+	return fmt.Sprintf("%s at position %d in pattern %q: %q", pe.msg, pe.pos, pe.pattern, pe.near)
+}
+
+// parsePattern parses the pattern. It returns an error when something goes
+// wrong.
+//
+// The returned host has all variable labels replaced with "*", and the
+// returned path has all variable names removed, so two patterns that differ
+// only in the names of their variables produce the same method, host and path.
+func parsePattern(pattern string) (method, host, path string, hostVarNames, pathVarNames []string, err error) {
+	method, host, path = splitPattern(pattern)
+	pathPos := len(pattern) - len(path)
+	hostPos := pathPos - len(host)
+	pathVarElemIndexes := map[string]int{}
 
 	if method != "" && !serveMuxMethodRE.MatchString(method) {
-		panic("http.ServeMux: a pattern method must be either empty or alphanumeric")
+		return "", "", "", nil, nil, patternErrorf(pattern, 0, method, "http.ServeMux: a pattern method must be either empty or alphanumeric")
 	}
 
-	if hostpath == "" {
-		panic("http.ServeMux: a pattern must have at least one of the host or path")
-	}
-	if i := strings.Index(hostpath, "/"); i >= 0 {
-		host, path = hostpath[:i], hostpath[i:]
-	} else {
-		host = hostpath
+	if host == "" && path == "" {
+		return "", "", "", nil, nil, patternErrorf(pattern, 0, pattern, "http.ServeMux: a pattern must have at least one of the host or path")
 	}
 
 	if host != "" {
-		u, _ := url.Parse("http://" + host + "/")
-		if u == nil || u.Host != host {
-			panic(`http.ServeMux: a pattern host must be able to be parsed using net/url.Parse("http://" + host + "/")`)
+		labels := strings.Split(host, ".")
+		denamedLabels := make([]string, len(labels))
+		labelPos := hostPos
+		for i, label := range labels {
+			pos := labelPos
+			labelPos += len(label) + 1
+			denamedLabels[i] = label
+			if label == "*" {
+				hostVarNames = append(hostVarNames, "")
+				labels[i] = "x"
+				continue
+			}
+			if label == "" {
+				continue
+			}
+			if fc, lc := label[0], label[len(label)-1]; fc != '{' && lc != '}' {
+				continue
+			} else if (fc == '{') != (lc == '}') {
+				return "", "", "", nil, nil, patternErrorf(pattern, pos, label, "http.ServeMux: each label in a pattern host must either be a variable or not")
+			}
+
+			varName := label[1 : len(label)-1]
+			if varName != "" {
+				if !serveMuxPathVarNameRE.MatchString(varName) {
+					return "", "", "", nil, nil, patternErrorf(pattern, pos, label, "http.ServeMux: the name of a variable label in a pattern host must be either empty or a Go identifier")
+				}
+				for _, hvn := range hostVarNames {
+					if hvn == varName {
+						return "", "", "", nil, nil, patternErrorf(pattern, pos, label, "http.ServeMux: all variable labels within the same pattern host must have unique names")
+					}
+				}
+			}
+			hostVarNames = append(hostVarNames, varName)
+			denamedLabels[i] = "*"
+			labels[i] = "x"
+		}
+
+		checkedHost := strings.Join(labels, ".")
+		u, _ := url.Parse("http://" + checkedHost + "/")
+		if u == nil || u.Host != checkedHost {
+			return "", "", "", nil, nil, patternErrorf(pattern, hostPos, host, `http.ServeMux: a pattern host must be able to be parsed using net/url.Parse("http://" + host + "/") after replacing its variable labels`)
 		}
+
+		host = strings.Join(denamedLabels, ".")
 	}
 
 	if path != "" {
@@ -103,75 +400,218 @@ func (mux *ServeMux) parsePattern(pattern string) (method, host, path string, pa
 				denamedPath += elem
 				return true
 			} else if (fc == '{') != (lc == '}') {
-				panic("http.ServeMux: each path element in a pattern path must either be a variable or not")
+				err = patternErrorf(pattern, pathPos+elemIndex, elem, "http.ServeMux: each path element in a pattern path must either be a variable or not")
+				return false
 			}
 
-			varName, varModifier := elem[1:len(elem)-1], ""
-			if i := strings.IndexAny(varName, ".$"); i >= 0 {
+			varName, varModifier, varConstraint := elem[1:len(elem)-1], "", ""
+			if i := strings.IndexByte(varName, ':'); i >= 0 {
+				varName, varConstraint = varName[:i], varName[i+1:]
+				if varConstraint == "" {
+					err = patternErrorf(pattern, pathPos+elemIndex, elem, "http.ServeMux: the constraint of a variable path element in a pattern path must not be empty")
+					return false
+				}
+				if _, err = regexp.Compile(varConstraint); err != nil {
+					err = patternErrorf(pattern, pathPos+elemIndex, elem, "http.ServeMux: the constraint %q of a variable path element in a pattern path is not a valid regular expression: %v", varConstraint, err)
+					return false
+				}
+			}
+			if i := strings.IndexAny(varName, ".$?"); i >= 0 {
 				varName, varModifier = varName[:i], varName[i:]
 			}
+			if varConstraint != "" && varModifier != "" {
+				err = patternErrorf(pattern, pathPos+elemIndex, elem, "http.ServeMux: a constrained variable path element in a pattern path must have no modifier")
+				return false
+			}
 
 			if varName != "" {
 				if !serveMuxPathVarNameRE.MatchString(varName) {
-					panic("http.ServeMux: the name of a variable path element in a pattern path must be either empty or a Go identifier")
+					err = patternErrorf(pattern, pathPos+elemIndex, elem, "http.ServeMux: the name of a variable path element in a pattern path must be either empty or a Go identifier")
+					return false
 				}
 				for _, pvn := range pathVarNames {
 					if pvn == varName {
-						panic("http.ServeMux: all variable path elements within the same pattern path must have unique names")
+						err = patternErrorf(pattern, pathPos+elemIndex, elem, "http.ServeMux: all variable path elements within the same pattern path must have unique names")
+						return false
 					}
 				}
 			}
 			pathVarNames = append(pathVarNames, varName)
+			if varName != "" {
+				pathVarElemIndexes[varName] = elemIndex
+			}
 
 			isNotLastElem := elemIndex+len(elem) < len(path)
 			switch varModifier {
 			case "":
 			case "...":
 				if isNotLastElem {
-					panic("http.ServeMux: a ...-modified variable can only be the last path element in a pattern path")
+					err = patternErrorf(pattern, pathPos+elemIndex, elem, "http.ServeMux: a ...-modified variable can only be the last path element in a pattern path")
+					return false
 				}
 			case "$":
 				if isNotLastElem {
-					panic("http.ServeMux: a $-modified variable can only be the last path element in a pattern path")
+					err = patternErrorf(pattern, pathPos+elemIndex, elem, "http.ServeMux: a $-modified variable can only be the last path element in a pattern path")
+					return false
 				}
 				if varName != "" {
-					panic("http.ServeMux: a $-modified variable path element in a pattern path must have no name")
+					err = patternErrorf(pattern, pathPos+elemIndex, elem, "http.ServeMux: a $-modified variable path element in a pattern path must have no name")
+					return false
 				}
 				pathVarNames = pathVarNames[:len(pathVarNames)-1]
 				return false
+			case "?":
+				if isNotLastElem {
+					err = patternErrorf(pattern, pathPos+elemIndex, elem, "http.ServeMux: a ?-modified variable can only be the last path element in a pattern path")
+					return false
+				}
+				if elemIndex == 1 {
+					err = patternErrorf(pattern, pathPos+elemIndex, elem, "http.ServeMux: a ?-modified variable cannot be the first path element in a pattern path")
+					return false
+				}
 			default:
-				panic("http.ServeMux: the modifier of a variable path element in a pattern path can only be ... or $")
+				err = patternErrorf(pattern, pathPos+elemIndex, elem, "http.ServeMux: the modifier of a variable path element in a pattern path can only be ..., $ or ?")
+				return false
+			}
+			if varConstraint != "" {
+				denamedPath += "{:" + varConstraint + "}"
+			} else {
+				denamedPath += "{" + varModifier + "}"
 			}
-			denamedPath += "{" + varModifier + "}"
 
 			return true
 		})
+		if err != nil {
+			return "", "", "", nil, nil, err
+		}
 		path = denamedPath
 	}
 
-	cleanedPattern := method + " " + host + path
-	if registeredPattern, ok := mux.registeredPatterns[cleanedPattern]; ok {
-		panic(fmt.Sprintf("http.ServeMux: pattern %q conflicts with %q", pattern, registeredPattern))
-	} else {
-		mux.registeredPatterns[cleanedPattern] = pattern
+	for _, hvn := range hostVarNames {
+		if hvn == "" {
+			continue
+		}
+		if i, ok := pathVarElemIndexes[hvn]; ok {
+			elem := pattern[pathPos+i:]
+			if j := strings.IndexByte(elem, '/'); j >= 0 {
+				elem = elem[:j]
+			}
+			return "", "", "", nil, nil, patternErrorf(pattern, pathPos+i, elem, "http.ServeMux: the variable labels in a pattern host and the variable path elements in a pattern path must have unique names")
+		}
 	}
 
 	return
 }
 
+// parsePattern is like the [parsePattern], but it also folds the path as
+// configured for the mux.
+func (mux *ServeMux) parsePattern(pattern string) (method, host, path string, hostVarNames, pathVarNames []string, err error) {
+	method, host, path, hostVarNames, pathVarNames, err = parsePattern(pattern)
+	if err == nil && mux.caseInsensitive {
+		path = foldNonvarPathElems(path)
+	}
+	return
+}
+
+// splitOptionalPath splits the denamed path ending with a ?-modified variable
+// path element into the path with the element as an unmodified one and the
+// path without the element. If the path does not end with such an element,
+// it returns the path and false.
+func splitOptionalPath(path string) (fullPath, shortPath string, ok bool) {
+	if !strings.HasSuffix(path, "/{?}") {
+		return path, "", false
+	}
+	return path[:len(path)-2] + "}", path[:len(path)-4], true
+}
+
 // Handle registers the handler for the given pattern. If a handler already
-// exists for pattern, Handle panics.
+// exists for pattern, Handle panics. The returned [Route] can be used to amend
+// the registration.
 //
 // ...
-func (mux *ServeMux) Handle(pattern string, handler http.Handler) {
+func (mux *ServeMux) Handle(pattern string, handler http.Handler) *Route {
+	if err := mux.HandleE(pattern, handler); err != nil {
+		panic(err.Error())
+	}
+	return &Route{mux: mux, pattern: pattern}
+}
+
+// HandleE is like the [ServeMux.Handle], except that it returns an error
+// instead of panicking when the pattern is invalid or conflicts with a
+// registered one, or when the handler is nil. The mux is left untouched when
+// an error is returned.
+func (mux *ServeMux) HandleE(pattern string, handler http.Handler) error {
 	mux.mu.Lock()
 	defer mux.mu.Unlock()
+	return mux.handle(pattern, handler, handleOptions{})
+}
+
+// handleOptions are the options of registering a pattern.
+type handleOptions struct {
+	// noRedirect reports whether no trailing slash redirect is registered
+	// for the pattern.
+	noRedirect bool
+
+	// meta is the metadata of the pattern.
+	meta map[string]string
+
+	// canonical is the pattern that the pattern is an alias of, if any.
+	canonical string
 
+	// bodyLimited reports whether the handler has its own body limit, which
+	// takes precedence over the one set by the [ServeMux.SetMaxBodySize].
+	bodyLimited bool
+}
+
+// handle is the main implementation of the [ServeMux.Handle]. It returns an
+// error instead of panicking when something goes wrong, in which case the mux
+// is left untouched. The caller must hold the mux.mu.
+func (mux *ServeMux) handle(pattern string, handler http.Handler, opts handleOptions) error {
+	if mux.sealed.Load() {
+		return errPrecompiled
+	}
+	if mux.frozen {
+		return errFrozen
+	}
 	if pattern == "" {
-		panic("http.ServeMux: empty pattern")
+		return errors.New("http.ServeMux: empty pattern")
 	}
 	if handler == nil {
-		panic("http.ServeMux: nil handler")
+		return errors.New("http.ServeMux: nil handler")
+	}
+
+	method, host, path, hostVarNames, pathVarNames, err := mux.parsePattern(pattern)
+	if err != nil {
+		return err
+	}
+	path, shortPath, optional := splitOptionalPath(path)
+
+	cleanedPattern := method + " " + host + path
+	if registeredPattern, ok := mux.registeredPatterns[cleanedPattern]; ok {
+		return fmt.Errorf("http.ServeMux: pattern %q conflicts with %q", pattern, registeredPattern)
+	}
+	shortCleanedPattern := method + " " + host + shortPath
+	if optional {
+		if registeredPattern, ok := mux.registeredPatterns[shortCleanedPattern]; ok {
+			return fmt.Errorf("http.ServeMux: pattern %q conflicts with %q", pattern, registeredPattern)
+		}
+	}
+	if to, ok := mux.hostAliases[host]; ok {
+		return fmt.Errorf("http.ServeMux: host of pattern %q is an alias of %q", pattern, to)
+	}
+
+	if mux.noPathCleaning.Load() && !mux.pathCleaningWarned {
+		log.Printf("http.ServeMux: path cleaning is disabled, so request paths are matched against pattern %q and others without being canonicalized", pattern)
+		mux.pathCleaningWarned = true
+	}
+
+	if hwvu, ok := handler.(HandlerWithVarUsage); ok {
+		if err := checkVarUsage(pattern, pathVarNames, hwvu.UsedPathVarNames()); err != nil {
+			if mux.strictVarUsage {
+				return err
+			}
+			log.Print(err)
+		}
 	}
 
 	if mux.tree == nil {
@@ -179,11 +619,29 @@ func (mux *ServeMux) Handle(pattern string, handler http.Handler) {
 		mux.hostTrees = map[string]*serveMuxNode{}
 		mux.registeredPatterns = map[string]string{}
 	}
-
-	method, host, path, pathVarNames := mux.parsePattern(pattern)
+	mux.registeredPatterns[cleanedPattern] = pattern
 
 	tree := mux.tree
-	if host != "" {
+	if len(hostVarNames) > 0 {
+		tree = nil
+		for _, vht := range mux.varHostTrees {
+			if vht.host == host {
+				tree = vht.tree
+				break
+			}
+		}
+		if tree == nil {
+			tree = &serveMuxNode{nonvarChildren: make([]*serveMuxNode, 255)}
+			mux.varHostTrees = append(mux.varHostTrees, &varHostTree{
+				host:   host,
+				labels: strings.Split(host, "."),
+				tree:   tree,
+			})
+			sort.SliceStable(mux.varHostTrees, func(i, j int) bool {
+				return mux.varHostTrees[i].moreSpecificThan(mux.varHostTrees[j])
+			})
+		}
+	} else if host != "" {
 		tree = mux.hostTrees[host]
 		if tree == nil {
 			tree = &serveMuxNode{nonvarChildren: make([]*serveMuxNode, 255)}
@@ -196,7 +654,22 @@ func (mux *ServeMux) Handle(pattern string, handler http.Handler) {
 		mux.pathVarValuesPool = sync.Pool{New: func() any { return make([]string, l) }}
 	}
 
-	ht := &handlerTuple{method, pathVarNames, pattern, handler}
+	_, rawHost, rawPath := splitPattern(pattern)
+	ht := &handlerTuple{
+		method:       method,
+		host:         rawHost,
+		path:         rawPath,
+		hostVarNames: hostVarNames,
+		pathVarNames: pathVarNames,
+		pattern:      pattern,
+		handler:      handler,
+		meta:         opts.meta,
+		optional:     optional,
+		bodyLimited:  opts.bodyLimited,
+	}
+	if opts.canonical != "" {
+		ht.pattern, ht.alias = opts.canonical, pattern
+	}
 	walkPath(path, func(_, elem string, elemIndex int) bool {
 		if elem[0] != '{' {
 			return true
@@ -207,6 +680,8 @@ func (mux *ServeMux) Handle(pattern string, handler http.Handler) {
 		nodeType := unmodifiedVarServeMuxNode
 		if elem == "{...}" {
 			nodeType = ellipsisModifiedVarServeMuxNode
+		} else if elem[1] == ':' {
+			nodeType = constrainedVarServeMuxNode
 		}
 
 		if nextSlashIndex := elemIndex + len(elem); nextSlashIndex < len(path) {
@@ -219,123 +694,894 @@ func (mux *ServeMux) Handle(pattern string, handler http.Handler) {
 		// For patterns like "/subtree/{...}", we may need to redirect
 		// request paths like "/subtree" to "/subtree/".
 		if path := strings.TrimRight(path[:elemIndex-1], "/"); path != "" &&
-			nodeType == ellipsisModifiedVarServeMuxNode && len(pathVarNames) == 1 {
-			method := "_tsr"
-			cleanedPattern := method + " " + host + path
+			nodeType == ellipsisModifiedVarServeMuxNode && len(pathVarNames) == 1 &&
+			!opts.noRedirect && !mux.noTrailingSlashRedirect {
+			cleanedPattern := "_tsr " + host + path
 			if _, ok := mux.registeredPatterns[cleanedPattern]; !ok {
 				mux.registeredPatterns[cleanedPattern] = pattern
-				mux.insert(tree, nonvarServeMuxNode, path, &handlerTuple{
-					method:  method,
-					pattern: pattern,
-					handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-						u := &url.URL{Path: r.URL.Path + "/", RawQuery: r.URL.RawQuery}
-						http.Redirect(w, r, u.String(), http.StatusMovedPermanently)
-					}),
-				})
+				mux.insert(tree, nonvarServeMuxNode, path, tsrHandlerTuple(pattern))
 			}
 		}
 
 		return false
 	})
 	mux.insert(tree, nonvarServeMuxNode, path, ht)
-}
-
-// insert inserts nodes into the tree.
-func (mux *ServeMux) insert(tree *serveMuxNode, nt serveMuxNodeType, path string, ht *handlerTuple) {
-	var (
-		s  = path        // Search
-		sl int           // Search length
-		pl int           // Prefix length
-		ll int           // LCP length
-		ml int           // Minimum length of the sl and pl
-		cn = tree        // Current node
-		nn *serveMuxNode // Next node
-	)
 
-	for {
-		sl, pl, ll = len(s), len(cn.prefix), 0
-		if sl < pl {
-			ml = sl
-		} else {
-			ml = pl
-		}
+	// For patterns like "/users/{id?}", the request path "/users" is
+	// matched by the same handlerTuple as "/users/{id}".
+	if optional {
+		mux.registeredPatterns[shortCleanedPattern] = pattern
+		mux.insert(tree, nonvarServeMuxNode, shortPath, ht)
+	}
 
-		for ; ll < ml && s[ll] == cn.prefix[ll]; ll++ {
-		}
+	if !mux.silentPatternOverlap {
+		mux.warnPatternOverlap(tree.findNode(path), ht)
+	}
 
-		if s == "" { // At root node
-			if ht != nil {
-				cn.typ = nt
-				cn.setHandlerTuple(ht)
-			}
-		} else if ll < pl { // Split node
-			nn = &serveMuxNode{
-				prefix:                   cn.prefix[ll:],
-				label:                    cn.prefix[ll],
-				typ:                      cn.typ,
-				parent:                   cn,
-				nonvarChildren:           cn.nonvarChildren,
-				unmodifiedVarChild:       cn.unmodifiedVarChild,
-				ellipsisModifiedVarChild: cn.ellipsisModifiedVarChild,
-				hasAtLeastOneChild:       cn.hasAtLeastOneChild,
-				handlerTuples:            cn.handlerTuples,
-				catchAllHandlerTuple:     cn.catchAllHandlerTuple,
-				hasAtLeastOneHandler:     cn.hasAtLeastOneHandler,
-			}
+	if mux.cache != nil {
+		mux.cache.purge()
+	}
+	mux.notifyWatchers(RouteRegistered, pattern)
 
-			for _, n := range nn.nonvarChildren {
-				if n != nil {
-					n.parent = nn
-				}
-			}
+	return nil
+}
 
-			if nn.unmodifiedVarChild != nil {
-				nn.unmodifiedVarChild.parent = nn
+// warnPatternOverlap logs a warning, to the mux.logger if any, if the ht
+// just set to the n makes a method-less pattern coexist with a method-specific
+// one, since the method-less one then silently handles all other methods. The
+// caller must hold the mux.mu.
+func (mux *ServeMux) warnPatternOverlap(n *serveMuxNode, ht *handlerTuple) {
+	var methodless, methodful string
+	if ht.method == "" {
+		methodless = ht.registeredPattern()
+		for _, p := range n.handlerTuples {
+			if !p.ht.synthesized {
+				methodful = p.ht.registeredPattern()
+				break
 			}
+		}
+	} else if cht := n.catchAllHandlerTuple; cht != nil && cht.method != "_tsr" {
+		methodless, methodful = cht.registeredPattern(), ht.registeredPattern()
+	}
+	if methodless == "" || methodful == "" {
+		return
+	}
 
-			if nn.ellipsisModifiedVarChild != nil {
-				nn.ellipsisModifiedVarChild.parent = nn
-			}
+	msg := fmt.Sprintf("http.ServeMux: method-less pattern %q handles every method not registered by method-specific patterns like %q", methodless, methodful)
+	if mux.logger != nil {
+		mux.logger.Warn(msg)
+		return
+	}
+	log.Print(msg)
+}
 
-			// Reset current node.
-			cn.prefix = cn.prefix[:ll]
-			cn.label = cn.prefix[0]
-			cn.typ = nonvarServeMuxNode
-			cn.nonvarChildren = make([]*serveMuxNode, 255)
-			cn.unmodifiedVarChild = nil
-			cn.ellipsisModifiedVarChild = nil
-			cn.hasAtLeastOneChild = false
-			cn.handlerTuples = nil
-			cn.catchAllHandlerTuple = nil
-			cn.hasAtLeastOneHandler = false
-			cn.addChild(nn)
+// HandleNoRedirect is like the [ServeMux.Handle], but request paths like
+// "/subtree" are never redirected to "/subtree/" for the pattern, even if the
+// pattern is like "/subtree/".
+func (mux *ServeMux) HandleNoRedirect(pattern string, handler http.Handler) {
+	mux.mu.Lock()
+	defer mux.mu.Unlock()
+	if err := mux.handle(pattern, handler, handleOptions{noRedirect: true}); err != nil {
+		panic(err.Error())
+	}
+}
 
-			if ll == sl { // At current node
-				cn.typ = nt
-				if ht != nil {
-					cn.setHandlerTuple(ht)
-				}
-			} else { // Create child node
-				nn = &serveMuxNode{
-					prefix:         s[ll:],
-					label:          s[ll],
-					typ:            nt,
-					parent:         cn,
-					nonvarChildren: make([]*serveMuxNode, 255),
-				}
-				if ht != nil {
-					nn.setHandlerTuple(ht)
-				}
-				cn.addChild(nn)
-			}
-		} else if ll < sl {
-			s = s[ll:]
+// HandleWithMeta is like the [ServeMux.Handle], but it also associates the meta
+// with the pattern, so that middlewares and the handler can retrieve it using
+// the [RouteMeta]. The meta is copied.
+func (mux *ServeMux) HandleWithMeta(pattern string, handler http.Handler, meta map[string]string) {
+	opts := handleOptions{meta: make(map[string]string, len(meta))}
+	for k, v := range meta {
+		opts.meta[k] = v
+	}
 
-			nn = nil
+	mux.mu.Lock()
+	defer mux.mu.Unlock()
+	if err := mux.handle(pattern, handler, opts); err != nil {
+		panic(err.Error())
+	}
+}
+
+// HandleWithTimeout is like the [ServeMux.Handle], but the handler is wrapped
+// with the [http.TimeoutHandler] using the timeout and the timeoutBody.
+func (mux *ServeMux) HandleWithTimeout(pattern string, timeout time.Duration, timeoutBody string, handler http.Handler) {
+	if handler == nil {
+		panic("http.ServeMux: nil handler")
+	}
+	mux.Handle(pattern, http.TimeoutHandler(handler, timeout, timeoutBody))
+}
+
+// HandleWithBodyLimit is like the [ServeMux.Handle], but the request bodies
+// read by the handler are limited to maxBytes using the [http.MaxBytesReader].
+// Requests whose Content-Length exceeds the maxBytes are responded with
+// status 413 (Request Entity Too Large) without calling the handler, as are
+// requests whose bodies turn out to exceed it if the handler writes nothing.
+// A zero maxBytes disables the limit. Either way, the limit takes precedence
+// over the one set by the [ServeMux.SetMaxBodySize].
+func (mux *ServeMux) HandleWithBodyLimit(pattern string, maxBytes int64, handler http.Handler) {
+	if handler == nil {
+		panic("http.ServeMux: nil handler")
+	}
+	if maxBytes < 0 {
+		panic("http.ServeMux: negative body limit")
+	}
+	if maxBytes > 0 {
+		handler = bodyLimitHandler{maxBytes, handler}
+	}
+	mux.mu.Lock()
+	defer mux.mu.Unlock()
+	if err := mux.handle(pattern, handler, handleOptions{bodyLimited: true}); err != nil {
+		panic(err.Error())
+	}
+}
+
+// bodyLimitHandler is an [http.Handler] that limits the request bodies read
+// by the h to the maxBytes.
+type bodyLimitHandler struct {
+	maxBytes int64
+	h        http.Handler
+}
+
+// ServeHTTP implements the [http.Handler].
+func (blh bodyLimitHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.ContentLength > blh.maxBytes {
+		http.Error(w, "413 request entity too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	if r.Body == nil || r.Body == http.NoBody {
+		blh.h.ServeHTTP(w, r)
+		return
+	}
+
+	body := &bodyLimitReader{ReadCloser: http.MaxBytesReader(w, r.Body, blh.maxBytes)}
+	sw := &statusResponseWriter{ResponseWriter: w}
+	r2 := new(http.Request)
+	*r2 = *r
+	r2.Body = body
+	blh.h.ServeHTTP(sw, r2)
+	if body.exceeded && sw.code == 0 {
+		http.Error(w, "413 request entity too large", http.StatusRequestEntityTooLarge)
+	}
+}
+
+// bodyLimitReader is an [io.ReadCloser] that records whether the
+// [http.MaxBytesReader] it wraps has exceeded its limit.
+type bodyLimitReader struct {
+	io.ReadCloser
+	exceeded bool
+}
+
+// Read implements the [io.Reader].
+func (blr *bodyLimitReader) Read(p []byte) (int, error) {
+	n, err := blr.ReadCloser.Read(p)
+	var mbe *http.MaxBytesError
+	if errors.As(err, &mbe) {
+		blr.exceeded = true
+	}
+	return n, err
+}
+
+// HandleLazy is like the [ServeMux.Handle], but the handler is created by
+// calling the init on the first request matching the pattern, which is useful
+// for handlers that are expensive to create. The init is called at most once
+// successfully; concurrent requests wait for it. If the init panics or returns
+// a nil handler, the next request calls it again.
+func (mux *ServeMux) HandleLazy(pattern string, init func() http.Handler) {
+	if init == nil {
+		panic("http.ServeMux: nil lazy handler initializer")
+	}
+	mux.Handle(pattern, &lazyHandler{init: init})
+}
+
+// lazyHandler is an [http.Handler] that creates its underlying handler by
+// calling the init on first use.
+type lazyHandler struct {
+	mu   sync.Mutex
+	init func() http.Handler
+	h    atomic.Pointer[http.Handler]
+}
+
+// ServeHTTP implements the [http.Handler].
+func (lh *lazyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h := lh.h.Load(); h != nil {
+		(*h).ServeHTTP(w, r)
+		return
+	}
+	lh.load().ServeHTTP(w, r)
+}
+
+// load returns the underlying handler of the lh, calling the lh.init if it
+// has not yet succeeded.
+func (lh *lazyHandler) load() http.Handler {
+	lh.mu.Lock()
+	defer lh.mu.Unlock()
+	if h := lh.h.Load(); h != nil {
+		return *h
+	}
+	h := lh.init()
+	if h == nil {
+		panic("http.ServeMux: lazy handler initializer returned a nil handler")
+	}
+	lh.h.Store(&h)
+	return h
+}
+
+// HandleGetHead registers the handler for both "GET " + pattern and
+// "HEAD " + pattern, with the response bodies of HEAD requests discarded. Unlike
+// the HEAD handler synthesized for a GET pattern, the HEAD pattern is
+// registered explicitly, so it is listed along with the GET one and kept until
+// deregistered by itself. The pattern must have no method. If either pattern
+// cannot be registered, HandleGetHead panics without registering any of them.
+func (mux *ServeMux) HandleGetHead(pattern string, handler http.Handler) {
+	if handler == nil {
+		panic("http.ServeMux: nil handler")
+	}
+	if method, _, _ := splitPattern(pattern); method != "" {
+		panic(fmt.Sprintf("http.ServeMux: pattern %q for HandleGetHead must have no method", pattern))
+	}
+
+	mux.mu.Lock()
+	defer mux.mu.Unlock()
+	if err := mux.handle(http.MethodGet+" "+pattern, handler, handleOptions{}); err != nil {
+		panic(err.Error())
+	}
+	if err := mux.handle(http.MethodHead+" "+pattern, headHandler{handler}, handleOptions{}); err != nil {
+		mux.deregister(http.MethodGet + " " + pattern)
+		panic(err.Error())
+	}
+}
+
+// HandleMethods registers the handler for the path with each of the methods,
+// as if calling the [ServeMux.Handle] with "METHOD path" for each method, but
+// under a single acquisition of the write lock. If any of the resulting
+// patterns cannot be registered, HandleMethods panics without registering any
+// of them.
+func (mux *ServeMux) HandleMethods(methods []string, path string, handler http.Handler) {
+	mux.mu.Lock()
+	defer mux.mu.Unlock()
+
+	if handler == nil {
+		panic("http.ServeMux: nil handler")
+	}
+
+	patterns := make([]string, len(methods))
+	seen := make(map[string]string, len(methods))
+	for i, method := range methods {
+		pattern := method + " " + path
+		if method == "" {
+			pattern = path
+		}
+		m, h, p, _, _, err := mux.parsePattern(pattern)
+		if err != nil {
+			panic(err.Error())
+		}
+		p, _, _ = splitOptionalPath(p)
+		cleanedPattern := m + " " + h + p
+		if registeredPattern, ok := mux.registeredPatterns[cleanedPattern]; ok {
+			panic(fmt.Sprintf("http.ServeMux: pattern %q conflicts with %q", pattern, registeredPattern))
+		}
+		if registeredPattern, ok := seen[cleanedPattern]; ok {
+			panic(fmt.Sprintf("http.ServeMux: pattern %q conflicts with %q", pattern, registeredPattern))
+		}
+		seen[cleanedPattern] = pattern
+		patterns[i] = pattern
+	}
+
+	for i, pattern := range patterns {
+		if err := mux.handle(pattern, handler, handleOptions{}); err != nil {
+			for j := i - 1; j >= 0; j-- {
+				mux.deregister(patterns[j])
+			}
+			panic(err.Error())
+		}
+	}
+}
+
+// HandleFuncMethods registers the handler function for the path with each of
+// the methods. See [ServeMux.HandleMethods].
+func (mux *ServeMux) HandleFuncMethods(methods []string, path string, handler func(http.ResponseWriter, *http.Request)) {
+	if handler == nil {
+		panic("http.ServeMux: nil handler")
+	}
+	mux.HandleMethods(methods, path, http.HandlerFunc(handler))
+}
+
+// SafeHandle is an alias of the [ServeMux.HandleE].
+func (mux *ServeMux) SafeHandle(pattern string, handler http.Handler) error {
+	return mux.HandleE(pattern, handler)
+}
+
+// RouteRegistration is a registration of a handler for a pattern.
+type RouteRegistration struct {
+	Pattern string
+	Handler http.Handler
+}
+
+// Subscribe spawns a goroutine that registers each [RouteRegistration]
+// received from the routes using the [ServeMux.SafeHandle], so that routes can
+// be fed into the mux by concurrent loaders. The mux keeps serving requests
+// while the routes are being registered.
+//
+// Registration errors are sent to the err without blocking the registration.
+// The err buffers up to 64 errors, and errors that do not fit are dropped, so
+// a caller interested in all of them must keep receiving from the err. When
+// the routes is closed, the err is closed and then the done is closed.
+func (mux *ServeMux) Subscribe(routes <-chan RouteRegistration) (done <-chan struct{}, err <-chan error) {
+	doneCh, errCh := make(chan struct{}), make(chan error, subscribeErrBufferSize)
+	go func() {
+		defer close(doneCh)
+		defer close(errCh)
+		for rr := range routes {
+			if err := mux.SafeHandle(rr.Pattern, rr.Handler); err != nil {
+				select {
+				case errCh <- err:
+				default:
+				}
+			}
+		}
+	}()
+	return doneCh, errCh
+}
+
+// subscribeErrBufferSize is the number of errors buffered by the err channel
+// returned by the [ServeMux.Subscribe].
+const subscribeErrBufferSize = 64
+
+// checkVarUsage checks whether the usedPathVarNames are exactly the named
+// pathVarNames of the pattern.
+func checkVarUsage(pattern string, pathVarNames, usedPathVarNames []string) error {
+	used := make(map[string]bool, len(usedPathVarNames))
+	for _, upvn := range usedPathVarNames {
+		used[upvn] = true
+	}
+
+	var unused []string
+	for _, pvn := range pathVarNames {
+		if pvn == "" {
+			continue
+		}
+		if used[pvn] {
+			delete(used, pvn)
+		} else {
+			unused = append(unused, pvn)
+		}
+	}
+
+	var unknown []string
+	for _, upvn := range usedPathVarNames {
+		if used[upvn] {
+			unknown = append(unknown, upvn)
+			delete(used, upvn)
+		}
+	}
+
+	switch {
+	case len(unused) > 0 && len(unknown) > 0:
+		return fmt.Errorf("http.ServeMux: pattern %q has path variables %q unused by its handler, which uses unknown path variables %q", pattern, unused, unknown)
+	case len(unused) > 0:
+		return fmt.Errorf("http.ServeMux: pattern %q has path variables %q unused by its handler", pattern, unused)
+	case len(unknown) > 0:
+		return fmt.Errorf("http.ServeMux: handler for pattern %q uses unknown path variables %q", pattern, unknown)
+	}
+	return nil
+}
+
+// Has reports whether a pattern identical to the given pattern has been
+// registered. Two patterns that differ only in the names of their variables
+// are considered identical.
+func (mux *ServeMux) Has(pattern string) bool {
+	mux.mu.RLock()
+	defer mux.mu.RUnlock()
+	return mux.has(pattern)
+}
+
+// has is the main implementation of the [ServeMux.Has]. The caller must hold
+// the mux.mu.
+func (mux *ServeMux) has(pattern string) bool {
+	method, host, path, _, _, err := mux.parsePattern(pattern)
+	if err != nil {
+		return false
+	}
+	path, _, _ = splitOptionalPath(path)
+	_, ok := mux.registeredPatterns[method+" "+host+path]
+	return ok
+}
+
+// RegisterOnce is like the [ServeMux.Handle], except that it silently does
+// nothing if a pattern identical to the given pattern has already been
+// registered. The check and the registration happen atomically.
+func (mux *ServeMux) RegisterOnce(pattern string, handler http.Handler) {
+	mux.mu.Lock()
+	defer mux.mu.Unlock()
+	if mux.has(pattern) {
+		return
+	}
+	if err := mux.handle(pattern, handler, handleOptions{}); err != nil {
+		panic(err.Error())
+	}
+}
+
+// RegisterOnceFunc is like the [ServeMux.RegisterOnce], but for a handler
+// function.
+func (mux *ServeMux) RegisterOnceFunc(pattern string, handler func(http.ResponseWriter, *http.Request)) {
+	if handler == nil {
+		panic("http.ServeMux: nil handler")
+	}
+	mux.RegisterOnce(pattern, http.HandlerFunc(handler))
+}
+
+// tsrHandlerTuple returns the internal [handlerTuple] that redirects request
+// paths like "/subtree" to "/subtree/" for the pattern.
+func tsrHandlerTuple(pattern string) *handlerTuple {
+	return &handlerTuple{
+		method:  "_tsr",
+		pattern: pattern,
+		handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Redirect(w, r, tsrURL(r), http.StatusMovedPermanently)
+		}),
+	}
+}
+
+// tsrURL returns the URL that the r is redirected to by the handler of a
+// [tsrHandlerTuple].
+func tsrURL(r *http.Request) string {
+	u := &url.URL{Path: r.URL.Path + "/", RawQuery: r.URL.RawQuery}
+	return u.String()
+}
+
+// SetCustomRedirectHandler sets the fn to be called instead of the
+// [http.Redirect] for the redirects issued by the mux, which are the ones to
+// the canonical forms of request paths and the ones from request paths like
+// "/subtree" to "/subtree/", so that they can be logged or customized, such as
+// with additional headers. Redirects issued by registered handlers are not
+// affected. A nil fn restores the [http.Redirect]. SetCustomRedirectHandler
+// panics if the mux has been precompiled.
+func (mux *ServeMux) SetCustomRedirectHandler(fn func(w http.ResponseWriter, r *http.Request, url string, code int)) {
+	mux.mu.Lock()
+	defer mux.mu.Unlock()
+	if mux.sealed.Load() {
+		panic(errPrecompiled.Error())
+	}
+	mux.redirectHandler = fn
+	if mux.cache != nil {
+		mux.cache.purge()
+	}
+}
+
+// loadRedirectHandler returns the mux.redirectHandler.
+func (mux *ServeMux) loadRedirectHandler() func(http.ResponseWriter, *http.Request, string, int) {
+	if !mux.sealed.Load() {
+		mux.mu.RLock()
+		defer mux.mu.RUnlock()
+	}
+	return mux.redirectHandler
+}
+
+// ErrPatternNotRegistered is returned by the [ServeMux.Deregister] when the
+// pattern has not been registered.
+var ErrPatternNotRegistered = errors.New("http.ServeMux: pattern not registered")
+
+// Deregister removes the pattern registered by the [ServeMux.Handle] or one of
+// its variants, along with the patterns registered internally for it. A
+// pattern identical to the registered one, such as one that differs only in
+// the names of its variables, removes it as well. If no such pattern has been
+// registered, Deregister returns an error wrapping the
+// [ErrPatternNotRegistered].
+func (mux *ServeMux) Deregister(pattern string) error {
+	mux.mu.Lock()
+	defer mux.mu.Unlock()
+	return mux.deregister(pattern)
+}
+
+// deregister is the main implementation of the [ServeMux.Deregister]. The
+// caller must hold the mux.mu.
+func (mux *ServeMux) deregister(pattern string) error {
+	if mux.sealed.Load() {
+		return errPrecompiled
+	}
+
+	method, host, path, _, _, err := mux.parsePattern(pattern)
+	if err != nil {
+		return err
+	}
+	path, shortPath, optional := splitOptionalPath(path)
+	cleanedPattern := method + " " + host + path
+	registeredPattern, ok := mux.registeredPatterns[cleanedPattern]
+	if !ok {
+		return fmt.Errorf("%w: %q", ErrPatternNotRegistered, pattern)
+	}
+
+	tree := mux.treeByHost(host)
+	n := tree.findNode(path)
+	n.removeHandlerTuple(method)
+	delete(mux.registeredPatterns, cleanedPattern)
+
+	// Restore the redirect that the pattern has overridden, if any.
+	if tsrPattern, ok := mux.registeredPatterns["_tsr "+host+path]; ok && !n.hasAtLeastOneHandler {
+		n.setHandlerTuple(tsrHandlerTuple(tsrPattern))
+	}
+
+	// Remove the redirect registered for the pattern, unless another
+	// pattern for the same path still needs it.
+	if strings.HasSuffix(path, "/{...}") {
+		tsrPath := strings.TrimRight(strings.TrimSuffix(path, "{...}"), "/")
+		tsrCleanedPattern := "_tsr " + host + tsrPath
+		if mux.registeredPatterns[tsrCleanedPattern] == registeredPattern {
+			if ht := n.anyHandlerTuple(); ht != nil {
+				mux.registeredPatterns[tsrCleanedPattern] = ht.registeredPattern()
+			} else {
+				delete(mux.registeredPatterns, tsrCleanedPattern)
+				if tn := tree.findNode(tsrPath); tn != nil &&
+					tn.catchAllHandlerTuple != nil &&
+					tn.catchAllHandlerTuple.method == "_tsr" {
+					tn.removeHandlerTuple("_tsr")
+					tn.prune()
+				}
+			}
+		}
+	}
+
+	n.prune()
+
+	// Remove the shorter path of patterns like "/users/{id?}" as well.
+	if optional {
+		sn := tree.findNode(shortPath)
+		sn.removeHandlerTuple(method)
+		delete(mux.registeredPatterns, method+" "+host+shortPath)
+		if tsrPattern, ok := mux.registeredPatterns["_tsr "+host+shortPath]; ok && !sn.hasAtLeastOneHandler {
+			sn.setHandlerTuple(tsrHandlerTuple(tsrPattern))
+		}
+		sn.prune()
+	}
+
+	for name, p := range mux.namedPatterns {
+		if p == registeredPattern {
+			delete(mux.namedPatterns, name)
+		}
+	}
+
+	if mux.cache != nil {
+		mux.cache.purge()
+	}
+	mux.notifyWatchers(RouteDeregistered, registeredPattern)
+
+	return nil
+}
+
+// Merge registers all patterns registered in the other into the mux, along
+// with their metadata and names, as if they were registered by the
+// [ServeMux.HandleNamed] or the [ServeMux.HandleWithMeta]. The settings,
+// middlewares and gRPC-Web patterns of the other are not merged.
+//
+// Merge is all or nothing: if any of the patterns or names cannot be
+// registered, such as because of a conflict, it returns the error and leaves
+// the mux untouched. Merge panics if the mux has been frozen by the
+// [ServeMux.Freeze].
+func (mux *ServeMux) Merge(other *ServeMux) error {
+	if other == mux {
+		return errors.New("http.ServeMux: cannot merge a mux into itself")
+	}
+
+	other.mu.RLock()
+	var hts []*handlerTuple
+	other.walk(func(ht *handlerTuple) bool {
+		hts = append(hts, ht)
+		return true
+	})
+	names := make(map[string]string, len(other.namedPatterns))
+	for name, pattern := range other.namedPatterns {
+		names[pattern] = name
+	}
+	other.mu.RUnlock()
+
+	mux.mu.Lock()
+	defer mux.mu.Unlock()
+	if mux.frozen {
+		panic(errFrozen.Error())
+	}
+
+	for _, ht := range hts {
+		if name, ok := names[ht.registeredPattern()]; ok {
+			if registeredPattern, ok := mux.namedPatterns[name]; ok {
+				return fmt.Errorf("http.ServeMux: name %q for pattern %q is already used by %q", name, ht.pattern, registeredPattern)
+			}
+		}
+	}
+
+	for i, ht := range hts {
+		opts := handleOptions{meta: ht.meta}
+		if ht.alias != "" {
+			opts.canonical = ht.pattern
+		}
+		if err := mux.handle(ht.registeredPattern(), ht.handler, opts); err != nil {
+			for j := i - 1; j >= 0; j-- {
+				mux.deregister(hts[j].registeredPattern())
+			}
+			return err
+		}
+	}
+
+	for _, ht := range hts {
+		if name, ok := names[ht.registeredPattern()]; ok {
+			if mux.namedPatterns == nil {
+				mux.namedPatterns = map[string]string{}
+			}
+			mux.namedPatterns[name] = ht.pattern
+		}
+	}
+
+	return nil
+}
+
+// HandleAlias registers the alias pattern for the handler registered for the
+// canonical pattern, so that old URLs keep working after a change of URL
+// structure. Requests matching the alias are reported as matching the
+// canonical pattern, such as by the [ServeMux.Handler] and the
+// [MatchedPattern], and [ServeMux.ReplaceHandler] on the canonical pattern
+// replaces the handler of the alias as well. The alias should have the same
+// path variable names as the canonical pattern, since the handler is shared.
+//
+// It returns an error wrapping the [ErrPatternNotRegistered] if the canonical
+// pattern is not registered, or the same error that [ServeMux.HandleE] would
+// return if the alias cannot be registered. Deregistering the canonical
+// pattern does not deregister the alias.
+func (mux *ServeMux) HandleAlias(canonical, alias string) error {
+	mux.mu.Lock()
+	defer mux.mu.Unlock()
+	_, ht, err := mux.registeredHandlerTuple(canonical)
+	if err != nil {
+		return err
+	}
+	return mux.handle(alias, ht.handler, handleOptions{meta: ht.meta, canonical: ht.pattern})
+}
+
+// HandlerAt returns the handler registered for the pattern, as it was
+// registered, without the middlewares added by the [ServeMux.Use], the
+// [Group.Use] or the [Route.Use]. The pattern does not have to be identical to
+// the registered one, as long as they are considered identical. It returns
+// false if not found.
+func (mux *ServeMux) HandlerAt(pattern string) (http.Handler, bool) {
+	mux.mu.RLock()
+	defer mux.mu.RUnlock()
+	_, ht, err := mux.registeredHandlerTuple(pattern)
+	if err != nil {
+		return nil, false
+	}
+	h := ht.handler
+	if ht.routeHandler != nil {
+		h = ht.routeHandler
+	}
+	if gh, ok := h.(*groupHandler); ok {
+		return gh.h, true
+	}
+	return h, true
+}
+
+// ReplaceHandler replaces the handler registered for the pattern with the
+// handler, keeping everything else about the registration, such as its
+// metadata and name. The middlewares added by the [ServeMux.Use] wrap the new
+// handler, and requests already being handled keep using the old one. The
+// pattern does not have to be identical to the registered one, as long as
+// they are considered identical.
+//
+// It returns an error wrapping the [ErrPatternNotRegistered] if the pattern
+// is not registered, or an error if the handler is nil or the mux has been
+// precompiled.
+func (mux *ServeMux) ReplaceHandler(pattern string, handler http.Handler) error {
+	if handler == nil {
+		return errors.New("http.ServeMux: nil handler")
+	}
+
+	mux.mu.Lock()
+	defer mux.mu.Unlock()
+	if mux.sealed.Load() {
+		return errPrecompiled
+	}
+
+	return mux.amendHandlerTuple(pattern, func(ht *handlerTuple) {
+		// The body limit and the middlewares added by the Route.Use of the
+		// old handler, if any, are gone with it.
+		ht.handler, ht.bodyLimited = handler, false
+		ht.routeHandler, ht.routeMiddlewares = nil, nil
+	})
+}
+
+// amendHandlerTuple replaces the [handlerTuple] registered for the pattern,
+// and those of its aliases, with copies amended by the amend. The caller must
+// hold the mux.mu.
+func (mux *ServeMux) amendHandlerTuple(pattern string, amend func(ht *handlerTuple)) error {
+	n, ht, err := mux.registeredHandlerTuple(pattern)
+	if err != nil {
+		return err
+	}
+
+	// Replace the handlerTuple rather than modifying it, since it may be
+	// shared with clones of the mux.
+	nht := *ht
+	amend(&nht)
+	n.setHandlerTuple(&nht)
+	if nht.optional {
+		mux.shortPathNode(&nht).setHandlerTuple(&nht)
+	}
+
+	// Amend the aliases of the pattern as well.
+	if ht.alias == "" {
+		var aliases []*handlerTuple
+		mux.walk(func(aht *handlerTuple) bool {
+			if aht.alias != "" && aht.pattern == ht.pattern {
+				aliases = append(aliases, aht)
+			}
+			return true
+		})
+		for _, aht := range aliases {
+			an, _, _ := mux.registeredHandlerTuple(aht.alias)
+			naht := *aht
+			amend(&naht)
+			an.setHandlerTuple(&naht)
+			if naht.optional {
+				mux.shortPathNode(&naht).setHandlerTuple(&naht)
+			}
+		}
+	}
+
+	if mux.cache != nil {
+		mux.cache.purge()
+	}
+
+	return nil
+}
+
+// shortPathNode returns the node holding the ht for the shorter path of its
+// pattern like "/users/{id?}". The caller must hold the mux.mu.
+func (mux *ServeMux) shortPathNode(ht *handlerTuple) *serveMuxNode {
+	_, host, path, _, _, _ := mux.parsePattern(ht.registeredPattern())
+	_, shortPath, _ := splitOptionalPath(path)
+	return mux.treeByHost(host).findNode(shortPath)
+}
+
+// registeredHandlerTuple returns the [handlerTuple] registered for the
+// pattern and the node holding it. It returns an error if the pattern is
+// invalid or not registered. The caller must hold the mux.mu.
+func (mux *ServeMux) registeredHandlerTuple(pattern string) (*serveMuxNode, *handlerTuple, error) {
+	method, host, path, _, _, err := mux.parsePattern(pattern)
+	if err != nil {
+		return nil, nil, err
+	}
+	path, _, _ = splitOptionalPath(path)
+	if _, ok := mux.registeredPatterns[method+" "+host+path]; !ok {
+		return nil, nil, fmt.Errorf("%w: %q", ErrPatternNotRegistered, pattern)
+	}
+
+	n := mux.treeByHost(host).findNode(path)
+	if method == "" {
+		return n, n.catchAllHandlerTuple, nil
+	}
+	return n, n.methodHandlerTuple(method), nil
+}
+
+// treeByHost returns the tree for the denamed host. It returns nil if not
+// found. The caller must hold the mux.mu.
+func (mux *ServeMux) treeByHost(host string) *serveMuxNode {
+	if host == "" {
+		return mux.tree
+	}
+	if tree := mux.hostTrees[host]; tree != nil {
+		return tree
+	}
+	for _, vht := range mux.varHostTrees {
+		if vht.host == host {
+			return vht.tree
+		}
+	}
+	return nil
+}
+
+// insert inserts nodes into the tree.
+func (mux *ServeMux) insert(tree *serveMuxNode, nt serveMuxNodeType, path string, ht *handlerTuple) {
+	var (
+		s  = path        // Search
+		sl int           // Search length
+		pl int           // Prefix length
+		ll int           // LCP length
+		ml int           // Minimum length of the sl and pl
+		cn = tree        // Current node
+		nn *serveMuxNode // Next node
+	)
+
+	for {
+		sl, pl, ll = len(s), len(cn.prefix), 0
+		if sl < pl {
+			ml = sl
+		} else {
+			ml = pl
+		}
+
+		for ; ll < ml && s[ll] == cn.prefix[ll]; ll++ {
+		}
+
+		if s == "" { // At root node
+			if ht != nil {
+				cn.typ = nt
+				cn.setHandlerTuple(ht)
+			}
+		} else if ll < pl { // Split node
+			nn = &serveMuxNode{
+				prefix:                   cn.prefix[ll:],
+				label:                    cn.prefix[ll],
+				typ:                      cn.typ,
+				parent:                   cn,
+				constraint:               cn.constraint,
+				nonvarChildren:           cn.nonvarChildren,
+				constrainedVarChildren:   cn.constrainedVarChildren,
+				unmodifiedVarChild:       cn.unmodifiedVarChild,
+				ellipsisModifiedVarChild: cn.ellipsisModifiedVarChild,
+				hasAtLeastOneChild:       cn.hasAtLeastOneChild,
+				handlerTuples:            cn.handlerTuples,
+				catchAllHandlerTuple:     cn.catchAllHandlerTuple,
+				hasAtLeastOneHandler:     cn.hasAtLeastOneHandler,
+			}
+
+			for _, n := range nn.nonvarChildren {
+				if n != nil {
+					n.parent = nn
+				}
+			}
+
+			for _, n := range nn.constrainedVarChildren {
+				n.parent = nn
+			}
+
+			if nn.unmodifiedVarChild != nil {
+				nn.unmodifiedVarChild.parent = nn
+			}
+
+			if nn.ellipsisModifiedVarChild != nil {
+				nn.ellipsisModifiedVarChild.parent = nn
+			}
+
+			// Reset current node.
+			cn.prefix = cn.prefix[:ll]
+			cn.label = cn.prefix[0]
+			cn.typ = nonvarServeMuxNode
+			cn.constraint = nil
+			cn.nonvarChildren = make([]*serveMuxNode, 255)
+			cn.constrainedVarChildren = nil
+			cn.unmodifiedVarChild = nil
+			cn.ellipsisModifiedVarChild = nil
+			cn.hasAtLeastOneChild = false
+			cn.handlerTuples = nil
+			cn.catchAllHandlerTuple = nil
+			cn.hasAtLeastOneHandler = false
+			cn.addChild(nn)
+
+			if ll == sl { // At current node
+				cn.typ = nt
+				if ht != nil {
+					cn.setHandlerTuple(ht)
+				}
+			} else { // Create child node
+				nn = &serveMuxNode{
+					prefix:         s[ll:],
+					label:          s[ll],
+					typ:            nt,
+					parent:         cn,
+					nonvarChildren: make([]*serveMuxNode, 255),
+				}
+				if ht != nil {
+					nn.setHandlerTuple(ht)
+				}
+				cn.addChild(nn)
+			}
+		} else if ll < sl {
+			s = s[ll:]
+
+			nn = nil
 			if s[0] != '{' {
 				nn = cn.nonvarChildren[s[0]]
 			} else if s[1] == '}' {
 				nn = cn.unmodifiedVarChild
+			} else if s[1] == ':' {
+				nn = cn.constrainedVarChild(s)
 			} else {
 				nn = cn.ellipsisModifiedVarChild
 			}
@@ -354,6 +1600,9 @@ func (mux *ServeMux) insert(tree *serveMuxNode, nt serveMuxNodeType, path string
 				parent:         cn,
 				nonvarChildren: make([]*serveMuxNode, 255),
 			}
+			if nt == constrainedVarServeMuxNode {
+				nn.constraint = compileConstraint(s[2 : len(s)-1])
+			}
 			if ht != nil {
 				nn.setHandlerTuple(ht)
 			}
@@ -366,12 +1615,22 @@ func (mux *ServeMux) insert(tree *serveMuxNode, nt serveMuxNodeType, path string
 	}
 }
 
-// HandleFunc registers the handler function for the given pattern.
-func (mux *ServeMux) HandleFunc(pattern string, handler func(http.ResponseWriter, *http.Request)) {
+// HandleFunc registers the handler function for the given pattern. Like the
+// [ServeMux.Handle], it returns a [Route] of the registration.
+func (mux *ServeMux) HandleFunc(pattern string, handler func(http.ResponseWriter, *http.Request)) *Route {
 	if handler == nil {
 		panic("http.ServeMux: nil handler")
 	}
-	mux.Handle(pattern, http.HandlerFunc(handler))
+	return mux.Handle(pattern, http.HandlerFunc(handler))
+}
+
+// HandleFuncE is like the [ServeMux.HandleFunc], except that it returns an
+// error instead of panicking. See the [ServeMux.HandleE].
+func (mux *ServeMux) HandleFuncE(pattern string, handler func(http.ResponseWriter, *http.Request)) error {
+	if handler == nil {
+		return errors.New("http.ServeMux: nil handler")
+	}
+	return mux.HandleE(pattern, http.HandlerFunc(handler))
 }
 
 // Handler returns the handler to use for the given request, consulting
@@ -382,47 +1641,669 @@ func (mux *ServeMux) HandleFunc(pattern string, handler func(http.ResponseWriter
 //
 // ...
 func (mux *ServeMux) Handler(r *http.Request) (h http.Handler, pattern string) {
-	var path string
-	if r.Method != http.MethodConnect {
-		path = cleanPath(r.URL.Path)
+	h, ht := mux.findHandler(r)
+	if ht != nil {
+		pattern = ht.pattern
+	}
+	return
+}
+
+// findHandler is like the [ServeMux.Handler], but it returns the matched
+// [handlerTuple] instead of its pattern, which is nil if not found.
+func (mux *ServeMux) findHandler(r *http.Request) (h http.Handler, ht *handlerTuple) {
+	path := mux.cleanRequestPath(r.Method, r.URL.Path)
+	h, ht = mux.handler(path, r)
+	if path != r.URL.Path && !mux.noPathCleaning.Load() {
+		if mux.caseInsensitive {
+			path = foldPathCase(path, ht)
+		}
+		u := (&url.URL{Path: path, RawQuery: r.URL.RawQuery}).String()
+		if redirect := mux.loadRedirectHandler(); redirect != nil {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				redirect(w, r, u, http.StatusMovedPermanently)
+			}), ht
+		}
+		return http.RedirectHandler(u, http.StatusMovedPermanently), ht
+	}
+	return
+}
+
+// cleanRequestPath returns the path of a request with the method as it is
+// matched, which is the canonical form of the path unless the method is
+// CONNECT or the path cleaning of the mux has been disabled.
+func (mux *ServeMux) cleanRequestPath(method, path string) string {
+	if mux.noPathCleaning.Load() {
+		if path == "" {
+			return "/"
+		}
+		return path
+	}
+	if method == http.MethodConnect {
+		return path
+	}
+	return cleanPath(path)
+}
+
+// DisablePathCleaning makes the mux match request paths as they are, without
+// eliminating "." and ".." elements or repeated slashes, so that request paths
+// like "/a//b" reach the handler unchanged rather than being redirected to
+// their canonical form. Patterns registered afterwards log a warning once,
+// since they may no longer match such request paths as expected.
+// DisablePathCleaning panics if the mux has been precompiled.
+func (mux *ServeMux) DisablePathCleaning() {
+	mux.mu.Lock()
+	defer mux.mu.Unlock()
+	if mux.sealed.Load() {
+		panic(errPrecompiled.Error())
+	}
+	mux.noPathCleaning.Store(true)
+	if mux.cache != nil {
+		mux.cache.purge()
+	}
+}
+
+// SetMaxBodySize limits the request bodies read by the handlers to n bytes
+// using the [http.MaxBytesReader], as the [ServeMux.HandleWithBodyLimit] does,
+// except for the patterns registered with their own limits using the
+// [ServeMux.HandleWithBodyLimit] or the [WithBodyLimit]. Handlers that replace
+// the request bodies themselves are not limited. A zero n disables the limit.
+// SetMaxBodySize panics if the mux has been precompiled.
+func (mux *ServeMux) SetMaxBodySize(n int64) {
+	if n < 0 {
+		panic("http.ServeMux: negative body limit")
+	}
+	mux.mu.Lock()
+	defer mux.mu.Unlock()
+	if mux.sealed.Load() {
+		panic(errPrecompiled.Error())
+	}
+	mux.maxBodySize.Store(n)
+}
+
+// handler is the main implementation of the [ServeMux.findHandler].
+func (mux *ServeMux) handler(path string, r *http.Request) (h http.Handler, ht *handlerTuple) {
+	pathVars, _ := r.Context().Value(pathVarsContextKey).(map[string]string)
+	hostVars, _ := r.Context().Value(hostVarsContextKey).(*[]string)
+	pathVarValues, _ := r.Context().Value(pathVarValuesContextKey).(*[]string)
+
+	// A precompiled mux is immutable, so it can be read without locking.
+	if !mux.sealed.Load() {
+		mux.mu.RLock()
+		defer mux.mu.RUnlock()
+	}
+	if mux.cache != nil && (mux.grpcWeb == nil || !isGRPCWebRequest(r)) {
+		h, ht = mux.cachedLookup(path, r, pathVars, hostVars, pathVarValues)
 	} else {
-		path = r.URL.Path
+		h, ht = mux.lookup(path, r, pathVars, hostVars, pathVarValues)
+	}
+	if h == nil {
+		return mux.notFoundHandler(), nil
+	}
+	if ht != nil && ht.method == "_tsr" && mux.redirectHandler != nil {
+		redirect := mux.redirectHandler
+		h = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			redirect(w, r, tsrURL(r), http.StatusMovedPermanently)
+		})
 	}
-	h, pattern = mux.handler(path, r)
-	if path != r.URL.Path {
-		u := &url.URL{Path: path, RawQuery: r.URL.RawQuery}
-		return http.RedirectHandler(u.String(), http.StatusMovedPermanently), pattern
+	if ht != nil {
+		for i := len(mux.middlewares) - 1; i >= 0; i-- {
+			h = mux.middlewares[i](h)
+		}
 	}
 	return
 }
 
-// handler is the main implementation of the [mux.Handler].
-func (mux *ServeMux) handler(path string, r *http.Request) (h http.Handler, pattern string) {
-	mux.mu.RLock()
-	defer mux.mu.RUnlock()
-	if len(mux.hostTrees) > 0 {
-		var tree *serveMuxNode
+// lookup finds the handler and the matched [handlerTuple] for the path and r
+// from all trees. It returns nil if not found, and a nil [handlerTuple] if
+// the handler is an internally-generated one that responds with an error. The
+// resolved path variables and host variables are stored in the pathVars and
+// hostVars if they are not nil, and the values of all the resolved path
+// variables are stored in the pathVarValues in order if it is not nil. The
+// caller must hold the mux.mu.
+func (mux *ServeMux) lookup(path string, r *http.Request, pathVars map[string]string, hostVars, pathVarValues *[]string) (h http.Handler, ht *handlerTuple) {
+	if mux.grpcWeb != nil && isGRPCWebRequest(r) {
+		if !mux.grpcWeb.sealed.Load() {
+			mux.grpcWeb.mu.RLock()
+		}
+		h, ht = mux.grpcWeb.lookup(path, r, pathVars, hostVars, pathVarValues)
+		if !mux.grpcWeb.sealed.Load() {
+			mux.grpcWeb.mu.RUnlock()
+		}
+		if ht != nil {
+			return
+		}
+	}
+	method := r.Method
+	if mux.methodOverride {
+		method = overriddenMethod(r)
+	}
+	if len(mux.hostTrees) > 0 || len(mux.varHostTrees) > 0 {
+		host := r.Host
 		if r.Method != http.MethodConnect {
-			tree = mux.hostTrees[stripHostPort(r.Host)]
-		} else {
-			tree = mux.hostTrees[r.Host]
+			host = stripHostPort(host)
 		}
-		if tree != nil {
-			if h, pattern = mux.match(tree, path, r); h != nil {
+		if to, ok := mux.hostAliases[host]; ok {
+			host = to
+		}
+		if tree := mux.hostTrees[host]; tree != nil {
+			if h, ht = mux.match(tree, method, path, pathVars, pathVarValues); h != nil {
 				return
 			}
 		}
+		if len(mux.varHostTrees) > 0 {
+			labels := strings.Split(host, ".")
+			for _, vht := range mux.varHostTrees {
+				values, ok := vht.matchLabels(labels)
+				if !ok {
+					continue
+				}
+				if h, ht = mux.match(vht.tree, method, path, pathVars, pathVarValues); h != nil {
+					if hostVars != nil {
+						*hostVars = values
+					}
+					if pathVars != nil && ht != nil {
+						for i, name := range ht.hostVarNames {
+							if name != "" {
+								pathVars[name] = values[i]
+							}
+						}
+						if _, ok := pathVars["subdomain"]; !ok {
+							pathVars["subdomain"] = values[0]
+						}
+					}
+					return
+				}
+			}
+		}
 	}
 	if mux.tree != nil {
-		if h, pattern = mux.match(mux.tree, path, r); h != nil {
+		if h, ht = mux.match(mux.tree, method, path, pathVars, pathVarValues); h != nil {
 			return
 		}
 	}
-	return mux.notFoundHandler(), ""
+	return nil, nil
+}
+
+// cachedLookup is like the [ServeMux.lookup], but it checks the mux.cache
+// first and caches the result if the path matches a registered pattern. The
+// caller must hold the mux.mu.
+func (mux *ServeMux) cachedLookup(path string, r *http.Request, pathVars map[string]string, hostVars, pathVarValues *[]string) (h http.Handler, ht *handlerTuple) {
+	method := r.Method
+	if mux.methodOverride {
+		method = overriddenMethod(r)
+	}
+	key := routeCacheKey{method: method, host: r.Host, path: path}
+	if rce, ok := mux.cache.get(key); ok {
+		if pathVars != nil {
+			for k, v := range rce.pathVars {
+				pathVars[k] = v
+			}
+		}
+		if hostVars != nil {
+			*hostVars = append((*hostVars)[:0], rce.hostVars...)
+		}
+		if pathVarValues != nil {
+			*pathVarValues = append((*pathVarValues)[:0], rce.pathVarValues...)
+		}
+		return rce.h, rce.ht
+	}
+
+	// Without the pathVars and the hostVars, the resolved variables are
+	// unknown. And if the pathVars were already populated, such as by an
+	// outer mux, they cannot be told apart from the resolved ones. Either
+	// way, the result cannot be cached.
+	cacheable := pathVars != nil && len(pathVars) == 0 && hostVars != nil && pathVarValues != nil
+
+	h, ht = mux.lookup(path, r, pathVars, hostVars, pathVarValues)
+	if ht != nil && cacheable {
+		rce := &routeCacheEntry{
+			key:           key,
+			h:             h,
+			ht:            ht,
+			pathVars:      make(map[string]string, len(pathVars)),
+			hostVars:      append([]string(nil), *hostVars...),
+			pathVarValues: append([]string(nil), *pathVarValues...),
+		}
+		for k, v := range pathVars {
+			rce.pathVars[k] = v
+		}
+		mux.cache.add(rce)
+	}
+	return
+}
+
+// Walk calls the fn for each registered pattern with its method, host, path and
+// handler, visiting the hostless tree first, then the trees of the hosts in
+// lexical order, and then the trees of the hosts with variable labels. Within
+// a tree, patterns are visited in depth-first order. Internally registered
+// patterns are skipped.
+//
+// If the fn returns a non-nil error, Walk stops immediately and returns that
+// error. The walk holds the read lock of the mux, so the fn must not register
+// patterns.
+func (mux *ServeMux) Walk(fn func(method, host, path, pattern string, handler http.Handler) error) error {
+	mux.mu.RLock()
+	defer mux.mu.RUnlock()
+	var err error
+	mux.walk(func(ht *handlerTuple) bool {
+		err = fn(ht.method, ht.host, ht.path, ht.registeredPattern(), ht.handler)
+		return err == nil
+	})
+	return err
+}
+
+// SortedWalk is like the [ServeMux.Walk], but it visits the registered patterns
+// in lexical order of the pattern strings, so that route dumps are stable and
+// diffable regardless of the tree layout. The patterns are collected under the
+// read lock of the mux before any call to the fn, so the fn may register
+// patterns, though they are not visited.
+func (mux *ServeMux) SortedWalk(fn func(method, host, path, pattern string, handler http.Handler) error) error {
+	mux.mu.RLock()
+	var hts []*handlerTuple
+	mux.walk(func(ht *handlerTuple) bool {
+		hts = append(hts, ht)
+		return true
+	})
+	mux.mu.RUnlock()
+
+	sort.Slice(hts, func(i, j int) bool { return hts[i].registeredPattern() < hts[j].registeredPattern() })
+	for _, ht := range hts {
+		if err := fn(ht.method, ht.host, ht.path, ht.registeredPattern(), ht.handler); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ForEachPattern calls the fn with each registered pattern and its handler, in
+// the order described in the [ServeMux.SortedWalk]. If the fn returns false,
+// the iteration stops. The redirects and HEAD handlers registered internally
+// are not visited.
+func (mux *ServeMux) ForEachPattern(fn func(pattern string, handler http.Handler) bool) {
+	mux.SortedWalk(func(_, _, _, pattern string, handler http.Handler) error {
+		if !fn(pattern, handler) {
+			return errStopForEachPattern
+		}
+		return nil
+	})
+}
+
+// errStopForEachPattern is used to stop the [ServeMux.SortedWalk] in the
+// [ServeMux.ForEachPattern].
+var errStopForEachPattern = errors.New("http.ServeMux: stop ForEachPattern")
+
+// walk calls the fn for each [handlerTuple] of the registered patterns in the
+// order described in the [ServeMux.Walk]. If the fn returns false, the walk
+// stops and walk returns false. The caller must hold the mux.mu.
+func (mux *ServeMux) walk(fn func(ht *handlerTuple) bool) bool {
+	// The handlerTuples of patterns like "/users/{id?}" are held by two
+	// nodes, but they are visited only once.
+	var visited map[*handlerTuple]bool
+	visit := fn
+	fn = func(ht *handlerTuple) bool {
+		if ht.optional {
+			if visited[ht] {
+				return true
+			}
+			if visited == nil {
+				visited = map[*handlerTuple]bool{}
+			}
+			visited[ht] = true
+		}
+		return visit(ht)
+	}
+
+	if mux.tree != nil && !mux.tree.walk(fn) {
+		return false
+	}
+
+	hosts := make([]string, 0, len(mux.hostTrees))
+	for host := range mux.hostTrees {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	for _, host := range hosts {
+		if !mux.hostTrees[host].walk(fn) {
+			return false
+		}
+	}
+
+	for _, vht := range mux.varHostTrees {
+		if !vht.tree.walk(fn) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Match reports the pattern that the r would be dispatched to, along with the
+// path variables resolved for it, without calling any handler or modifying the
+// r. The returned pathVars is freshly allocated for each call. If the r does
+// not match any pattern, ok is false and the pattern is empty.
+func (mux *ServeMux) Match(r *http.Request) (pattern string, pathVars map[string]string, ok bool) {
+	path := mux.cleanRequestPath(r.Method, r.URL.Path)
+
+	pathVars = map[string]string{}
+
+	mux.mu.RLock()
+	defer mux.mu.RUnlock()
+	_, ht := mux.lookup(path, r, pathVars, nil, nil)
+	if ht == nil {
+		return "", nil, false
+	}
+	return ht.pattern, pathVars, true
+}
+
+var (
+	// ErrNotFound is returned by the [ServeMux.RouteFor] when no pattern
+	// matches.
+	ErrNotFound = errors.New("http.ServeMux: no pattern matches")
+
+	// ErrMethodNotAllowed is returned by the [ServeMux.RouteFor] when
+	// patterns match the host and path, but none of them allows the method.
+	ErrMethodNotAllowed = errors.New("http.ServeMux: method not allowed")
+)
+
+// RouteFor is like the [ServeMux.Handler], but it takes the method, host and
+// path instead of a request, for dispatching outside of HTTP, such as from
+// message queues. It returns the handler wrapped by the middlewares of the
+// mux, the matched pattern and the path variables resolved for it, which are
+// freshly allocated for each call. The path is matched in its canonical form
+// rather than being redirected to it. If no pattern matches, it returns the
+// [ErrNotFound] or the [ErrMethodNotAllowed].
+func (mux *ServeMux) RouteFor(method, host, path string) (http.Handler, string, map[string]string, error) {
+	path = mux.cleanRequestPath(method, path)
+	r := &http.Request{
+		Method: method,
+		Host:   host,
+		URL:    &url.URL{Path: path},
+		Header: http.Header{},
+	}
+	pathVars := map[string]string{}
+
+	mux.mu.RLock()
+	defer mux.mu.RUnlock()
+	h, ht := mux.lookup(path, r, pathVars, nil, nil)
+	switch {
+	case h == nil:
+		return nil, "", nil, ErrNotFound
+	case ht == nil:
+		return nil, "", nil, ErrMethodNotAllowed
+	}
+	for i := len(mux.middlewares) - 1; i >= 0; i-- {
+		h = mux.middlewares[i](h)
+	}
+	return h, ht.pattern, pathVars, nil
+}
+
+// Clone returns a deep copy of the mux. Registering patterns or changing the
+// settings of either one afterwards does not affect the other. The handlers
+// themselves are shared.
+func (mux *ServeMux) Clone() *ServeMux {
+	mux.mu.RLock()
+	defer mux.mu.RUnlock()
+
+	c := &ServeMux{
+		maxPathVars:             mux.maxPathVars,
+		grpcWebAdapter:          mux.grpcWebAdapter,
+		panicEncoder:            mux.panicEncoder,
+		panicHandler:            mux.panicHandler,
+		redirectHandler:         mux.redirectHandler,
+		strictVarUsage:          mux.strictVarUsage,
+		caseInsensitive:         mux.caseInsensitive,
+		noTrailingSlashRedirect: mux.noTrailingSlashRedirect,
+		noAutoOptions:           mux.noAutoOptions,
+		methodOverride:          mux.methodOverride,
+		silentPatternOverlap:    mux.silentPatternOverlap,
+		logger:                  mux.logger,
+		logAttrs:                mux.logAttrs,
+		metricsReporters:        append([](func(string, string, int, time.Duration))(nil), mux.metricsReporters...),
+		notFound:                mux.notFound,
+		methodNotAllowed:        mux.methodNotAllowed,
+		middlewares:             append([]func(http.Handler) http.Handler(nil), mux.middlewares...),
+		preRoutingMiddlewares:   append([]func(http.Handler) http.Handler(nil), mux.preRoutingMiddlewares...),
+	}
+	c.buildPreRoutingHandler()
+	c.noPathCleaning.Store(mux.noPathCleaning.Load())
+	c.maxBodySize.Store(mux.maxBodySize.Load())
+	c.pathCleaningWarned = mux.pathCleaningWarned
+	if mux.tree != nil {
+		c.tree = mux.tree.clone(nil)
+		c.hostTrees = make(map[string]*serveMuxNode, len(mux.hostTrees))
+		for host, tree := range mux.hostTrees {
+			c.hostTrees[host] = tree.clone(nil)
+		}
+		c.registeredPatterns = make(map[string]string, len(mux.registeredPatterns))
+		for k, v := range mux.registeredPatterns {
+			c.registeredPatterns[k] = v
+		}
+	}
+	for _, vht := range mux.varHostTrees {
+		c.varHostTrees = append(c.varHostTrees, &varHostTree{
+			host:   vht.host,
+			labels: vht.labels,
+			tree:   vht.tree.clone(nil),
+		})
+	}
+	if mux.cache != nil {
+		c.cache = newRouteCache(mux.cache.size)
+	}
+	if len(mux.hostAliases) > 0 {
+		c.hostAliases = make(map[string]string, len(mux.hostAliases))
+		for from, to := range mux.hostAliases {
+			c.hostAliases[from] = to
+		}
+	}
+	if len(mux.pathVarValidators) > 0 {
+		c.pathVarValidators = make(map[string][]func(string) bool, len(mux.pathVarValidators))
+		for name, validators := range mux.pathVarValidators {
+			c.pathVarValidators[name] = append([]func(string) bool(nil), validators...)
+		}
+	}
+	if l := c.maxPathVars; l > 0 {
+		c.pathVarValuesPool = sync.Pool{New: func() any { return make([]string, l) }}
+	}
+	if mux.grpcWeb != nil {
+		c.grpcWeb = mux.grpcWeb.Clone()
+	}
+	if mux.namedPatterns != nil {
+		c.namedPatterns = make(map[string]string, len(mux.namedPatterns))
+		for k, v := range mux.namedPatterns {
+			c.namedPatterns[k] = v
+		}
+	}
+	return c
+}
+
+// SwapTree replaces all patterns registered with the mux, along with their
+// names, with a copy of those registered with the newMux, in a single
+// acquisition of the write lock of the mux. Requests being matched at that
+// time finish matching against either the old or the new patterns. The
+// settings, middlewares and gRPC-Web patterns of the mux are kept. Later
+// changes to the newMux do not affect the mux. The newMux should be created
+// with the same options as the mux, such as the [WithCaseInsensitive], since
+// its patterns are taken as they were registered with it. SwapTree panics if
+// the newMux is nil or the mux has been precompiled.
+func (mux *ServeMux) SwapTree(newMux *ServeMux) {
+	if newMux == nil {
+		panic("http.ServeMux: nil mux")
+	}
+	c := newMux.Clone()
+
+	mux.mu.Lock()
+	defer mux.mu.Unlock()
+	if mux.sealed.Load() {
+		panic(errPrecompiled.Error())
+	}
+
+	mux.notifyWatchersOfAll(RouteDeregistered)
+	mux.tree = c.tree
+	mux.hostTrees = c.hostTrees
+	mux.varHostTrees = c.varHostTrees
+	mux.registeredPatterns = c.registeredPatterns
+	mux.namedPatterns = c.namedPatterns
+	mux.maxPathVars = c.maxPathVars
+	if l := mux.maxPathVars; l > 0 {
+		mux.pathVarValuesPool = sync.Pool{New: func() any { return make([]string, l) }}
+	} else {
+		mux.pathVarValuesPool = sync.Pool{}
+	}
+	if mux.cache != nil {
+		mux.cache.purge()
+	}
+	mux.notifyWatchersOfAll(RouteRegistered)
+}
+
+// Reset deregisters all patterns from the mux, including those registered by
+// the [ServeMux.HandleGRPCWeb] and the names given by the
+// [ServeMux.HandleNamed], so that it matches requests just like a mux freshly
+// created with the same options. The middlewares, the path variable
+// validators, the host aliases and the not found and method not allowed
+// handlers are kept. Reset panics if the mux has been precompiled. A mux
+// frozen by the [ServeMux.Freeze] is unfrozen.
+func (mux *ServeMux) Reset() {
+	mux.mu.Lock()
+	defer mux.mu.Unlock()
+	if mux.sealed.Load() {
+		panic(errPrecompiled.Error())
+	}
+
+	mux.notifyWatchersOfAll(RouteDeregistered)
+	mux.tree = nil
+	mux.hostTrees = nil
+	mux.varHostTrees = nil
+	mux.registeredPatterns = nil
+	mux.maxPathVars = 0
+	mux.pathVarValuesPool = sync.Pool{}
+	mux.grpcWeb = nil
+	mux.namedPatterns = nil
+	mux.frozen = false
+	if mux.cache != nil {
+		mux.cache.purge()
+	}
+}
+
+// AddPathVarValidator adds the validate to be called at match time with the
+// value of every path variable named varName. If any validator of a path
+// variable returns false, the pattern does not match, and the request falls
+// through to the next matching pattern, or to a 404 if there is none.
+// Validators of the same name are all called, in the order they were added.
+func (mux *ServeMux) AddPathVarValidator(varName string, validate func(value string) bool) {
+	if validate == nil {
+		panic("http.ServeMux: nil path variable validator")
+	}
+	mux.mu.Lock()
+	defer mux.mu.Unlock()
+	if mux.sealed.Load() {
+		panic(errPrecompiled.Error())
+	}
+	if mux.pathVarValidators == nil {
+		mux.pathVarValidators = map[string][]func(string) bool{}
+	}
+	mux.pathVarValidators[varName] = append(mux.pathVarValidators[varName], validate)
+	if mux.cache != nil {
+		mux.cache.purge()
+	}
+}
+
+// AddHostAlias makes the mux match requests for the host from as if they were
+// for the host to, so that the patterns registered with the host to, such as
+// "example.com/", also serve requests for the host from, such as
+// "www.example.com". A host can have any number of aliases. Registering a
+// pattern with the host from afterwards panics. AddHostAlias panics if the
+// from and to are the same or empty, if the from already has registered
+// patterns, if either of them is already an alias of another host or has
+// aliases, respectively, or if the mux has been precompiled.
+func (mux *ServeMux) AddHostAlias(from, to string) {
+	mux.mu.Lock()
+	defer mux.mu.Unlock()
+	if mux.sealed.Load() {
+		panic(errPrecompiled.Error())
+	}
+	if from == "" || to == "" {
+		panic("http.ServeMux: empty host alias")
+	}
+	if from == to {
+		panic(fmt.Sprintf("http.ServeMux: host %q cannot be an alias of itself", from))
+	}
+	if _, ok := mux.hostAliases[from]; ok {
+		panic(fmt.Sprintf("http.ServeMux: host %q is already an alias of %q", from, mux.hostAliases[from]))
+	}
+	if other, ok := mux.hostAliases[to]; ok {
+		panic(fmt.Sprintf("http.ServeMux: host %q is itself an alias of %q", to, other))
+	}
+	for alias, canonical := range mux.hostAliases {
+		if canonical == from {
+			panic(fmt.Sprintf("http.ServeMux: host %q has alias %q", from, alias))
+		}
+	}
+	if mux.treeByHost(from) != nil {
+		panic(fmt.Sprintf("http.ServeMux: host %q already has registered patterns", from))
+	}
+	if mux.hostAliases == nil {
+		mux.hostAliases = map[string]string{}
+	}
+	mux.hostAliases[from] = to
+	if mux.cache != nil {
+		mux.cache.purge()
+	}
+}
+
+// AllowedMethods returns the sorted methods of the patterns that match the
+// hostAndPath, which is in the form of `[host]path`, without making a request.
+// It returns ["*"] if a pattern without a method matches the hostAndPath, and
+// nil if no pattern matches it.
+func (mux *ServeMux) AllowedMethods(hostAndPath string) []string {
+	host, path := "", hostAndPath
+	if i := strings.IndexByte(hostAndPath, '/'); i > 0 {
+		host, path = hostAndPath[:i], hostAndPath[i:]
+	}
+
+	mux.mu.RLock()
+	defer mux.mu.RUnlock()
+	return mux.allowedMethods(host, mux.cleanRequestPath("", path))
+}
+
+// allowedMethods is the main implementation of the [ServeMux.AllowedMethods].
+// The caller must hold the mux.mu.
+func (mux *ServeMux) allowedMethods(host, path string) []string {
+	r := &http.Request{
+		Method: "_allowed", // Never registered, since it is not alphanumeric
+		Host:   host,
+		URL:    &url.URL{Path: path},
+		Header: http.Header{},
+	}
+	switch h, ht := mux.lookup(path, r, nil, nil, nil); {
+	case ht != nil && ht.method == "":
+		return []string{"*"}
+	case ht == nil:
+		if nah, ok := h.(*notAllowedHandler); ok {
+			return append([]string(nil), nah.methods...)
+		}
+	}
+	return nil
+}
+
+// Use appends the middlewares to the middleware stack of the mux. The stack
+// wraps every handler matched by a registered pattern, including those
+// registered before the Use call, with the first middleware being the
+// outermost.
+func (mux *ServeMux) Use(middlewares ...func(http.Handler) http.Handler) {
+	mux.mu.Lock()
+	defer mux.mu.Unlock()
+	if mux.sealed.Load() {
+		panic(errPrecompiled.Error())
+	}
+	mux.middlewares = append(mux.middlewares, middlewares...)
 }
 
-// match finds the best match for the r from the tree.
-func (mux *ServeMux) match(tree *serveMuxNode, path string, r *http.Request) (h http.Handler, pattern string) {
+// match finds the best match for the method and path from the tree. It returns
+// a nil [handlerTuple] if the handler is an internally-generated one that
+// responds with an error. The resolved path variables are stored in the
+// pathVars if it is not nil, and their values, including those of unnamed
+// variables, are stored in the pathVarValues in order if it is not nil.
+func (mux *ServeMux) match(tree *serveMuxNode, method, path string, pathVars map[string]string, pathVarValues *[]string) (h http.Handler, ht *handlerTuple) {
 	var (
 		s    = path           // Search
 		si   int              // Search index
@@ -437,10 +2318,11 @@ func (mux *ServeMux) match(tree *serveMuxNode, path string, r *http.Request) (h
 		pvi  int              // Path variable index
 		pvvs []string         // Path variable values
 		i    int              // Index
-		ht   *handlerTuple    // Handler tuple
+		cvi  int              // Constrained variable child index
 	)
 
-	// Node precedence: non-variable > unmodified variable > ...-modified variable.
+	// Node precedence: non-variable > constrained variable > unmodified
+	// variable > ...-modified variable.
 OuterLoop:
 	for {
 		if cn.typ == nonvarServeMuxNode {
@@ -452,7 +2334,12 @@ OuterLoop:
 			}
 
 			ll = 0
-			for ; ll < ml && s[ll] == cn.prefix[ll]; ll++ {
+			if mux.caseInsensitive {
+				for ; ll < ml && lowerASCII(s[ll]) == cn.prefix[ll]; ll++ {
+				}
+			} else {
+				for ; ll < ml && s[ll] == cn.prefix[ll]; ll++ {
+				}
 			}
 
 			if ll != pl {
@@ -468,15 +2355,59 @@ OuterLoop:
 			if sn == nil {
 				sn = cn
 			}
-			if ht = cn.handlerTupleByMethod(r.Method); ht != nil {
-				break
+			if ht = cn.handlerTupleByMethod(method); ht != nil {
+				if mux.validPathVars(ht, pvvs[:pvi]) {
+					break
+				}
+				ht = nil
+				if sn == cn {
+					sn = nil
+				}
 			}
 		}
 
 		// Try non-variable node.
-		if s != "" && cn.nonvarChildren[s[0]] != nil {
-			cn = cn.nonvarChildren[s[0]]
-			continue OuterLoop
+		if s != "" {
+			c := s[0]
+			if mux.caseInsensitive {
+				c = lowerASCII(c)
+			}
+			if cn.nonvarChildren[c] != nil {
+				cn = cn.nonvarChildren[c]
+				continue OuterLoop
+			}
+		}
+
+		cvi = 0
+
+		// Try constrained variable nodes.
+	TryConstrainedVarNodes:
+		if cvi < len(cn.constrainedVarChildren) {
+			i, sl = 0, len(s)
+			for ; i < sl && s[i] != '/'; i++ {
+			}
+
+			for ; cvi < len(cn.constrainedVarChildren); cvi++ {
+				if cn.constrainedVarChildren[cvi].constraint.MatchString(s[:i]) {
+					break
+				}
+			}
+
+			if cvi < len(cn.constrainedVarChildren) {
+				cn = cn.constrainedVarChildren[cvi]
+
+				if pvvs == nil {
+					pvvs = mux.pathVarValuesPool.Get().([]string)
+				}
+
+				pvvs[pvi] = s[:i]
+				pvi++
+
+				s = s[i:]
+				si += i
+
+				continue
+			}
 		}
 
 		// Try unmodified variable node.
@@ -520,8 +2451,14 @@ OuterLoop:
 				sn = cn
 			}
 
-			if ht = cn.handlerTupleByMethod(r.Method); ht != nil {
-				break
+			if ht = cn.handlerTupleByMethod(method); ht != nil {
+				if mux.validPathVars(ht, pvvs[:pvi]) {
+					break
+				}
+				ht = nil
+				if sn == cn {
+					sn = nil
+				}
 			}
 		}
 
@@ -540,15 +2477,26 @@ OuterLoop:
 			s = path[si:]
 		}
 
-		if cn.typ < ellipsisModifiedVarServeMuxNode {
-			nnt = cn.typ + 1
-		} else {
+		switch cn.typ {
+		case nonvarServeMuxNode:
+			nnt, cvi = constrainedVarServeMuxNode, 0
+		case constrainedVarServeMuxNode:
+			nnt, cvi = constrainedVarServeMuxNode, 0
+			for cn.parent.constrainedVarChildren[cvi] != cn {
+				cvi++
+			}
+			cvi++
+		case unmodifiedVarServeMuxNode:
+			nnt = ellipsisModifiedVarServeMuxNode
+		default:
 			nnt = nonvarServeMuxNode
 		}
 
 		cn = cn.parent
 		if cn != nil {
 			switch nnt {
+			case constrainedVarServeMuxNode:
+				goto TryConstrainedVarNodes
 			case unmodifiedVarServeMuxNode:
 				goto TryUnmodifiedVarNode
 			case ellipsisModifiedVarServeMuxNode:
@@ -567,24 +2515,61 @@ OuterLoop:
 			mux.pathVarValuesPool.Put(pvvs)
 		}
 		if sn != nil && sn.hasAtLeastOneHandler {
-			return mux.methodNotAllowedHandler(), ""
+			if method == http.MethodOptions && !mux.noAutoOptions {
+				return optionsHandler(sn.allowedMethods()), nil
+			}
+			return mux.methodNotAllowedHandler(sn.allowedMethods()), nil
+		}
+		return nil, nil
+	}
+
+	// The ?-modified variable is empty if the shorter path of the pattern
+	// of the ht is matched.
+	if pvi < len(ht.pathVarNames) {
+		if pvvs == nil {
+			pvvs = mux.pathVarValuesPool.Get().([]string)
 		}
-		return nil, ""
+		pvvs[pvi] = ""
 	}
 
+	if pathVarValues != nil {
+		*pathVarValues = append((*pathVarValues)[:0], pvvs[:len(ht.pathVarNames)]...)
+	}
 	if len(ht.pathVarNames) > 0 {
-		if pathVars, ok := r.Context().Value(pathVarsContextKey).(map[string]string); ok {
+		if pathVars != nil {
 			for pvi, pvn := range ht.pathVarNames {
 				if pvn != "" {
 					pathVars[pvn] = pvvs[pvi]
 				}
 			}
 		}
-		//lint:ignore SA6002 this is harmless
-		mux.pathVarValuesPool.Put(pvvs)
+		//lint:ignore SA6002 this is harmless
+		mux.pathVarValuesPool.Put(pvvs)
+	}
+
+	return ht.handler, ht
+}
+
+// validPathVars reports whether the path variable values pvvs of the ht
+// satisfy all the validators added by the [ServeMux.AddPathVarValidator].
+//
+// The caller must hold the mux.mu.
+func (mux *ServeMux) validPathVars(ht *handlerTuple, pvvs []string) bool {
+	if len(mux.pathVarValidators) == 0 {
+		return true
+	}
+	for pvi, pvn := range ht.pathVarNames {
+		var pvv string // An absent ?-modified variable is empty
+		if pvi < len(pvvs) {
+			pvv = pvvs[pvi]
+		}
+		for _, validate := range mux.pathVarValidators[pvn] {
+			if !validate(pvv) {
+				return false
+			}
+		}
 	}
-
-	return ht.handler, ht.pattern
+	return true
 }
 
 // ServeHTTP dispatches the request to the handler whose pattern most closely
@@ -597,24 +2582,324 @@ func (mux *ServeMux) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
+	if h := mux.loadPreRoutingHandler(); h != nil {
+		h.ServeHTTP(w, r)
+		return
+	}
+	mux.dispatch(w, r)
+}
+
+// dispatch is the main implementation of the [ServeMux.ServeHTTP], which
+// selects the handler for the r and calls it.
+func (mux *ServeMux) dispatch(w http.ResponseWriter, r *http.Request) {
+	if mux.draining.Load() {
+		http.Error(w, "503 service unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	mux.active.Add(1)
+	defer mux.release()
+	if mux.draining.Load() {
+		// Drain was called after the first check, and may have already
+		// seen no active requests.
+		http.Error(w, "503 service unavailable", http.StatusServiceUnavailable)
+		return
+	}
 	r = ConfigureRequestToStorePathVars(r)
-	h, _ := mux.Handler(r)
+	h, ht := mux.findHandler(r)
+	var pattern string
+	if ht != nil {
+		pattern = ht.pattern
+		r = r.WithContext(context.WithValue(r.Context(), matchedRouteContextKey, ht))
+	}
+	if ctx := r.Context(); mux.logger != nil && mux.logger.Enabled(ctx, slog.LevelDebug) {
+		sw := &statusResponseWriter{ResponseWriter: w}
+		defer mux.logRequest(ctx, r, pattern, time.Now(), sw)
+		w = sw
+	}
+	if n := mux.maxBodySize.Load(); n > 0 && (ht == nil || !ht.bodyLimited) {
+		h = bodyLimitHandler{n, h}
+	}
+	if reporters := mux.loadMetricsReporters(); len(reporters) > 0 {
+		sw := &statusResponseWriter{ResponseWriter: w}
+		defer reportMetrics(reporters, r.Method, pattern, time.Now(), sw)
+		w = sw
+	}
+	mux.ServeHTTPWithRecovery(w, r, h, nil)
+}
+
+// ServeHTTPWithRecovery calls the h to serve the r, recovering from any panic
+// of the h other than the [http.ErrAbortHandler], which is repanicked. The
+// recovered value is passed to the onPanic if it is not nil. Otherwise, the
+// panic is handled as configured by the [ServeMux.SetPanicHandler] and the
+// [WithPanicRecovery], and not recovered at all if neither is used, just as
+// the [ServeMux.ServeHTTP] does. This allows the handlers returned by the
+// [ServeMux.Handler] to be served with the same recovery.
+func (mux *ServeMux) ServeHTTPWithRecovery(w http.ResponseWriter, r *http.Request, h http.Handler, onPanic func(recovered any)) {
+	var panicHandler func(http.ResponseWriter, *http.Request, any)
+	if onPanic == nil {
+		if panicHandler = mux.loadPanicHandler(); panicHandler == nil && mux.panicEncoder == nil {
+			h.ServeHTTP(w, r)
+			return
+		}
+	}
+	defer func() {
+		v := recover()
+		if v == nil {
+			return
+		}
+		if v == http.ErrAbortHandler {
+			panic(v)
+		}
+		if onPanic != nil {
+			onPanic(v)
+			return
+		}
+		mux.handlePanic(w, r, MatchedPattern(r.Context()), panicHandler, v)
+	}()
 	h.ServeHTTP(w, r)
 }
 
+// UseBeforeRouting appends the mw to the pre-routing middleware stack of the
+// mux. Unlike the middlewares added by the [ServeMux.Use], the stack wraps the
+// whole dispatch of the [ServeMux.ServeHTTP], including the handler selection
+// and the path variable resolution, so the mw can change the request before
+// it is routed, such as by rewriting its path or method. The first middleware
+// added is the outermost. UseBeforeRouting panics if the mux has been
+// precompiled.
+func (mux *ServeMux) UseBeforeRouting(mw func(http.Handler) http.Handler) {
+	if mw == nil {
+		panic("http.ServeMux: nil middleware")
+	}
+	mux.mu.Lock()
+	defer mux.mu.Unlock()
+	if mux.sealed.Load() {
+		panic(errPrecompiled.Error())
+	}
+	mux.preRoutingMiddlewares = append(mux.preRoutingMiddlewares, mw)
+	mux.buildPreRoutingHandler()
+}
+
+// buildPreRoutingHandler builds the mux.preRoutingHandler by wrapping the
+// [ServeMux.dispatch] with the mux.preRoutingMiddlewares. The caller must hold
+// the mux.mu.
+func (mux *ServeMux) buildPreRoutingHandler() {
+	if len(mux.preRoutingMiddlewares) == 0 {
+		mux.preRoutingHandler = nil
+		return
+	}
+	var h http.Handler = http.HandlerFunc(mux.dispatch)
+	for i := len(mux.preRoutingMiddlewares) - 1; i >= 0; i-- {
+		h = mux.preRoutingMiddlewares[i](h)
+	}
+	mux.preRoutingHandler = h
+}
+
+// loadPreRoutingHandler returns the mux.preRoutingHandler.
+func (mux *ServeMux) loadPreRoutingHandler() http.Handler {
+	if mux.sealed.Load() {
+		return mux.preRoutingHandler
+	}
+	mux.mu.RLock()
+	defer mux.mu.RUnlock()
+	return mux.preRoutingHandler
+}
+
+// SetPanicHandler sets the fn to be called with the recovered value when a
+// handler dispatched by the [ServeMux.ServeHTTP] panics, so that the fn can
+// write the response, typically with status 500, instead of having the
+// connection closed. Panics with [http.ErrAbortHandler] are never recovered.
+// The fn takes precedence over the encoder of the [WithPanicRecovery]. A nil
+// fn removes the panic handler.
+func (mux *ServeMux) SetPanicHandler(fn func(w http.ResponseWriter, r *http.Request, recovered any)) {
+	mux.mu.Lock()
+	defer mux.mu.Unlock()
+	if mux.sealed.Load() {
+		panic(errPrecompiled.Error())
+	}
+	mux.panicHandler = fn
+}
+
+// loadPanicHandler returns the mux.panicHandler.
+func (mux *ServeMux) loadPanicHandler() func(http.ResponseWriter, *http.Request, any) {
+	if mux.sealed.Load() {
+		return mux.panicHandler
+	}
+	mux.mu.RLock()
+	defer mux.mu.RUnlock()
+	return mux.panicHandler
+}
+
+// Drain makes the mux respond to new requests with status 503 (Service
+// Unavailable), and then waits for the requests being handled by the
+// [ServeMux.ServeHTTP] to complete. It returns the ctx.Err() if the ctx is
+// done first. The mux keeps rejecting new requests after Drain returns.
+func (mux *ServeMux) Drain(ctx context.Context) error {
+	mux.draining.Store(true)
+	if mux.active.Load() == 0 {
+		mux.closeDrained()
+	}
+	select {
+	case <-mux.drainedChan():
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// release marks a request counted in the mux.active as completed, closing the
+// mux.drained if it was the last one while draining.
+func (mux *ServeMux) release() {
+	if mux.active.Add(-1) == 0 && mux.draining.Load() {
+		mux.closeDrained()
+	}
+}
+
+// drainedChan returns the mux.drained, creating it if necessary.
+func (mux *ServeMux) drainedChan() chan struct{} {
+	mux.drainMu.Lock()
+	defer mux.drainMu.Unlock()
+	if mux.drained == nil {
+		mux.drained = make(chan struct{})
+	}
+	return mux.drained
+}
+
+// closeDrained closes the mux.drained unless it has been closed.
+func (mux *ServeMux) closeDrained() {
+	ch := mux.drainedChan()
+	mux.drainMu.Lock()
+	defer mux.drainMu.Unlock()
+	select {
+	case <-ch:
+	default:
+		close(ch)
+	}
+}
+
+// handlePanic passes the value v recovered from a panicking handler matched
+// by the pattern to the panicHandler, or, if it is nil, writes the response
+// encoded by the mux.panicEncoder.
+func (mux *ServeMux) handlePanic(w http.ResponseWriter, r *http.Request, pattern string, panicHandler func(http.ResponseWriter, *http.Request, any), v any) {
+	if panicHandler != nil {
+		panicHandler(w, r, v)
+		return
+	}
+
+	const size = 64 << 10
+	buf := make([]byte, size)
+	buf = buf[:runtime.Stack(buf, false)]
+	log.Printf("http: panic serving %s %s (pattern %q): %v\n%s", r.Method, r.URL.Path, pattern, v, buf)
+
+	statusCode, body, contentType := mux.panicEncoder(v)
+	if statusCode == 0 {
+		statusCode = http.StatusInternalServerError
+	}
+	if contentType != "" {
+		w.Header().Set("Content-Type", contentType)
+	}
+	w.WriteHeader(statusCode)
+	w.Write(body)
+}
+
+// SetNotFoundHandler sets the handler used to write not found responses. A nil
+// h restores the default [http.NotFoundHandler].
+func (mux *ServeMux) SetNotFoundHandler(h http.Handler) {
+	mux.mu.Lock()
+	defer mux.mu.Unlock()
+	if mux.sealed.Load() {
+		panic(errPrecompiled.Error())
+	}
+	mux.notFound = h
+}
+
 // notFoundHandler returns an [http.Handler] to write not found responses.
 func (mux *ServeMux) notFoundHandler() http.Handler {
+	if mux.notFound != nil {
+		return mux.notFound
+	}
 	return http.NotFoundHandler()
 }
 
+// SetMethodNotAllowedHandler sets the handler used to write method not allowed
+// responses. The methods allowed for the request path are available to the h
+// via the [AllowedMethodsFromContext]. A nil h restores the default handler.
+func (mux *ServeMux) SetMethodNotAllowedHandler(h http.Handler) {
+	mux.mu.Lock()
+	defer mux.mu.Unlock()
+	if mux.sealed.Load() {
+		panic(errPrecompiled.Error())
+	}
+	mux.methodNotAllowed = h
+}
+
 // methodNotAllowedHandler returns an [http.Handler] to write method not allowed
-// responses.
-func (mux *ServeMux) methodNotAllowedHandler() http.Handler {
+// responses for a request path that allows the methods.
+func (mux *ServeMux) methodNotAllowedHandler(methods []string) http.Handler {
+	return &notAllowedHandler{methods: methods, h: mux.methodNotAllowed}
+}
+
+// notAllowedHandler is an [http.Handler] that writes method not allowed
+// responses using the h, or a plain text response with an Allow header listing
+// the methods if the h is nil.
+type notAllowedHandler struct {
+	methods []string
+	h       http.Handler
+}
+
+// ServeHTTP implements the [http.Handler].
+func (nah *notAllowedHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if nah.h != nil {
+		nah.h.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), allowedMethodsContextKey, nah.methods)))
+		return
+	}
+	w.Header().Set("Allow", strings.Join(nah.methods, ", "))
+	http.Error(w, "405 method not allowed", http.StatusMethodNotAllowed)
+}
+
+// overriddenMethod returns the method that the r should be matched with when
+// method overriding is enabled. See the [WithMethodOverride].
+func overriddenMethod(r *http.Request) string {
+	if r.Method != http.MethodPost {
+		return r.Method
+	}
+	method := r.Header.Get("X-HTTP-Method-Override")
+	if method == "" {
+		method = r.URL.Query().Get("_method")
+		if ct := r.Header.Get("Content-Type"); method == "" && strings.HasPrefix(ct, "application/x-www-form-urlencoded") {
+			method = r.PostFormValue("_method")
+		}
+	}
+	if method == "" || !serveMuxMethodRE.MatchString(method) {
+		return r.Method
+	}
+	return strings.ToUpper(method)
+}
+
+// optionsHandler returns an [http.Handler] to write responses for OPTIONS
+// requests to a request path that allows the methods.
+func optionsHandler(methods []string) http.Handler {
+	allow := strings.Join(append(methods, http.MethodOptions), ", ")
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		http.Error(w, "405 method not allowed", http.StatusMethodNotAllowed)
+		w.Header().Set("Allow", allow)
+		w.WriteHeader(http.StatusNoContent)
 	})
 }
 
+// constraintRegexps caches the regular expressions compiled by the
+// compileConstraint, keyed by their constraints.
+var constraintRegexps sync.Map
+
+// compileConstraint returns the regular expression that entirely matches the
+// constraint of a variable path element, which must have been validated. Each
+// constraint is compiled only once.
+func compileConstraint(constraint string) *regexp.Regexp {
+	if re, ok := constraintRegexps.Load(constraint); ok {
+		return re.(*regexp.Regexp)
+	}
+	re, _ := constraintRegexps.LoadOrStore(constraint, regexp.MustCompile("^(?:"+constraint+")$"))
+	return re.(*regexp.Regexp)
+}
+
 // serveMuxNode is a node of the radix tree of a [ServeMux].
 type serveMuxNode struct {
 	prefix string
@@ -622,14 +2907,33 @@ type serveMuxNode struct {
 	typ    serveMuxNodeType
 	parent *serveMuxNode
 
+	// constraint is only set for constrained variable nodes.
+	constraint *regexp.Regexp
+
 	nonvarChildren           []*serveMuxNode
+	constrainedVarChildren   []*serveMuxNode
 	unmodifiedVarChild       *serveMuxNode
 	ellipsisModifiedVarChild *serveMuxNode
 	hasAtLeastOneChild       bool
 
-	handlerTuples        map[string]*handlerTuple
+	// handlerTuples is sorted by method. A linear search in it beats a
+	// map lookup for up to about five methods, which covers almost every
+	// node, and only falls behind beyond that (see the
+	// BenchmarkMethodHandlerLookup).
+	handlerTuples        []methodHandlerPair
 	catchAllHandlerTuple *handlerTuple
 	hasAtLeastOneHandler bool
+
+	// methodBits is the bitset of the standard methods of the
+	// handlerTuples, computed by the [ServeMux.Precompile]. Zero means
+	// unknown.
+	methodBits uint16
+}
+
+// methodHandlerPair is a method and its [handlerTuple] in a [serveMuxNode].
+type methodHandlerPair struct {
+	method string
+	ht     *handlerTuple
 }
 
 // addChild adds the n as a child node to the mn.
@@ -637,6 +2941,8 @@ func (mn *serveMuxNode) addChild(n *serveMuxNode) {
 	switch n.typ {
 	case nonvarServeMuxNode:
 		mn.nonvarChildren[n.label] = n
+	case constrainedVarServeMuxNode:
+		mn.constrainedVarChildren = append(mn.constrainedVarChildren, n)
 	case unmodifiedVarServeMuxNode:
 		mn.unmodifiedVarChild = n
 	case ellipsisModifiedVarServeMuxNode:
@@ -645,20 +2951,249 @@ func (mn *serveMuxNode) addChild(n *serveMuxNode) {
 	mn.hasAtLeastOneChild = true
 }
 
+// constrainedVarChild returns the constrained variable child node of the mn
+// whose prefix is the first path element of the s. It returns nil if not
+// found.
+func (mn *serveMuxNode) constrainedVarChild(s string) *serveMuxNode {
+	for _, n := range mn.constrainedVarChildren {
+		if strings.HasPrefix(s, n.prefix) && (len(s) == len(n.prefix) || s[len(n.prefix)] == '/') {
+			return n
+		}
+	}
+	return nil
+}
+
+// removeChild removes the n from the child nodes of the mn.
+func (mn *serveMuxNode) removeChild(n *serveMuxNode) {
+	switch n.typ {
+	case nonvarServeMuxNode:
+		mn.nonvarChildren[n.label] = nil
+	case constrainedVarServeMuxNode:
+		for i, c := range mn.constrainedVarChildren {
+			if c == n {
+				mn.constrainedVarChildren = append(mn.constrainedVarChildren[:i:i], mn.constrainedVarChildren[i+1:]...)
+				break
+			}
+		}
+	case unmodifiedVarServeMuxNode:
+		mn.unmodifiedVarChild = nil
+	case ellipsisModifiedVarServeMuxNode:
+		mn.ellipsisModifiedVarChild = nil
+	}
+
+	mn.hasAtLeastOneChild = len(mn.constrainedVarChildren) > 0 ||
+		mn.unmodifiedVarChild != nil ||
+		mn.ellipsisModifiedVarChild != nil
+	for _, c := range mn.nonvarChildren {
+		if c != nil {
+			mn.hasAtLeastOneChild = true
+			break
+		}
+	}
+}
+
+// prune removes the mn and its ancestors from the tree for as long as they
+// have neither handlers nor child nodes.
+func (mn *serveMuxNode) prune() {
+	for n := mn; n.parent != nil && !n.hasAtLeastOneHandler && !n.hasAtLeastOneChild; n = n.parent {
+		n.parent.removeChild(n)
+	}
+}
+
+// findNode returns the node for the denamed path in the subtree rooted at the
+// mn. It returns nil if not found.
+func (mn *serveMuxNode) findNode(path string) *serveMuxNode {
+	for s, cn := path, mn; ; {
+		if !strings.HasPrefix(s, cn.prefix) {
+			return nil
+		}
+		if s = s[len(cn.prefix):]; s == "" {
+			return cn
+		}
+
+		switch {
+		case s[0] != '{':
+			cn = cn.nonvarChildren[s[0]]
+		case s[1] == '}':
+			cn = cn.unmodifiedVarChild
+		case s[1] == ':':
+			cn = cn.constrainedVarChild(s)
+		default:
+			cn = cn.ellipsisModifiedVarChild
+		}
+		if cn == nil {
+			return nil
+		}
+	}
+}
+
 // handlerTupleByMethod returns a [handlerTuple] in the mn for the method. It
 // returns nil if not found.
 func (mn *serveMuxNode) handlerTupleByMethod(method string) *handlerTuple {
-	if ht := mn.handlerTuples[method]; ht != nil {
+	if mn.methodBits != 0 {
+		if b := methodBit(method); b != 0 && mn.methodBits&b == 0 {
+			return mn.catchAllHandlerTuple
+		}
+	}
+	if ht := mn.methodHandlerTuple(method); ht != nil {
 		return ht
 	}
 	return mn.catchAllHandlerTuple
 }
 
+// methodHandlerTuple returns the [handlerTuple] in the mn.handlerTuples for
+// the method. It returns nil if not found.
+func (mn *serveMuxNode) methodHandlerTuple(method string) *handlerTuple {
+	for i := range mn.handlerTuples {
+		if mn.handlerTuples[i].method == method {
+			return mn.handlerTuples[i].ht
+		}
+	}
+	return nil
+}
+
+// putMethodHandlerTuple puts the ht into the mn.handlerTuples for the
+// method, keeping it sorted by method.
+func (mn *serveMuxNode) putMethodHandlerTuple(method string, ht *handlerTuple) {
+	i := sort.Search(len(mn.handlerTuples), func(i int) bool {
+		return mn.handlerTuples[i].method >= method
+	})
+	if i < len(mn.handlerTuples) && mn.handlerTuples[i].method == method {
+		mn.handlerTuples[i].ht = ht
+		return
+	}
+	mn.handlerTuples = append(mn.handlerTuples, methodHandlerPair{})
+	copy(mn.handlerTuples[i+1:], mn.handlerTuples[i:])
+	mn.handlerTuples[i] = methodHandlerPair{method: method, ht: ht}
+}
+
+// deleteMethodHandlerTuple deletes the [handlerTuple] for the method from
+// the mn.handlerTuples.
+func (mn *serveMuxNode) deleteMethodHandlerTuple(method string) {
+	for i := range mn.handlerTuples {
+		if mn.handlerTuples[i].method == method {
+			mn.handlerTuples = append(mn.handlerTuples[:i:i], mn.handlerTuples[i+1:]...)
+			return
+		}
+	}
+}
+
+// walk calls the fn for each [handlerTuple] of the registered patterns in the
+// subtree rooted at the mn in depth-first order. If the fn returns false, the
+// walk stops and walk returns false.
+func (mn *serveMuxNode) walk(fn func(ht *handlerTuple) bool) bool {
+	if ht := mn.catchAllHandlerTuple; ht != nil && ht.method != "_tsr" && !fn(ht) {
+		return false
+	}
+	for _, p := range mn.handlerTuples {
+		if !p.ht.synthesized && !fn(p.ht) {
+			return false
+		}
+	}
+
+	if mn.hasAtLeastOneChild {
+		for _, n := range mn.nonvarChildren {
+			if n != nil && !n.walk(fn) {
+				return false
+			}
+		}
+		for _, n := range mn.constrainedVarChildren {
+			if !n.walk(fn) {
+				return false
+			}
+		}
+		if n := mn.unmodifiedVarChild; n != nil && !n.walk(fn) {
+			return false
+		}
+		if n := mn.ellipsisModifiedVarChild; n != nil && !n.walk(fn) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// clone returns a deep copy of the subtree rooted at the mn, with the parent
+// as the parent of the returned node.
+func (mn *serveMuxNode) clone(parent *serveMuxNode) *serveMuxNode {
+	n := &serveMuxNode{
+		prefix:               mn.prefix,
+		label:                mn.label,
+		typ:                  mn.typ,
+		parent:               parent,
+		constraint:           mn.constraint,
+		nonvarChildren:       make([]*serveMuxNode, 255),
+		hasAtLeastOneChild:   mn.hasAtLeastOneChild,
+		catchAllHandlerTuple: mn.catchAllHandlerTuple,
+		hasAtLeastOneHandler: mn.hasAtLeastOneHandler,
+	}
+	if mn.handlerTuples != nil {
+		n.handlerTuples = append([]methodHandlerPair(nil), mn.handlerTuples...)
+	}
+	for i, c := range mn.nonvarChildren {
+		if c != nil {
+			n.nonvarChildren[i] = c.clone(n)
+		}
+	}
+	for _, c := range mn.constrainedVarChildren {
+		n.constrainedVarChildren = append(n.constrainedVarChildren, c.clone(n))
+	}
+	if c := mn.unmodifiedVarChild; c != nil {
+		n.unmodifiedVarChild = c.clone(n)
+	}
+	if c := mn.ellipsisModifiedVarChild; c != nil {
+		n.ellipsisModifiedVarChild = c.clone(n)
+	}
+	return n
+}
+
+// allowedMethods returns the sorted methods of the handlers in the mn.
+func (mn *serveMuxNode) allowedMethods() []string {
+	methods := make([]string, len(mn.handlerTuples))
+	for i, p := range mn.handlerTuples {
+		methods[i] = p.method
+	}
+	return methods
+}
+
+// anyHandlerTuple returns a [handlerTuple] of the registered patterns in the
+// mn. It returns nil if there is none.
+func (mn *serveMuxNode) anyHandlerTuple() *handlerTuple {
+	if ht := mn.catchAllHandlerTuple; ht != nil && ht.method != "_tsr" {
+		return ht
+	}
+	for _, p := range mn.handlerTuples {
+		if !p.ht.synthesized {
+			return p.ht
+		}
+	}
+	return nil
+}
+
+// removeHandlerTuple removes the [handlerTuple] for the method from the mn.
+func (mn *serveMuxNode) removeHandlerTuple(method string) {
+	switch method {
+	case "", "_tsr":
+		mn.catchAllHandlerTuple = nil
+	default:
+		mn.deleteMethodHandlerTuple(method)
+		switch method {
+		case http.MethodGet:
+			if hht := mn.methodHandlerTuple(http.MethodHead); hht != nil && hht.synthesized {
+				mn.deleteMethodHandlerTuple(http.MethodHead)
+			}
+		case http.MethodHead:
+			if ght := mn.methodHandlerTuple(http.MethodGet); ght != nil {
+				mn.setHandlerTuple(ght)
+			}
+		}
+	}
+	mn.hasAtLeastOneHandler = len(mn.handlerTuples) > 0 || mn.catchAllHandlerTuple != nil
+	mn.methodBits = 0
+}
+
 // setHandlerTuple sets the ht to the mn.
 func (mn *serveMuxNode) setHandlerTuple(ht *handlerTuple) {
-	if mn.handlerTuples == nil {
-		mn.handlerTuples = map[string]*handlerTuple{}
-	}
 	switch ht.method {
 	case "", "_tsr":
 		if ht.method == "_tsr" && mn.hasAtLeastOneHandler {
@@ -666,7 +3201,17 @@ func (mn *serveMuxNode) setHandlerTuple(ht *handlerTuple) {
 		}
 		mn.catchAllHandlerTuple = ht
 	default:
-		mn.handlerTuples[ht.method] = ht
+		mn.putMethodHandlerTuple(ht.method, ht)
+
+		// Synthesize a HEAD handler from the GET handler, unless an
+		// explicit one exists.
+		if hht := mn.methodHandlerTuple(http.MethodHead); ht.method == http.MethodGet && (hht == nil || hht.synthesized) {
+			hht := *ht
+			hht.method = http.MethodHead
+			hht.handler = headHandler{ht.handler}
+			hht.synthesized = true
+			mn.putMethodHandlerTuple(http.MethodHead, &hht)
+		}
 	}
 	if ht.method != "_tsr" &&
 		len(mn.handlerTuples) > 0 &&
@@ -675,6 +3220,7 @@ func (mn *serveMuxNode) setHandlerTuple(ht *handlerTuple) {
 		mn.catchAllHandlerTuple = nil
 	}
 	mn.hasAtLeastOneHandler = len(mn.handlerTuples) > 0 || mn.catchAllHandlerTuple != nil
+	mn.methodBits = 0
 }
 
 // serveMuxNodeType is the type of a [serveMuxNode].
@@ -683,23 +3229,129 @@ type serveMuxNodeType uint8
 // The types of [serveMuxNode].
 const (
 	nonvarServeMuxNode serveMuxNodeType = iota
+	constrainedVarServeMuxNode
 	unmodifiedVarServeMuxNode
 	ellipsisModifiedVarServeMuxNode
 )
 
+// varHostTree is a tree of a [ServeMux] for a pattern host that has at least
+// one variable label.
+type varHostTree struct {
+	host   string
+	labels []string
+	tree   *serveMuxNode
+}
+
+// matchLabels matches the labels of a request host against the vht. It
+// returns the values of the variable labels if matched.
+func (vht *varHostTree) matchLabels(labels []string) (hostVars []string, ok bool) {
+	if len(labels) != len(vht.labels) {
+		return nil, false
+	}
+	for i, label := range vht.labels {
+		if label == "*" {
+			if labels[i] == "" {
+				return nil, false
+			}
+			hostVars = append(hostVars, labels[i])
+		} else if label != labels[i] {
+			return nil, false
+		}
+	}
+	return hostVars, true
+}
+
+// moreSpecificThan reports whether the vht is more specific than the other.
+// Labels are compared from right to left, and the first non-variable label
+// compared to a variable label makes its tree more specific.
+func (vht *varHostTree) moreSpecificThan(other *varHostTree) bool {
+	for i, j := len(vht.labels)-1, len(other.labels)-1; i >= 0 && j >= 0; i, j = i-1, j-1 {
+		if a, b := vht.labels[i] == "*", other.labels[j] == "*"; a != b {
+			return b
+		}
+	}
+	return false
+}
+
 // handlerTuple is a handler tuple.
 type handlerTuple struct {
 	method       string
+	host         string
+	path         string
+	hostVarNames []string
 	pathVarNames []string
 	pattern      string
 	handler      http.Handler
+	meta         map[string]string
+
+	// alias is the pattern registered by the [ServeMux.HandleAlias] if the
+	// handlerTuple is an alias of the pattern.
+	alias string
+
+	// synthesized reports whether the handlerTuple is a HEAD one
+	// synthesized from a GET one.
+	synthesized bool
+
+	// optional reports whether the pattern of the handlerTuple ends with a
+	// ?-modified variable path element, so that it is held by the nodes of
+	// both the paths with and without the element.
+	optional bool
+
+	// bodyLimited reports whether the handler has its own body limit.
+	bodyLimited bool
+
+	// routeHandler is the handler before being wrapped by the
+	// routeMiddlewares added by the [Route.Use], or nil if there are none.
+	routeHandler     http.Handler
+	routeMiddlewares []Middleware
+}
+
+// registeredPattern returns the pattern that the ht was registered with.
+func (ht *handlerTuple) registeredPattern() string {
+	if ht.alias != "" {
+		return ht.alias
+	}
+	return ht.pattern
+}
+
+// headHandler is an [http.Handler] that serves HEAD requests using a GET
+// handler, with the response body discarded.
+type headHandler struct {
+	h http.Handler
+}
+
+// ServeHTTP implements the [http.Handler].
+func (hh headHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	hh.h.ServeHTTP(headResponseWriter{w}, r)
+}
+
+// headResponseWriter is an [http.ResponseWriter] that discards the response
+// body.
+type headResponseWriter struct {
+	http.ResponseWriter
 }
 
-// stripHostPort returns h without any trailing ":<port>".
+// Write implements the [http.ResponseWriter].
+func (hw headResponseWriter) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+// Unwrap returns the underlying [http.ResponseWriter] of the hw.
+func (hw headResponseWriter) Unwrap() http.ResponseWriter {
+	return hw.ResponseWriter
+}
+
+// stripHostPort returns h without any trailing ":<port>". IPv6 addresses are
+// only split when they are in the bracket form followed by a port, such as
+// "[::1]:8080", and are otherwise returned unchanged.
 func stripHostPort(h string) string {
-	// If no port on host, return unchanged
-	if !strings.Contains(h, ":") {
-		return h
+	if strings.HasPrefix(h, "[") {
+		i := strings.LastIndexByte(h, ']')
+		if i < 0 || i+1 == len(h) || h[i+1] != ':' {
+			return h
+		}
+	} else if strings.Count(h, ":") != 1 {
+		return h // No port, or a bare IPv6 address
 	}
 	host, _, err := net.SplitHostPort(h)
 	if err != nil {
@@ -730,6 +3382,65 @@ func cleanPath(p string) string {
 	return np
 }
 
+// foldNonvarPathElems returns the path with the ASCII letters of its
+// non-variable path elements lower-cased.
+func foldNonvarPathElems(path string) string {
+	b := []byte(path)
+	inVar := false
+	for i, c := range b {
+		switch {
+		case c == '/':
+			inVar = false
+		case c == '{' && i > 0 && b[i-1] == '/':
+			inVar = true
+		case !inVar:
+			b[i] = lowerASCII(c)
+		}
+	}
+	return string(b)
+}
+
+// foldPathCase returns the path with the ASCII letters of the path elements
+// matched by the non-variable path elements of the pattern of the ht
+// lower-cased. It returns the path unchanged if the ht is nil.
+func foldPathCase(path string, ht *handlerTuple) string {
+	if ht == nil {
+		return path
+	}
+	pathElems := strings.Split(path, "/")
+	for i, elem := range strings.Split(ht.path, "/") {
+		if i == len(pathElems) {
+			break
+		}
+		if elem != "" && elem[0] != '{' {
+			pathElems[i] = toLowerASCII(pathElems[i])
+		}
+	}
+	return strings.Join(pathElems, "/")
+}
+
+// toLowerASCII returns the s with all ASCII letters lower-cased.
+func toLowerASCII(s string) string {
+	for i := 0; i < len(s); i++ {
+		if 'A' <= s[i] && s[i] <= 'Z' {
+			b := []byte(s)
+			for ; i < len(b); i++ {
+				b[i] = lowerASCII(b[i])
+			}
+			return string(b)
+		}
+	}
+	return s
+}
+
+// lowerASCII returns the c lower-cased if it is an ASCII letter.
+func lowerASCII(c byte) byte {
+	if 'A' <= c && c <= 'Z' {
+		return c + 'a' - 'A'
+	}
+	return c
+}
+
 // walkPath walks the given path and calls the f for each passed path element.
 // If the f returns false, the walk stops.
 func walkPath(path string, f func(recentlyPassedSlashes, elem string, elemIndex int) bool) {
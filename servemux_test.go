@@ -2,6 +2,8 @@ package servemux
 
 import (
 	"bufio"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -10,9 +12,13 @@ import (
 	"net/http/httptest"
 	"net/http/httputil"
 	"net/url"
+	"os"
+	"reflect"
 	"runtime"
 	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -1133,6 +1139,27 @@ func testServeWithSlashRedirectKeepsQueryString(t *testing.T, mode testMode) {
 	}
 }
 
+func TestStripHostPort(t *testing.T) {
+	tests := []struct {
+		h    string
+		want string
+	}{
+		{"example.com", "example.com"},
+		{"example.com:8080", "example.com"},
+		{"127.0.0.1:8080", "127.0.0.1"},
+		{"[::1]", "[::1]"},
+		{"[::1]:8080", "::1"},
+		{"[::1]:", "::1"},
+		{"[::1", "[::1"},
+		{"2001:db8::1", "2001:db8::1"},
+	}
+	for _, tt := range tests {
+		if got := stripHostPort(tt.h); got != tt.want {
+			t.Errorf("stripHostPort(%q) = %q, want %q", tt.h, got, tt.want)
+		}
+	}
+}
+
 func TestServeWithSlashRedirectForHostPatterns(t *testing.T) {
 	setParallel(t)
 
@@ -1210,3 +1237,2264 @@ func TestMuxRedirectRelative(t *testing.T) {
 		t.Errorf("Expected response code %d; got %d", want, got)
 	}
 }
+
+func TestServeMuxHostVars(t *testing.T) {
+	setParallel(t)
+
+	mux := NewServeMux()
+	mux.Handle("*.example.com/", stringHandler("*.example.com/"))
+	mux.Handle("{env}.{tenant}.example.com/", stringHandler("{env}.{tenant}.example.com/"))
+	mux.Handle("www.example.com/", stringHandler("www.example.com/"))
+	mux.Handle("/", stringHandler("/"))
+
+	tests := []struct {
+		host     string
+		want     string
+		hostVars []string
+	}{
+		{"foo.example.com", "*.example.com/", []string{"foo"}},
+		{"foo.example.com:8080", "*.example.com/", []string{"foo"}},
+		{"prod.foo.example.com", "{env}.{tenant}.example.com/", []string{"prod", "foo"}},
+		{"www.example.com", "www.example.com/", nil},
+		{"example.com", "/", nil},
+		{"a.b.c.example.com", "/", nil},
+		{"foo.example.org", "/", nil},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "http://"+tt.host+"/", nil)
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		if got, want := rec.Header().Get("Result"), tt.want; got != want {
+			t.Errorf("%s: Result = %q, want %q", tt.host, got, want)
+		}
+
+		req = ConfigureRequestToStorePathVars(req)
+		mux.Handler(req)
+		if got, want := SubdomainVars(req), tt.hostVars; fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("%s: SubdomainVars = %q, want %q", tt.host, got, want)
+		}
+		want := ""
+		if len(tt.hostVars) > 0 {
+			want = tt.hostVars[0]
+		}
+		if got := SubdomainVar(req); got != want {
+			t.Errorf("%s: SubdomainVar = %q, want %q", tt.host, got, want)
+		}
+	}
+
+	for _, pattern := range []string{"{sub}.example.com/", "{a}.{a}.example.org/", "{a.example.org/", "{1a}.example.org/"} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("expected registering %q to panic", pattern)
+				}
+			}()
+			mux.Handle(pattern, stringHandler(pattern))
+		}()
+	}
+}
+
+func TestServeMuxWithPanicRecovery(t *testing.T) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	mux := NewServeMux(WithPanicRecovery(func(v any) (int, []byte, string) {
+		if err, ok := v.(error); ok {
+			return 0, []byte(err.Error()), "text/plain"
+		}
+		return http.StatusTeapot, []byte(fmt.Sprint(v)), "application/json"
+	}))
+	mux.HandleFunc("/string", func(w http.ResponseWriter, r *http.Request) { panic(`"oops"`) })
+	mux.HandleFunc("/error", func(w http.ResponseWriter, r *http.Request) { panic(io.ErrUnexpectedEOF) })
+	mux.HandleFunc("/abort", func(w http.ResponseWriter, r *http.Request) { panic(http.ErrAbortHandler) })
+
+	tests := []struct {
+		path        string
+		code        int
+		body        string
+		contentType string
+	}{
+		{"/string", http.StatusTeapot, `"oops"`, "application/json"},
+		{"/error", http.StatusInternalServerError, io.ErrUnexpectedEOF.Error(), "text/plain"},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if rec.Code != tt.code || rec.Body.String() != tt.body || rec.Header().Get("Content-Type") != tt.contentType {
+			t.Errorf("%s = %d, %q, %q, want %d, %q, %q", tt.path, rec.Code, rec.Body.String(), rec.Header().Get("Content-Type"), tt.code, tt.body, tt.contentType)
+		}
+	}
+
+	func() {
+		defer func() {
+			if got := recover(); got != http.ErrAbortHandler {
+				t.Errorf("recovered %v, want %v", got, http.ErrAbortHandler)
+			}
+		}()
+		mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/abort", nil))
+	}()
+
+	mux = NewServeMux(WithPanicRecovery(nil))
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) { panic("oops") })
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if got, want := rec.Code, http.StatusInternalServerError; got != want {
+		t.Errorf("Status = %d, want %d", got, want)
+	}
+}
+
+func TestServeMuxSetPanicHandler(t *testing.T) {
+	setParallel(t)
+
+	var recovered any
+	mux := NewServeMux(WithPanicRecovery(nil))
+	mux.SetPanicHandler(func(w http.ResponseWriter, r *http.Request, v any) {
+		recovered = v
+		http.Error(w, fmt.Sprint(v), http.StatusInternalServerError)
+	})
+	mux.HandleFunc("/panic", func(w http.ResponseWriter, r *http.Request) { panic("oops") })
+	mux.HandleFunc("/abort", func(w http.ResponseWriter, r *http.Request) { panic(http.ErrAbortHandler) })
+	mux.Handle("/ok", stringHandler("ok"))
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/panic", nil))
+	if rec.Code != http.StatusInternalServerError || rec.Body.String() != "oops\n" || recovered != "oops" {
+		t.Errorf("/panic = %d, %q, recovered %v", rec.Code, rec.Body.String(), recovered)
+	}
+
+	recovered = nil
+	mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/ok", nil))
+	if recovered != nil {
+		t.Errorf("panic handler called without a panic with %v", recovered)
+	}
+
+	func() {
+		defer func() {
+			if got := recover(); got != http.ErrAbortHandler {
+				t.Errorf("recovered %v, want %v", got, http.ErrAbortHandler)
+			}
+		}()
+		mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/abort", nil))
+	}()
+	if recovered != nil {
+		t.Errorf("panic handler called for %v", recovered)
+	}
+}
+
+func TestServeMuxServeHTTPWithRecovery(t *testing.T) {
+	setParallel(t)
+
+	panicking := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { panic("oops") })
+	aborting := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { panic(http.ErrAbortHandler) })
+
+	mux := NewServeMux()
+	var recovered any
+	rec := httptest.NewRecorder()
+	mux.ServeHTTPWithRecovery(rec, httptest.NewRequest(http.MethodGet, "/", nil), panicking, func(v any) {
+		recovered = v
+	})
+	if recovered != "oops" {
+		t.Errorf("recovered %v, want %q", recovered, "oops")
+	}
+
+	recovered = nil
+	mux.ServeHTTPWithRecovery(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil), stringHandler("ok"), func(v any) {
+		recovered = v
+	})
+	if recovered != nil {
+		t.Errorf("onPanic called without a panic with %v", recovered)
+	}
+
+	for _, tt := range []struct {
+		h    http.Handler
+		want any
+	}{
+		{aborting, http.ErrAbortHandler},
+		{panicking, "oops"}, // No recovery is configured for the mux
+	} {
+		func() {
+			defer func() {
+				if got := recover(); got != tt.want {
+					t.Errorf("recovered %v, want %v", got, tt.want)
+				}
+			}()
+			mux.ServeHTTPWithRecovery(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil), tt.h, nil)
+		}()
+	}
+
+	mux.SetPanicHandler(func(w http.ResponseWriter, r *http.Request, v any) {
+		http.Error(w, fmt.Sprint(v), http.StatusServiceUnavailable)
+	})
+	rec = httptest.NewRecorder()
+	mux.ServeHTTPWithRecovery(rec, httptest.NewRequest(http.MethodGet, "/", nil), panicking, nil)
+	if rec.Code != http.StatusServiceUnavailable || rec.Body.String() != "oops\n" {
+		t.Errorf("got %d, %q", rec.Code, rec.Body.String())
+	}
+}
+
+func TestServeMuxHandleGetHead(t *testing.T) {
+	setParallel(t)
+
+	mux := NewServeMux()
+	mux.HandleGetHead("/doc", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Result", r.Method)
+		io.WriteString(w, "body")
+	}))
+
+	for _, tt := range []struct {
+		method string
+		code   int
+		body   string
+	}{
+		{http.MethodGet, http.StatusOK, "body"},
+		{http.MethodHead, http.StatusOK, ""},
+		{http.MethodPost, http.StatusMethodNotAllowed, ""},
+	} {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(tt.method, "/doc", nil))
+		if rec.Code != tt.code {
+			t.Errorf("%s = %d, want %d", tt.method, rec.Code, tt.code)
+		}
+		if tt.code == http.StatusOK && (rec.Header().Get("Result") != tt.method || rec.Body.String() != tt.body) {
+			t.Errorf("%s = %q %q, want %q", tt.method, rec.Header().Get("Result"), rec.Body.String(), tt.body)
+		}
+	}
+
+	if !mux.Has("HEAD /doc") {
+		t.Error(`expected "HEAD /doc" to be registered`)
+	}
+	if err := mux.Deregister("GET /doc"); err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodHead, "/doc", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("HEAD after deregistering GET = %d, want 200", rec.Code)
+	}
+
+	mux.Handle("HEAD /other", stringHandler("head"))
+	for _, pattern := range []string{"/other", "GET /doc"} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("expected HandleGetHead(%q) to panic", pattern)
+				}
+			}()
+			mux.HandleGetHead(pattern, stringHandler("x"))
+		}()
+	}
+	if mux.Has("GET /other") {
+		t.Error(`expected "GET /other" to be rolled back`)
+	}
+}
+
+func TestServeMuxRegisterOnce(t *testing.T) {
+	setParallel(t)
+
+	mux := NewServeMux()
+	if mux.Has("/foo/{bar}") {
+		t.Error("expected /foo/{bar} to be unregistered")
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			mux.RegisterOnce("/foo/{bar}", stringHandler("first"))
+		}()
+	}
+	wg.Wait()
+	mux.RegisterOnce("/foo/{baz}", stringHandler("second"))
+	mux.RegisterOnceFunc("/foo/{bar}", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Result", "third")
+	})
+
+	if !mux.Has("/foo/{bar}") || !mux.Has("/foo/{qux}") {
+		t.Error("expected /foo/{bar} to be registered")
+	}
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/foo/bar", nil))
+	if got, want := rec.Header().Get("Result"), "first"; got != want {
+		t.Errorf("Result = %q, want %q", got, want)
+	}
+}
+
+func TestServeMuxSubscribe(t *testing.T) {
+	setParallel(t)
+
+	mux := NewServeMux()
+	routes := make(chan RouteRegistration)
+	done, errs := mux.Subscribe(routes)
+
+	var (
+		gotErrs []error
+		errsWG  sync.WaitGroup
+	)
+	errsWG.Add(1)
+	go func() {
+		defer errsWG.Done()
+		for err := range errs {
+			gotErrs = append(gotErrs, err)
+		}
+	}()
+
+	routes <- RouteRegistration{"/foo", stringHandler("/foo")}
+	for i := 0; ; i++ {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/foo", nil))
+		if rec.Header().Get("Result") == "/foo" {
+			break
+		}
+		if i == 100 {
+			t.Fatal("/foo was not promptly available for dispatch")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	routes <- RouteRegistration{"/foo", stringHandler("/foo")}
+	routes <- RouteRegistration{"/bar/{", stringHandler("/bar/{")}
+	routes <- RouteRegistration{"/bar", stringHandler("/bar")}
+	close(routes)
+	<-done
+	errsWG.Wait()
+
+	if got, want := len(gotErrs), 2; got != want {
+		t.Errorf("got %d errors, want %d", got, want)
+	}
+	if !mux.Has("/bar") {
+		t.Error("expected /bar to be registered")
+	}
+
+	routes = make(chan RouteRegistration)
+	done, errs = mux.Subscribe(routes)
+	for i := 0; i < subscribeErrBufferSize+8; i++ {
+		routes <- RouteRegistration{"/bar", stringHandler("/bar")}
+	}
+	routes <- RouteRegistration{"/baz", stringHandler("/baz")}
+	close(routes)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Subscribe did not finish without receiving errors")
+	}
+	if got := len(errs); got != subscribeErrBufferSize {
+		t.Errorf("got %d buffered errors, want %d", got, subscribeErrBufferSize)
+	}
+	if !mux.Has("/baz") {
+		t.Error("expected /baz to be registered")
+	}
+}
+
+type varUsageHandler []string
+
+func (h varUsageHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {}
+
+func (h varUsageHandler) UsedPathVarNames() []string { return h }
+
+func TestServeMuxVarUsage(t *testing.T) {
+	var buf strings.Builder
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	mux := NewServeMux()
+	mux.Handle("/a/{id}/{name}", varUsageHandler{"id", "name"})
+	if buf.Len() > 0 {
+		t.Errorf("unexpected warning: %s", buf.String())
+	}
+	mux.Handle("/b/{id}/{name}", varUsageHandler{"id"})
+	if !strings.Contains(buf.String(), `["name"]`) {
+		t.Errorf("expected a warning about the unused name, got %q", buf.String())
+	}
+
+	mux = NewServeMux(WithStrictVarUsage())
+	mux.Handle("/a/{id}/{}", varUsageHandler{"id"})
+	tests := []struct {
+		pattern string
+		handler varUsageHandler
+	}{
+		{"/b/{id}/{name}", varUsageHandler{"id"}},
+		{"/c/{id}", varUsageHandler{"id", "name"}},
+	}
+	for _, tt := range tests {
+		if err := mux.SafeHandle(tt.pattern, tt.handler); err == nil {
+			t.Errorf("expected registering %q with %q to fail", tt.pattern, tt.handler)
+		}
+	}
+}
+
+func TestServeMuxSetNotFoundHandler(t *testing.T) {
+	setParallel(t)
+
+	mux := NewServeMux()
+	mux.Handle("/foo", stringHandler("/foo"))
+	mux.SetNotFoundHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.Context().Value(pathVarsContextKey).(map[string]string); !ok {
+			t.Error("expected the request to be configured to store path variables")
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		io.WriteString(w, `{"error":"not found"}`)
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/bar", nil)
+	if _, pattern := mux.Handler(req); pattern != "" {
+		t.Errorf("pattern = %q, want empty", pattern)
+	}
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	if got, want := rec.Code, http.StatusNotFound; got != want {
+		t.Errorf("Status = %d, want %d", got, want)
+	}
+	if got, want := rec.Body.String(), `{"error":"not found"}`; got != want {
+		t.Errorf("Body = %q, want %q", got, want)
+	}
+
+	mux.SetNotFoundHandler(nil)
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	if got, want := rec.Body.String(), "404 page not found\n"; got != want {
+		t.Errorf("Body = %q, want %q", got, want)
+	}
+}
+
+func TestServeMuxSetMethodNotAllowedHandler(t *testing.T) {
+	setParallel(t)
+
+	mux := NewServeMux()
+	mux.Handle("GET /foo", stringHandler("GET /foo"))
+	mux.Handle("POST /foo", stringHandler("POST /foo"))
+	mux.Handle("PUT /bar/{id}", stringHandler("PUT /bar/{id}"))
+
+	req := httptest.NewRequest(http.MethodDelete, "/foo", nil)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	if got, want := rec.Code, http.StatusMethodNotAllowed; got != want {
+		t.Errorf("Status = %d, want %d", got, want)
+	}
+	if got, want := rec.Body.String(), "405 method not allowed\n"; got != want {
+		t.Errorf("Body = %q, want %q", got, want)
+	}
+	if got, want := rec.Header().Get("Allow"), "GET, HEAD, POST"; got != want {
+		t.Errorf("Allow = %q, want %q", got, want)
+	}
+
+	mux.SetMethodNotAllowedHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Allow", strings.Join(AllowedMethodsFromContext(r.Context()), ", "))
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}))
+
+	tests := []struct {
+		path  string
+		allow string
+	}{
+		{"/foo", "GET, HEAD, POST"},
+		{"/bar/1", "PUT"},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, tt.path, nil))
+		if got, want := rec.Code, http.StatusMethodNotAllowed; got != want {
+			t.Errorf("%s: Status = %d, want %d", tt.path, got, want)
+		}
+		if got, want := rec.Header().Get("Allow"), tt.allow; got != want {
+			t.Errorf("%s: Allow = %q, want %q", tt.path, got, want)
+		}
+	}
+}
+
+func TestServeMuxUse(t *testing.T) {
+	setParallel(t)
+
+	middleware := func(name string) func(http.Handler) http.Handler {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Add("Middleware", name)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+
+	mux := NewServeMux()
+	mux.Use(middleware("m1"))
+	mux.Handle("/foo", stringHandler("/foo"))
+	mux.Use(middleware("m2"), middleware("m3"))
+	mux.Handle("/bar", stringHandler("/bar"))
+
+	for _, path := range []string{"/foo", "/bar"} {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if got, want := strings.Join(rec.Header()["Middleware"], ","), "m1,m2,m3"; got != want {
+			t.Errorf("%s: Middleware = %q, want %q", path, got, want)
+		}
+		if got, want := rec.Header().Get("Result"), path; got != want {
+			t.Errorf("%s: Result = %q, want %q", path, got, want)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/baz", nil))
+	if got := rec.Header()["Middleware"]; got != nil {
+		t.Errorf("/baz: Middleware = %q, want none", got)
+	}
+}
+
+func TestServeMuxHandleMethods(t *testing.T) {
+	setParallel(t)
+
+	mux := NewServeMux()
+	mux.HandleMethods([]string{"GET", "POST"}, "/foo/{id}", stringHandler("/foo/{id}"))
+	mux.HandleFuncMethods([]string{"PUT"}, "/foo/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Result", "PUT")
+	})
+
+	tests := []struct {
+		method string
+		code   int
+		result string
+	}{
+		{"GET", 200, "/foo/{id}"},
+		{"POST", 200, "/foo/{id}"},
+		{"PUT", 200, "PUT"},
+		{"DELETE", 405, ""},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(tt.method, "/foo/1", nil))
+		if rec.Code != tt.code || rec.Header().Get("Result") != tt.result {
+			t.Errorf("%s = %d, %q, want %d, %q", tt.method, rec.Code, rec.Header().Get("Result"), tt.code, tt.result)
+		}
+	}
+
+	func() {
+		defer func() {
+			if got, want := fmt.Sprint(recover()), `http.ServeMux: pattern "POST /foo/{name}" conflicts with "POST /foo/{id}"`; got != want {
+				t.Errorf("recovered %q, want %q", got, want)
+			}
+		}()
+		mux.HandleMethods([]string{"PATCH", "POST"}, "/foo/{name}", stringHandler("/foo/{name}"))
+	}()
+	if mux.Has("PATCH /foo/{id}") {
+		t.Error("expected a failed HandleMethods to register nothing")
+	}
+
+	mux.Handle("GET /a", stringHandler("GET /a"))
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("expected HandleMethods to panic on a conflicting optional variable")
+			}
+		}()
+		mux.HandleMethods([]string{"POST", "GET"}, "/a/{id?}", stringHandler("/a/{id?}"))
+	}()
+	for _, pattern := range []string{"POST /a/{id?}", "POST /a/{id}", "POST /a"} {
+		if mux.Has(pattern) {
+			t.Errorf("expected a failed HandleMethods not to leave %q registered", pattern)
+		}
+	}
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest("POST", "/a/1", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("POST /a/1 = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+	mux.HandleMethods([]string{"POST"}, "/a/{id?}", stringHandler("/a/{id?}"))
+}
+
+func TestServeMuxWalk(t *testing.T) {
+	setParallel(t)
+
+	mux := NewServeMux()
+	patterns := []string{
+		"GET /users/{id}",
+		"POST /users/{id}",
+		"/users/",
+		"/",
+		"example.com/static/{path...}",
+		"*.example.com/",
+		"GET example.com",
+	}
+	for _, pattern := range patterns {
+		mux.Handle(pattern, stringHandler(pattern))
+	}
+
+	var got []string
+	err := mux.Walk(func(method, host, path, pattern string, handler http.Handler) error {
+		if handler != stringHandler(pattern) {
+			t.Errorf("%s: unexpected handler %v", pattern, handler)
+		}
+		got = append(got, fmt.Sprintf("%s|%s|%s|%s", method, host, path, pattern))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"GET||/users/{id}|GET /users/{id}",
+		"POST||/users/{id}|POST /users/{id}",
+		"||/users/|/users/",
+		"||/|/",
+		"GET|example.com||GET example.com",
+		"|example.com|/static/{path...}|example.com/static/{path...}",
+		"|*.example.com|/|*.example.com/",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	errStop := fmt.Errorf("stop")
+	n := 0
+	if err := mux.Walk(func(string, string, string, string, http.Handler) error {
+		n++
+		return errStop
+	}); err != errStop || n != 1 {
+		t.Errorf("Walk = %v after %d calls, want %v after 1 call", err, n, errStop)
+	}
+}
+
+func TestServeMuxRouteFor(t *testing.T) {
+	setParallel(t)
+
+	mux := NewServeMux()
+	mux.Use(func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Middleware", "yes")
+			h.ServeHTTP(w, r)
+		})
+	})
+	mux.Handle("GET /users/{id}", stringHandler("user"))
+	mux.Handle("example.com/files/{path...}", stringHandler("files"))
+
+	tests := []struct {
+		method   string
+		host     string
+		path     string
+		pattern  string
+		pathVars map[string]string
+		err      error
+	}{
+		{http.MethodGet, "", "/users/1", "GET /users/{id}", map[string]string{"id": "1"}, nil},
+		{http.MethodGet, "", "/users/../users/2", "GET /users/{id}", map[string]string{"id": "2"}, nil},
+		{http.MethodPut, "example.com:8080", "/files/a/b", "example.com/files/{path...}", map[string]string{"path": "a/b"}, nil},
+		{http.MethodPost, "", "/users/1", "", nil, ErrMethodNotAllowed},
+		{http.MethodGet, "", "/missing", "", nil, ErrNotFound},
+	}
+	for _, tt := range tests {
+		h, pattern, pathVars, err := mux.RouteFor(tt.method, tt.host, tt.path)
+		if err != tt.err || pattern != tt.pattern || !reflect.DeepEqual(pathVars, tt.pathVars) {
+			t.Errorf("RouteFor(%q, %q, %q) = %q, %v, %v, want %q, %v, %v", tt.method, tt.host, tt.path, pattern, pathVars, err, tt.pattern, tt.pathVars, tt.err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, nil))
+		if rec.Header().Get("Middleware") != "yes" {
+			t.Errorf("RouteFor(%q, %q, %q): handler is not wrapped by the middlewares", tt.method, tt.host, tt.path)
+		}
+	}
+}
+
+func TestServeMuxForEachPattern(t *testing.T) {
+	setParallel(t)
+
+	mux := NewServeMux()
+	for _, pattern := range []string{"GET /users/{id}", "/subtree/", "example.com/"} {
+		mux.Handle(pattern, stringHandler(pattern))
+	}
+
+	var got []string
+	mux.ForEachPattern(func(pattern string, handler http.Handler) bool {
+		if handler != stringHandler(pattern) {
+			t.Errorf("%s: unexpected handler %v", pattern, handler)
+		}
+		got = append(got, pattern)
+		return true
+	})
+	if want := []string{"/subtree/", "GET /users/{id}", "example.com/"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	n := 0
+	mux.ForEachPattern(func(string, http.Handler) bool {
+		n++
+		return false
+	})
+	if n != 1 {
+		t.Errorf("got %d calls, want 1", n)
+	}
+}
+
+func TestServeMuxSortedWalk(t *testing.T) {
+	setParallel(t)
+
+	mux := NewServeMux()
+	for _, pattern := range []string{
+		"POST /users/{id}",
+		"GET /users/{id}",
+		"/users/",
+		"*.example.com/",
+		"example.com/static/{path...}",
+		"/",
+	} {
+		mux.Handle(pattern, stringHandler(pattern))
+	}
+
+	var got []string
+	if err := mux.SortedWalk(func(method, host, path, pattern string, handler http.Handler) error {
+		if handler != stringHandler(pattern) {
+			t.Errorf("%s: unexpected handler %v", pattern, handler)
+		}
+		got = append(got, pattern)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"*.example.com/",
+		"/",
+		"/users/",
+		"GET /users/{id}",
+		"POST /users/{id}",
+		"example.com/static/{path...}",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	errStop := fmt.Errorf("stop")
+	n := 0
+	if err := mux.SortedWalk(func(string, string, string, string, http.Handler) error {
+		n++
+		return errStop
+	}); err != errStop || n != 1 {
+		t.Errorf("SortedWalk = %v after %d calls, want %v after 1 call", err, n, errStop)
+	}
+}
+
+func TestServeMuxMatch(t *testing.T) {
+	setParallel(t)
+
+	var called bool
+	mux := NewServeMux()
+	mux.HandleFunc("GET /users/{id}/posts/{}", func(w http.ResponseWriter, r *http.Request) { called = true })
+	mux.HandleFunc("example.com/files/{path...}", func(w http.ResponseWriter, r *http.Request) { called = true })
+
+	tests := []struct {
+		method   string
+		url      string
+		pattern  string
+		pathVars map[string]string
+		ok       bool
+	}{
+		{"GET", "/users/42/posts/7", "GET /users/{id}/posts/{}", map[string]string{"id": "42"}, true},
+		{"GET", "/users/42/../42/posts/7", "GET /users/{id}/posts/{}", map[string]string{"id": "42"}, true},
+		{"GET", "http://example.com/files/a/b", "example.com/files/{path...}", map[string]string{"path": "a/b"}, true},
+		{"POST", "/users/42/posts/7", "", nil, false},
+		{"GET", "/users", "", nil, false},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.url, nil)
+		ctx := req.Context()
+		pattern, pathVars, ok := mux.Match(req)
+		if pattern != tt.pattern || ok != tt.ok || fmt.Sprint(pathVars) != fmt.Sprint(tt.pathVars) {
+			t.Errorf("%s %s = %q, %v, %t, want %q, %v, %t", tt.method, tt.url, pattern, pathVars, ok, tt.pattern, tt.pathVars, tt.ok)
+		}
+		if req.Context() != ctx {
+			t.Errorf("%s %s: the request was modified", tt.method, tt.url)
+		}
+		if pathVars != nil {
+			pathVars["id"] = "mutated"
+		}
+	}
+	if called {
+		t.Error("Match must not call any handler")
+	}
+}
+
+func TestServeMuxVarConstraints(t *testing.T) {
+	setParallel(t)
+
+	mux := NewServeMux()
+	mux.Handle("/users/{id:[0-9]+}", stringHandler("numeric"))
+	mux.Handle("/users/{name:[a-z]+}/posts", stringHandler("alpha posts"))
+	mux.Handle("/users/{name}", stringHandler("any"))
+	mux.Handle("/users/me", stringHandler("me"))
+	mux.Handle("/codes/{code:[A-Z]{3}}/{rest...}", stringHandler("code"))
+
+	tests := []struct {
+		path     string
+		want     string
+		pathVars map[string]string
+	}{
+		{"/users/42", "numeric", map[string]string{"id": "42"}},
+		{"/users/me", "me", map[string]string{}},
+		{"/users/bob", "any", map[string]string{"name": "bob"}},
+		{"/users/bob/posts", "alpha posts", map[string]string{"name": "bob"}},
+		{"/users/42/posts", "", nil},
+		{"/codes/ABC/x/y", "code", map[string]string{"code": "ABC", "rest": "x/y"}},
+		{"/codes/ABCD/x", "", nil},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", tt.path, nil)
+		pattern, pathVars, _ := mux.Match(req)
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		if got := rec.Header().Get("Result"); got != tt.want {
+			t.Errorf("%s = %q (pattern %q), want %q", tt.path, got, pattern, tt.want)
+		}
+		if fmt.Sprint(pathVars) != fmt.Sprint(tt.pathVars) {
+			t.Errorf("%s path vars = %v, want %v", tt.path, pathVars, tt.pathVars)
+		}
+	}
+
+	for _, pattern := range []string{"/bad/{id:[0-9}", "/bad/{id:}", "/bad/{id...:.+}"} {
+		if err := NewServeMux().SafeHandle(pattern, stringHandler("bad")); err == nil {
+			t.Errorf("SafeHandle(%q) = nil, want an error", pattern)
+		}
+	}
+	if err := mux.SafeHandle("/users/{other:[0-9]+}", stringHandler("dup")); err == nil {
+		t.Error("expected differently named constrained variables to conflict")
+	}
+}
+
+func TestServeMuxWithCaseInsensitive(t *testing.T) {
+	setParallel(t)
+
+	mux := NewServeMux(WithCaseInsensitive())
+	mux.Handle("/Users/{id}", stringHandler("user"))
+	mux.Handle("/codes/{code:[A-Z]+}", stringHandler("code"))
+
+	tests := []struct {
+		path     string
+		want     string
+		pathVars map[string]string
+	}{
+		{"/users/Bob", "user", map[string]string{"id": "Bob"}},
+		{"/USERS/Bob", "user", map[string]string{"id": "Bob"}},
+		{"/CODES/ABC", "code", map[string]string{"code": "ABC"}},
+		{"/codes/abc", "", nil},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", tt.path, nil)
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		if got := rec.Header().Get("Result"); got != tt.want {
+			t.Errorf("%s = %q, want %q", tt.path, got, tt.want)
+		}
+		if _, pathVars, _ := mux.Match(req); fmt.Sprint(pathVars) != fmt.Sprint(tt.pathVars) {
+			t.Errorf("%s path vars = %v, want %v", tt.path, pathVars, tt.pathVars)
+		}
+	}
+
+	for _, tt := range []struct {
+		path     string
+		location string
+	}{
+		{"/USERS/../USERS/Bob", "/users/Bob"},
+		{"/Users//Bob", "/users/Bob"},
+		{"/CODES/./ABC", "/codes/ABC"},
+		{"/Nope//Bob", "/Nope/Bob"},
+	} {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest("GET", tt.path, nil))
+		if got := rec.Header().Get("Location"); got != tt.location {
+			t.Errorf("%s redirect location = %q, want %q", tt.path, got, tt.location)
+		}
+		if got := mux.InspectRequest(httptest.NewRequest("GET", tt.path, nil)).RedirectTarget; got != tt.location {
+			t.Errorf("%s inspected redirect target = %q, want %q", tt.path, got, tt.location)
+		}
+	}
+
+	if err := mux.SafeHandle("/users/{name}", stringHandler("dup")); err == nil {
+		t.Error("expected patterns differing only in case to conflict")
+	}
+}
+
+func TestServeMuxNoTrailingSlashRedirect(t *testing.T) {
+	setParallel(t)
+
+	serveCode := func(mux *ServeMux, path string) int {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		return rec.Code
+	}
+
+	mux := NewServeMux()
+	mux.Handle("/redirected/", stringHandler("redirected"))
+	mux.HandleNoRedirect("/independent/", stringHandler("independent"))
+	if got := serveCode(mux, "/redirected"); got != http.StatusMovedPermanently {
+		t.Errorf("/redirected = %d, want %d", got, http.StatusMovedPermanently)
+	}
+	if got := serveCode(mux, "/independent"); got != http.StatusNotFound {
+		t.Errorf("/independent = %d, want %d", got, http.StatusNotFound)
+	}
+	mux.Handle("/independent", stringHandler("independent without slash"))
+	if got := serveCode(mux, "/independent"); got != http.StatusOK {
+		t.Errorf("/independent = %d, want %d", got, http.StatusOK)
+	}
+
+	mux = NewServeMux(WithNoTrailingSlashRedirect())
+	mux.Handle("/subtree/", stringHandler("subtree"))
+	if got := serveCode(mux, "/subtree"); got != http.StatusNotFound {
+		t.Errorf("/subtree = %d, want %d", got, http.StatusNotFound)
+	}
+	if got := serveCode(mux, "/subtree/"); got != http.StatusOK {
+		t.Errorf("/subtree/ = %d, want %d", got, http.StatusOK)
+	}
+}
+
+func TestServeMuxSynthesizedHead(t *testing.T) {
+	setParallel(t)
+
+	body := func(s string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Result", s)
+			io.WriteString(w, s)
+		}
+	}
+
+	mux := NewServeMux()
+	mux.Handle("GET /synthesized", body("get"))
+	mux.Handle("HEAD /explicit-before", body("head"))
+	mux.Handle("GET /explicit-before", body("get"))
+	mux.Handle("GET /explicit-after", body("get"))
+	mux.Handle("HEAD /explicit-after", body("head"))
+
+	tests := []struct {
+		path   string
+		result string
+	}{
+		{"/synthesized", "get"},
+		{"/explicit-before", "head"},
+		{"/explicit-after", "head"},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodHead, tt.path, nil))
+		if got := rec.Header().Get("Result"); got != tt.result {
+			t.Errorf("HEAD %s: Result = %q, want %q", tt.path, got, tt.result)
+		}
+		if tt.result == "get" && rec.Body.Len() != 0 {
+			t.Errorf("HEAD %s: Body = %q, want empty", tt.path, rec.Body)
+		}
+	}
+
+	var patterns []string
+	mux.Walk(func(method, host, path, pattern string, handler http.Handler) error {
+		patterns = append(patterns, pattern)
+		return nil
+	})
+	if got, want := len(patterns), 5; got != want {
+		t.Errorf("Walk visited %d patterns, want %d: %q", got, want, patterns)
+	}
+}
+
+func TestServeMuxAutoOptions(t *testing.T) {
+	setParallel(t)
+
+	register := func(mux *ServeMux) *ServeMux {
+		mux.Handle("GET /foo", stringHandler("get"))
+		mux.Handle("POST /foo", stringHandler("post"))
+		mux.Handle("GET /bar", stringHandler("get"))
+		mux.Handle("OPTIONS /bar", stringHandler("options"))
+		return mux
+	}
+
+	tests := []struct {
+		mux    *ServeMux
+		path   string
+		code   int
+		allow  string
+		result string
+	}{
+		{register(NewServeMux()), "/foo", http.StatusNoContent, "GET, HEAD, POST, OPTIONS", ""},
+		{register(NewServeMux()), "/bar", http.StatusOK, "", "options"},
+		{register(NewServeMux()), "/baz", http.StatusNotFound, "", ""},
+		{register(NewServeMux(WithAutoOptions(false))), "/foo", http.StatusMethodNotAllowed, "GET, HEAD, POST", ""},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		tt.mux.ServeHTTP(rec, httptest.NewRequest(http.MethodOptions, tt.path, nil))
+		if rec.Code != tt.code {
+			t.Errorf("OPTIONS %s: Status = %d, want %d", tt.path, rec.Code, tt.code)
+		}
+		if got := rec.Header().Get("Allow"); got != tt.allow {
+			t.Errorf("OPTIONS %s: Allow = %q, want %q", tt.path, got, tt.allow)
+		}
+		if got := rec.Header().Get("Result"); got != tt.result {
+			t.Errorf("OPTIONS %s: Result = %q, want %q", tt.path, got, tt.result)
+		}
+	}
+}
+
+func TestServeMuxWildcardHostSpecificity(t *testing.T) {
+	setParallel(t)
+
+	mux := NewServeMux()
+	mux.Handle("*.*.example.com/", stringHandler("*.*.example.com/"))
+	mux.Handle("*.api.example.com/", stringHandler("*.api.example.com/"))
+	mux.Handle("*.example.com/", stringHandler("*.example.com/"))
+	mux.Handle("*.example.com/users/{subdomain}", stringHandler("*.example.com/users/{subdomain}"))
+	mux.Handle("v1.api.example.com/", stringHandler("v1.api.example.com/"))
+
+	tests := []struct {
+		url      string
+		pattern  string
+		pathVars map[string]string
+	}{
+		{"http://foo.example.com/", "*.example.com/", map[string]string{"subdomain": "foo"}},
+		{"http://foo.api.example.com/", "*.api.example.com/", map[string]string{"subdomain": "foo"}},
+		{"http://v1.api.example.com/", "v1.api.example.com/", map[string]string{}},
+		{"http://foo.bar.example.com/", "*.*.example.com/", map[string]string{"subdomain": "foo"}},
+		{"http://foo.example.com/users/bar", "*.example.com/users/{subdomain}", map[string]string{"subdomain": "bar"}},
+	}
+	for _, tt := range tests {
+		pattern, pathVars, _ := mux.Match(httptest.NewRequest(http.MethodGet, tt.url, nil))
+		if pattern != tt.pattern {
+			t.Errorf("%s: pattern = %q, want %q", tt.url, pattern, tt.pattern)
+		}
+		if fmt.Sprint(pathVars) != fmt.Sprint(tt.pathVars) {
+			t.Errorf("%s: path vars = %v, want %v", tt.url, pathVars, tt.pathVars)
+		}
+	}
+
+	req := ConfigureRequestToStorePathVars(httptest.NewRequest(http.MethodGet, "http://foo.example.com/", nil))
+	mux.Handler(req)
+	if got, want := PathVars(req)["subdomain"], "foo"; got != want {
+		t.Errorf(`PathVars(req)["subdomain"] = %q, want %q`, got, want)
+	}
+}
+
+func TestServeMuxNamedHostVars(t *testing.T) {
+	setParallel(t)
+
+	mux := NewServeMux()
+	mux.Handle("{tenant}.example.com/users/{id}", stringHandler("{tenant}.example.com/users/{id}"))
+	mux.Handle("{region}.{tenant}.example.net/", stringHandler("{region}.{tenant}.example.net/"))
+	mux.Handle("acme.example.com/users/{id}", stringHandler("acme.example.com/users/{id}"))
+
+	tests := []struct {
+		url      string
+		pattern  string
+		pathVars map[string]string
+	}{
+		{"http://foo.example.com/users/1", "{tenant}.example.com/users/{id}", map[string]string{"id": "1", "subdomain": "foo", "tenant": "foo"}},
+		{"http://acme.example.com/users/1", "acme.example.com/users/{id}", map[string]string{"id": "1"}},
+		{"http://eu.foo.example.net/", "{region}.{tenant}.example.net/", map[string]string{"region": "eu", "subdomain": "eu", "tenant": "foo"}},
+	}
+	for _, tt := range tests {
+		pattern, pathVars, _ := mux.Match(httptest.NewRequest(http.MethodGet, tt.url, nil))
+		if pattern != tt.pattern {
+			t.Errorf("%s: pattern = %q, want %q", tt.url, pattern, tt.pattern)
+		}
+		if fmt.Sprint(pathVars) != fmt.Sprint(tt.pathVars) {
+			t.Errorf("%s: path vars = %v, want %v", tt.url, pathVars, tt.pathVars)
+		}
+	}
+
+	want := `http.ServeMux: the variable labels in a pattern host and the variable path elements in a pattern path must have unique names at position 23 in pattern "{id}.example.org/users/{id}": "{id}"`
+	if err := mux.HandleE("{id}.example.org/users/{id}", stringHandler("x")); err == nil || err.Error() != want {
+		t.Errorf("HandleE() = %v, want %q", err, want)
+	}
+}
+
+func TestServeMuxClone(t *testing.T) {
+	setParallel(t)
+
+	mux := NewServeMux()
+	mux.Handle("/users/{id}", stringHandler("user"))
+	mux.Handle("example.net/", stringHandler("example.net/"))
+	mux.Handle("*.example.org/", stringHandler("*.example.org/"))
+
+	clone := mux.Clone()
+	clone.Handle("/users/{id}/posts/{post}/comments/{comment}", stringHandler("comment"))
+	clone.Handle("example.net/only-in-clone", stringHandler("only in clone"))
+	clone.SetNotFoundHandler(stringHandler("clone not found"))
+
+	result := func(mux *ServeMux, url string) string {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, url, nil))
+		return rec.Header().Get("Result")
+	}
+	tests := []struct {
+		url   string
+		orig  string
+		clone string
+	}{
+		{"/users/1", "user", "user"},
+		{"/users/1/posts/2/comments/3", "", "comment"},
+		{"http://example.net/only-in-clone", "example.net/", "only in clone"},
+		{"http://foo.example.org/", "*.example.org/", "*.example.org/"},
+	}
+	for _, tt := range tests {
+		if got := result(mux, tt.url); got != tt.orig {
+			t.Errorf("original %s = %q, want %q", tt.url, got, tt.orig)
+		}
+		if got := result(clone, tt.url); got != tt.clone {
+			t.Errorf("clone %s = %q, want %q", tt.url, got, tt.clone)
+		}
+	}
+	if got := result(clone, "/nothing"); got != "clone not found" {
+		t.Errorf("clone /nothing = %q, want %q", got, "clone not found")
+	}
+
+	if err := mux.SafeHandle("/users/{id}/posts/{post}/comments/{comment}", stringHandler("x")); err != nil {
+		t.Errorf("original unexpectedly shares registered patterns with the clone: %v", err)
+	}
+}
+
+func TestServeMuxDeregister(t *testing.T) {
+	setParallel(t)
+
+	mux := NewServeMux()
+	mux.Handle("GET /users/{id}", stringHandler("GET /users/{id}"))
+	mux.Handle("POST /users/{id}", stringHandler("POST /users/{id}"))
+	mux.Handle("/subtree/", stringHandler("/subtree/"))
+	mux.Handle("/overridden/", stringHandler("/overridden/"))
+	mux.Handle("/overridden", stringHandler("/overridden"))
+	mux.HandleNamed("file", "example.net/files/{name:[a-z]+}", stringHandler("example.net/files/{name:[a-z]+}"))
+
+	serve := func(method, url string) (int, string) {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(method, url, nil))
+		return rec.Code, rec.Header().Get("Result")
+	}
+
+	if err := mux.Deregister("GET /users/{name}"); err != nil {
+		t.Fatalf("Deregister() = %v", err)
+	}
+	if code, _ := serve(http.MethodGet, "/users/1"); code != http.StatusMethodNotAllowed {
+		t.Errorf("GET /users/1 = %d, want %d", code, http.StatusMethodNotAllowed)
+	}
+	if code, _ := serve(http.MethodHead, "/users/1"); code != http.StatusMethodNotAllowed {
+		t.Errorf("HEAD /users/1 = %d, want %d", code, http.StatusMethodNotAllowed)
+	}
+	if _, got := serve(http.MethodPost, "/users/1"); got != "POST /users/{id}" {
+		t.Errorf("POST /users/1 = %q, want %q", got, "POST /users/{id}")
+	}
+
+	if err := mux.Deregister("/subtree/"); err != nil {
+		t.Fatalf("Deregister() = %v", err)
+	}
+	for _, path := range []string{"/subtree", "/subtree/", "/subtree/x"} {
+		if code, _ := serve(http.MethodGet, path); code != http.StatusNotFound {
+			t.Errorf("GET %s = %d, want %d", path, code, http.StatusNotFound)
+		}
+	}
+
+	if err := mux.Deregister("/overridden"); err != nil {
+		t.Fatalf("Deregister() = %v", err)
+	}
+	if code, _ := serve(http.MethodGet, "/overridden"); code != http.StatusMovedPermanently {
+		t.Errorf("GET /overridden = %d, want %d", code, http.StatusMovedPermanently)
+	}
+
+	if err := mux.Deregister("example.net/files/{file:[a-z]+}"); err != nil {
+		t.Fatalf("Deregister() = %v", err)
+	}
+	if _, err := mux.Reverse("file", map[string]string{"name": "a"}, nil); err == nil {
+		t.Error("expected the name of a deregistered pattern to be released")
+	}
+
+	if err := mux.Deregister("/subtree/"); !errors.Is(err, ErrPatternNotRegistered) {
+		t.Errorf("Deregister() = %v, want %v", err, ErrPatternNotRegistered)
+	}
+
+	mux.Handle("/subtree/", stringHandler("/subtree/ again"))
+	mux.Handle("GET /users/{id}", stringHandler("GET /users/{id} again"))
+	if _, got := serve(http.MethodGet, "/subtree/x"); got != "/subtree/ again" {
+		t.Errorf("GET /subtree/x = %q, want %q", got, "/subtree/ again")
+	}
+	if _, got := serve(http.MethodGet, "/users/1"); got != "GET /users/{id} again" {
+		t.Errorf("GET /users/1 = %q, want %q", got, "GET /users/{id} again")
+	}
+}
+
+func BenchmarkServeMuxDeregister(b *testing.B) {
+	patterns := []string{
+		"GET /users/{id}",
+		"GET /users/{id}/posts/{post}",
+		"/users/{id:[0-9]+}/avatar",
+		"/static/",
+		"example.com/api/{version}/things",
+	}
+	mux := NewServeMux()
+	for _, pattern := range patterns {
+		mux.Handle(pattern, stringHandler(pattern))
+	}
+	req := httptest.NewRequest(http.MethodGet, "/users/1/posts/2", nil)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		pattern := patterns[i%len(patterns)]
+		if err := mux.Deregister(pattern); err != nil {
+			b.Fatal(err)
+		}
+		mux.Handle(pattern, stringHandler(pattern))
+		if got, _, _ := mux.Match(req); got != "GET /users/{id}/posts/{post}" {
+			b.Fatalf("Match() = %q after re-registering %q", got, pattern)
+		}
+	}
+}
+
+func TestServeMuxConflictingVarNames(t *testing.T) {
+	setParallel(t)
+
+	tests := []struct {
+		registered string
+		pattern    string
+	}{
+		{"GET /users/{id}", "GET /users/{name}"},
+		{"GET /users/{id}", "GET /users/{}"},
+		{"/files/{path...}", "/files/{...}"},
+		{"/files/{path...}", "/files/"},
+		{"/orders/{id:[0-9]+}", "/orders/{:[0-9]+}"},
+		{"{tenant}.example.com/{id}", "*.example.com/{}"},
+	}
+	for _, tt := range tests {
+		func() {
+			mux := NewServeMux()
+			mux.Handle(tt.registered, stringHandler(tt.registered))
+			defer func() {
+				want := fmt.Sprintf("http.ServeMux: pattern %q conflicts with %q", tt.pattern, tt.registered)
+				if got := fmt.Sprint(recover()); got != want {
+					t.Errorf("Handle(%q) panic = %q, want %q", tt.pattern, got, want)
+				}
+			}()
+			mux.Handle(tt.pattern, stringHandler(tt.pattern))
+		}()
+	}
+}
+
+func TestServeMuxDisablePathCleaning(t *testing.T) {
+	var buf strings.Builder
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	mux := NewServeMux()
+	mux.HandleFunc("/a/{rest...}", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Result", PathVars(r)["rest"])
+	})
+	mux.DisablePathCleaning()
+	if buf.Len() > 0 {
+		t.Errorf("unexpected warning before registering: %s", buf.String())
+	}
+	mux.Handle("/b", stringHandler("b"))
+	mux.Handle("/c", stringHandler("c"))
+	if got := strings.Count(buf.String(), "path cleaning is disabled"); got != 1 {
+		t.Errorf("got %d warnings, want 1: %s", got, buf.String())
+	}
+
+	for _, tt := range []struct {
+		path string
+		code int
+		want string
+	}{
+		{"/a//b", http.StatusOK, "/b"},
+		{"/a/../b", http.StatusOK, "../b"},
+		{"/a/./b", http.StatusOK, "./b"},
+		{"//b", http.StatusNotFound, ""},
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.URL.Path = tt.path
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, r)
+		if got := rec.Header().Get("Result"); rec.Code != tt.code || got != tt.want {
+			t.Errorf("%s = %d %q, want %d %q", tt.path, rec.Code, got, tt.code, tt.want)
+		}
+	}
+}
+
+func TestServeMuxSetCustomRedirectHandler(t *testing.T) {
+	setParallel(t)
+
+	mux := NewServeMux()
+	mux.Handle("/subtree/", stringHandler("subtree"))
+	mux.HandleFunc("GET /self", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/elsewhere", http.StatusFound)
+	})
+	var calls []string
+	mux.SetCustomRedirectHandler(func(w http.ResponseWriter, r *http.Request, url string, code int) {
+		calls = append(calls, url)
+		w.Header().Set("Deprecation", "true")
+		http.Redirect(w, r, url, code)
+	})
+
+	for _, tt := range []struct {
+		path     string
+		code     int
+		location string
+		custom   bool
+	}{
+		{"/subtree?q=1", http.StatusMovedPermanently, "/subtree/?q=1", true},
+		{"/subtree/../subtree/x", http.StatusMovedPermanently, "/subtree/x", true},
+		{"/self", http.StatusFound, "/elsewhere", false},
+	} {
+		r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, r)
+		if rec.Code != tt.code || rec.Header().Get("Location") != tt.location {
+			t.Errorf("%s = %d %q, want %d %q", tt.path, rec.Code, rec.Header().Get("Location"), tt.code, tt.location)
+		}
+		if got := rec.Header().Get("Deprecation") == "true"; got != tt.custom {
+			t.Errorf("%s custom redirect = %t, want %t", tt.path, got, tt.custom)
+		}
+	}
+	if want := []string{"/subtree/?q=1", "/subtree/x"}; !reflect.DeepEqual(calls, want) {
+		t.Errorf("got calls %q, want %q", calls, want)
+	}
+
+	mux.SetCustomRedirectHandler(nil)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/subtree", nil))
+	if rec.Code != http.StatusMovedPermanently || rec.Header().Get("Deprecation") != "" {
+		t.Errorf("got %d %v after restoring the default", rec.Code, rec.Header())
+	}
+}
+
+func TestServeMuxAddHostAlias(t *testing.T) {
+	setParallel(t)
+
+	mux := NewServeMux()
+	mux.Handle("example.com/", stringHandler("example.com"))
+	mux.Handle("/", stringHandler("generic"))
+	mux.AddHostAlias("www.example.com", "example.com")
+	mux.AddHostAlias("example.org", "example.com")
+
+	for _, tt := range []struct {
+		host string
+		want string
+	}{
+		{"example.com", "example.com"},
+		{"www.example.com", "example.com"},
+		{"www.example.com:8080", "example.com"},
+		{"example.org", "example.com"},
+		{"example.net", "generic"},
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/foo", nil)
+		r.Host = tt.host
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, r)
+		if got := rec.Header().Get("Result"); got != tt.want {
+			t.Errorf("%s = %q, want %q", tt.host, got, tt.want)
+		}
+	}
+
+	for _, f := range []func(){
+		func() { mux.Handle("www.example.com/bar", stringHandler("bar")) },
+		func() { mux.AddHostAlias("www.example.com", "example.net") },
+		func() { mux.AddHostAlias("example.net", "www.example.com") },
+		func() { mux.AddHostAlias("example.com", "example.net") },
+		func() { mux.AddHostAlias("example.net", "example.net") },
+		func() { mux.AddHostAlias("", "example.net") },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Error("expected a panic")
+				}
+			}()
+			f()
+		}()
+	}
+}
+
+func TestServeMuxOptionalPathVar(t *testing.T) {
+	setParallel(t)
+
+	mux := NewServeMux()
+	mux.HandleFunc("GET /users/{id?}", func(w http.ResponseWriter, r *http.Request) {
+		id, ok := PathVars(r)["id"]
+		w.Header().Set("Result", fmt.Sprintf("%s %t", id, ok))
+	})
+	mux.Handle("/users/{id}/posts", stringHandler("posts"))
+
+	for _, tt := range []struct {
+		method string
+		path   string
+		code   int
+		want   string
+	}{
+		{http.MethodGet, "/users", http.StatusOK, " true"},
+		{http.MethodGet, "/users/42", http.StatusOK, "42 true"},
+		{http.MethodGet, "/users/", http.StatusOK, " true"},
+		{http.MethodHead, "/users", http.StatusOK, " true"},
+		{http.MethodGet, "/users/42/posts", http.StatusOK, "posts"},
+		{http.MethodPost, "/users", http.StatusMethodNotAllowed, ""},
+	} {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, nil))
+		if got := rec.Header().Get("Result"); rec.Code != tt.code || got != tt.want {
+			t.Errorf("%s %s = %d %q, want %d %q", tt.method, tt.path, rec.Code, got, tt.code, tt.want)
+		}
+	}
+
+	var patterns []string
+	mux.ForEachPattern(func(pattern string, _ http.Handler) bool {
+		patterns = append(patterns, pattern)
+		return true
+	})
+	if want := []string{"/users/{id}/posts", "GET /users/{id?}"}; !reflect.DeepEqual(patterns, want) {
+		t.Errorf("got patterns %q, want %q", patterns, want)
+	}
+
+	if err := mux.ReplaceHandler("GET /users/{id?}", stringHandler("replaced")); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{"/users", "/users/42"} {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if got := rec.Header().Get("Result"); got != "replaced" {
+			t.Errorf("%s = %q after replacing the handler", path, got)
+		}
+	}
+
+	for _, pattern := range []string{"GET /users", "GET /users/{name}", "GET /users/{name?}"} {
+		if err := mux.HandleE(pattern, stringHandler(pattern)); err == nil {
+			t.Errorf("expected %q to conflict", pattern)
+		}
+	}
+	if err := mux.HandleE("GET /posts", stringHandler("posts")); err != nil {
+		t.Fatal(err)
+	}
+	if err := mux.HandleE("GET /posts/{id?}", stringHandler("posts")); err == nil {
+		t.Error(`expected "GET /posts/{id?}" to conflict`)
+	}
+
+	if err := mux.Deregister("GET /users/{id?}"); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{"/users", "/users/42"} {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("%s = %d after deregistering, want 404", path, rec.Code)
+		}
+	}
+	mux.Handle("GET /users", stringHandler("users"))
+}
+
+func TestServeMuxWithMethodOverride(t *testing.T) {
+	setParallel(t)
+
+	mux := NewServeMux(WithMethodOverride())
+	for _, method := range []string{http.MethodPost, http.MethodPut, http.MethodDelete, http.MethodGet} {
+		method := method
+		mux.HandleFunc(method+" /things/{id}", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Result", method+" "+r.Method)
+		})
+	}
+
+	tests := []struct {
+		method      string
+		url         string
+		header      string
+		contentType string
+		body        string
+		want        string
+	}{
+		{http.MethodPost, "/things/1", "PUT", "", "", "PUT POST"},
+		{http.MethodPost, "/things/1", "delete", "", "", "DELETE POST"},
+		{http.MethodPost, "/things/1?_method=DELETE", "", "", "", "DELETE POST"},
+		{http.MethodPost, "/things/1", "", "application/x-www-form-urlencoded", "_method=PUT", "PUT POST"},
+		{http.MethodPost, "/things/1", "PUT;DROP", "", "", "POST POST"},
+		{http.MethodPost, "/things/1", "", "", "", "POST POST"},
+		{http.MethodGet, "/things/1", "DELETE", "", "", "GET GET"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.url, strings.NewReader(tt.body))
+		if tt.header != "" {
+			req.Header.Set("X-HTTP-Method-Override", tt.header)
+		}
+		if tt.contentType != "" {
+			req.Header.Set("Content-Type", tt.contentType)
+		}
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		if got := rec.Header().Get("Result"); got != tt.want {
+			t.Errorf("%s %s (%q): Result = %q, want %q", tt.method, tt.url, tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestServeMuxHandleWithTimeout(t *testing.T) {
+	setParallel(t)
+
+	mux := NewServeMux()
+	mux.HandleWithTimeout("GET /slow/{id}", 10*time.Millisecond, "too slow", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	mux.HandleWithTimeout("GET /fast/{id}", time.Minute, "too slow", stringHandler("fast"))
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/slow/1", nil))
+	if rec.Code != http.StatusServiceUnavailable || rec.Body.String() != "too slow" {
+		t.Errorf("/slow/1 = %d %q, want %d %q", rec.Code, rec.Body, http.StatusServiceUnavailable, "too slow")
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/fast/1", nil))
+	if got := rec.Header().Get("Result"); rec.Code != http.StatusOK || got != "fast" {
+		t.Errorf("/fast/1 = %d %q, want %d %q", rec.Code, got, http.StatusOK, "fast")
+	}
+
+	if pattern, _, _ := mux.Match(httptest.NewRequest(http.MethodGet, "/slow/1", nil)); pattern != "GET /slow/{id}" {
+		t.Errorf("Match() = %q, want %q", pattern, "GET /slow/{id}")
+	}
+}
+
+func TestServeMuxHandleWithBodyLimit(t *testing.T) {
+	setParallel(t)
+
+	echo := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, err := io.ReadAll(r.Body)
+		if err != nil {
+			return
+		}
+		w.Header().Set("Result", string(b))
+	})
+	mux := NewServeMux()
+	mux.HandleWithBodyLimit("POST /small", 4, echo)
+	mux.HandleWithBodyLimit("POST /unlimited", 0, echo)
+
+	tests := []struct {
+		path          string
+		body          string
+		unknownLength bool
+		code          int
+		want          string
+	}{
+		{"/small", "1234", false, http.StatusOK, "1234"},
+		{"/small", "12345", false, http.StatusRequestEntityTooLarge, ""},
+		{"/small", "1234", true, http.StatusOK, "1234"},
+		{"/small", "12345", true, http.StatusRequestEntityTooLarge, ""},
+		{"/unlimited", "12345", true, http.StatusOK, "12345"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body))
+		if tt.unknownLength {
+			r.ContentLength = -1
+		}
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, r)
+		if got := rec.Header().Get("Result"); rec.Code != tt.code || got != tt.want {
+			t.Errorf("%s %q = %d %q, want %d %q", tt.path, tt.body, rec.Code, got, tt.code, tt.want)
+		}
+	}
+}
+
+func TestServeMuxSetMaxBodySize(t *testing.T) {
+	setParallel(t)
+
+	echo := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, err := io.ReadAll(r.Body)
+		if err != nil {
+			return
+		}
+		w.Header().Set("Result", string(b))
+	})
+	mux := NewServeMux()
+	mux.SetMaxBodySize(4)
+	mux.Handle("POST /default", echo)
+	mux.HandleWithBodyLimit("POST /large", 8, echo)
+	mux.HandleWithBodyLimit("POST /unlimited", 0, echo)
+	mux.HandleWith("POST /option", echo, WithBodyLimit(6))
+	mux.HandleFunc("POST /own", func(w http.ResponseWriter, r *http.Request) {
+		r.Body = io.NopCloser(strings.NewReader("replaced"))
+		echo.ServeHTTP(w, r)
+	})
+
+	type test struct {
+		path string
+		body string
+		code int
+		want string
+	}
+	tests := []test{
+		{"/default", "1234", http.StatusOK, "1234"},
+		{"/default", "12345", http.StatusRequestEntityTooLarge, ""},
+		{"/large", "12345678", http.StatusOK, "12345678"},
+		{"/large", "123456789", http.StatusRequestEntityTooLarge, ""},
+		{"/unlimited", "123456789", http.StatusOK, "123456789"},
+		{"/option", "123456", http.StatusOK, "123456"},
+		{"/own", "12", http.StatusOK, "replaced"},
+	}
+	check := func(mux *ServeMux, tests []test) {
+		t.Helper()
+		for _, tt := range tests {
+			r := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body))
+			r.ContentLength = -1
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, r)
+			if got := rec.Header().Get("Result"); rec.Code != tt.code || got != tt.want {
+				t.Errorf("%s %q = %d %q, want %d %q", tt.path, tt.body, rec.Code, got, tt.code, tt.want)
+			}
+		}
+	}
+	check(mux, tests)
+	check(mux.Clone(), tests[:2])
+
+	mux.SetMaxBodySize(0)
+	check(mux, tests[:1])
+	r := httptest.NewRequest(http.MethodPost, "/default", strings.NewReader("12345"))
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, r)
+	if got := rec.Header().Get("Result"); got != "12345" {
+		t.Errorf("got %q with the limit disabled, want %q", got, "12345")
+	}
+}
+
+func TestServeMuxHandleLazy(t *testing.T) {
+	setParallel(t)
+
+	var calls int
+	mux := NewServeMux()
+	mux.HandleLazy("/lazy", func() http.Handler {
+		calls++
+		if calls == 1 {
+			panic("not ready")
+		}
+		return stringHandler("lazy")
+	})
+
+	serve := func() (result string, panicked bool) {
+		defer func() { panicked = recover() != nil }()
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/lazy", nil))
+		return rec.Header().Get("Result"), false
+	}
+	if _, panicked := serve(); !panicked {
+		t.Error("expected the first request to panic")
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if got, _ := serve(); got != "lazy" {
+				t.Errorf("got %q, want %q", got, "lazy")
+			}
+		}()
+	}
+	wg.Wait()
+	if calls != 2 {
+		t.Errorf("init called %d times, want 2", calls)
+	}
+}
+
+func TestServeMuxHandlerAt(t *testing.T) {
+	setParallel(t)
+
+	mux := NewServeMux()
+	mux.Use(func(h http.Handler) http.Handler { return stringHandler("middleware") })
+	mux.Handle("GET /users/{id}", stringHandler("GET /users/{id}"))
+	mux.Handle("/users/{id}", stringHandler("/users/{id}"))
+	mux.Handle("*.example.org/static/", stringHandler("*.example.org/static/"))
+
+	tests := []struct {
+		pattern string
+		want    http.Handler
+		ok      bool
+	}{
+		{"GET /users/{id}", stringHandler("GET /users/{id}"), true},
+		{"GET /users/{name}", stringHandler("GET /users/{id}"), true},
+		{"/users/{id}", stringHandler("/users/{id}"), true},
+		{"{sub}.example.org/static/{...}", stringHandler("*.example.org/static/"), true},
+		{"HEAD /users/{id}", nil, false},
+		{"POST /users/{id}", nil, false},
+		{"/static", nil, false},
+		{"/bad/{", nil, false},
+	}
+	for _, tt := range tests {
+		if h, ok := mux.HandlerAt(tt.pattern); h != tt.want || ok != tt.ok {
+			t.Errorf("HandlerAt(%q) = %v, %t, want %v, %t", tt.pattern, h, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestServeMuxReplaceHandler(t *testing.T) {
+	setParallel(t)
+
+	mux := NewServeMux()
+	mux.Use(func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Middleware", "yes")
+			h.ServeHTTP(w, r)
+		})
+	})
+	mux.HandleWithMeta("GET /users/{id}", stringHandler("old"), map[string]string{"k": "v"})
+	clone := mux.Clone()
+
+	if err := mux.ReplaceHandler("GET /users/{name}", stringHandler("new")); err != nil {
+		t.Fatalf("ReplaceHandler() = %v", err)
+	}
+
+	for _, method := range []string{http.MethodGet, http.MethodHead} {
+		rec := httptest.NewRecorder()
+		r := httptest.NewRequest(method, "/users/1", nil)
+		mux.ServeHTTP(rec, r)
+		if got := rec.Header().Get("Result"); got != "new" {
+			t.Errorf("%s /users/1 = %q, want %q", method, got, "new")
+		}
+		if got := rec.Header().Get("Middleware"); got != "yes" {
+			t.Errorf("%s /users/1 was not wrapped by the middleware", method)
+		}
+	}
+	if _, pattern := mux.Handler(httptest.NewRequest(http.MethodGet, "/users/1", nil)); pattern != "GET /users/{id}" {
+		t.Errorf("pattern = %q, want %q", pattern, "GET /users/{id}")
+	}
+	var meta map[string]string
+	mux.ReplaceHandler("GET /users/{id}", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		meta = RouteMeta(r)
+	}))
+	mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users/1", nil))
+	if meta["k"] != "v" {
+		t.Errorf("RouteMeta() = %v, want map[k:v]", meta)
+	}
+	if h, _ := clone.HandlerAt("GET /users/{id}"); h != stringHandler("old") {
+		t.Errorf("clone handler = %v, want %v", h, stringHandler("old"))
+	}
+
+	if err := mux.ReplaceHandler("POST /users/{id}", stringHandler("new")); !errors.Is(err, ErrPatternNotRegistered) {
+		t.Errorf("ReplaceHandler() of an unregistered pattern = %v", err)
+	}
+	if err := mux.ReplaceHandler("GET /users/{id}", nil); err == nil {
+		t.Error("ReplaceHandler() with a nil handler succeeded")
+	}
+}
+
+func TestServeMuxHandleAlias(t *testing.T) {
+	setParallel(t)
+
+	mux := NewServeMux()
+	mux.Handle("GET /users/{id}", stringHandler("user"))
+	if err := mux.HandleAlias("GET /users/{id}", "GET /people/{id}"); err != nil {
+		t.Fatal(err)
+	}
+	if err := mux.HandleAlias("GET /missing", "GET /gone"); !errors.Is(err, ErrPatternNotRegistered) {
+		t.Errorf("HandleAlias() with an unregistered canonical = %v", err)
+	}
+	if err := mux.HandleAlias("GET /users/{id}", "GET /people/{name}"); err == nil {
+		t.Error("expected a conflicting alias to fail")
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/people/1", nil)
+	if h, pattern := mux.Handler(r); h != stringHandler("user") || pattern != "GET /users/{id}" {
+		t.Errorf("Handler() = %v, %q, want %v, %q", h, pattern, stringHandler("user"), "GET /users/{id}")
+	}
+	if got, want := mux.AllRegisteredPatterns(), []string{"GET /people/{id}", "GET /users/{id}"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("AllRegisteredPatterns() = %q, want %q", got, want)
+	}
+
+	if err := mux.ReplaceHandler("GET /users/{id}", stringHandler("user2")); err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/people/1", nil))
+	if got := rec.Header().Get("Result"); got != "user2" {
+		t.Errorf("alias after ReplaceHandler() = %q, want %q", got, "user2")
+	}
+
+	merged := NewServeMux()
+	if err := merged.Merge(mux); err != nil {
+		t.Fatal(err)
+	}
+	if _, pattern := merged.Handler(r); pattern != "GET /users/{id}" {
+		t.Errorf("merged Handler() pattern = %q, want %q", pattern, "GET /users/{id}")
+	}
+
+	if err := mux.Deregister("GET /people/{id}"); err != nil {
+		t.Fatal(err)
+	}
+	if _, pattern := mux.Handler(r); pattern != "" {
+		t.Errorf("Handler() after deregistering the alias = %q", pattern)
+	}
+}
+
+func TestServeMuxMerge(t *testing.T) {
+	setParallel(t)
+
+	users := NewServeMux()
+	users.HandleNamed("user", "GET /users/{id}", stringHandler("GET /users/{id}"))
+	users.HandleWithMeta("/users/", stringHandler("/users/"), map[string]string{"k": "v"})
+
+	posts := NewServeMux()
+	posts.Handle("GET example.net/posts/{id}", stringHandler("GET example.net/posts/{id}"))
+
+	mux := NewServeMux()
+	mux.Handle("/", stringHandler("/"))
+	if err := mux.Merge(users); err != nil {
+		t.Fatalf("Merge() = %v", err)
+	}
+	if err := mux.Merge(posts); err != nil {
+		t.Fatalf("Merge() = %v", err)
+	}
+
+	tests := []struct {
+		url  string
+		code int
+		want string
+	}{
+		{"/users/1", http.StatusOK, "GET /users/{id}"},
+		{"/users/1/posts", http.StatusOK, "/users/"},
+		{"/users", http.StatusMovedPermanently, ""},
+		{"http://example.net/posts/1", http.StatusOK, "GET example.net/posts/{id}"},
+		{"/other", http.StatusOK, "/"},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.url, nil))
+		if got := rec.Header().Get("Result"); rec.Code != tt.code || got != tt.want {
+			t.Errorf("%s = %d %q, want %d %q", tt.url, rec.Code, got, tt.code, tt.want)
+		}
+	}
+	if u, err := mux.Reverse("user", map[string]string{"id": "1"}, nil); err != nil || u != "/users/1" {
+		t.Errorf("Reverse() = %q, %v, want %q", u, err, "/users/1")
+	}
+	if stats := mux.Stats(); stats.TotalPatterns != 4 {
+		t.Errorf("TotalPatterns = %d, want 4", stats.TotalPatterns)
+	}
+
+	conflicting := NewServeMux()
+	conflicting.Handle("/new", stringHandler("/new"))
+	conflicting.Handle("GET /users/{name}", stringHandler("GET /users/{name}"))
+	want := `http.ServeMux: pattern "GET /users/{name}" conflicts with "GET /users/{id}"`
+	if err := mux.Merge(conflicting); err == nil || err.Error() != want {
+		t.Errorf("Merge() = %v, want %q", err, want)
+	}
+	if mux.Has("/new") {
+		t.Error("failed Merge() left /new registered")
+	}
+
+	if err := mux.Merge(users); err == nil {
+		t.Error("Merge() of the same mux twice succeeded")
+	}
+	if err := mux.Merge(mux); err == nil {
+		t.Error("Merge() into itself succeeded")
+	}
+}
+
+func TestServeMuxHandleWithMeta(t *testing.T) {
+	setParallel(t)
+
+	var middlewareMeta, handlerMeta map[string]string
+	mux := NewServeMux()
+	mux.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			middlewareMeta = RouteMeta(r)
+			next.ServeHTTP(w, r)
+		})
+	})
+	meta := map[string]string{"tier": "admin"}
+	mux.HandleWithMeta("GET /admin/{page}", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handlerMeta = RouteMeta(r)
+	}), meta)
+	mux.Handle("/plain", stringHandler("plain"))
+	meta["tier"] = "mutated"
+
+	for _, method := range []string{http.MethodGet, http.MethodHead} {
+		middlewareMeta, handlerMeta = nil, nil
+		mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(method, "/admin/users", nil))
+		if got := middlewareMeta["tier"]; got != "admin" {
+			t.Errorf("%s: middleware RouteMeta = %v, want tier=admin", method, middlewareMeta)
+		}
+		if got := handlerMeta["tier"]; got != "admin" {
+			t.Errorf("%s: handler RouteMeta = %v, want tier=admin", method, handlerMeta)
+		}
+	}
+
+	middlewareMeta = map[string]string{}
+	mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/plain", nil))
+	if middlewareMeta != nil {
+		t.Errorf("RouteMeta = %v, want nil", middlewareMeta)
+	}
+	if got := RouteMeta(httptest.NewRequest(http.MethodGet, "/admin/users", nil)); got != nil {
+		t.Errorf("RouteMeta before routing = %v, want nil", got)
+	}
+}
+
+func TestServeMuxAllowedMethods(t *testing.T) {
+	setParallel(t)
+
+	mux := NewServeMux()
+	mux.Handle("GET /users/{id}", stringHandler("get"))
+	mux.Handle("DELETE /users/{id}", stringHandler("delete"))
+	mux.Handle("/anything", stringHandler("anything"))
+	mux.Handle("PUT example.net/things/{id}", stringHandler("put"))
+	mux.Handle("/subtree/", stringHandler("subtree"))
+
+	tests := []struct {
+		hostAndPath string
+		want        []string
+	}{
+		{"/users/1", []string{"DELETE", "GET", "HEAD"}},
+		{"/anything", []string{"*"}},
+		{"example.net/things/1", []string{"PUT"}},
+		{"example.net:8080/things/1", []string{"PUT"}},
+		{"/things/1", nil},
+		{"/subtree", nil},
+		{"/nothing", nil},
+	}
+	for _, tt := range tests {
+		if got := mux.AllowedMethods(tt.hostAndPath); fmt.Sprint(got) != fmt.Sprint(tt.want) || (got == nil) != (tt.want == nil) {
+			t.Errorf("AllowedMethods(%q) = %q, want %q", tt.hostAndPath, got, tt.want)
+		}
+	}
+}
+
+func TestServeMuxNamedEllipsisVar(t *testing.T) {
+	setParallel(t)
+
+	mux := NewServeMux()
+	mux.Handle("/files/{rest...}", stringHandler("files"))
+	mux.Handle("/{...}", stringHandler("root"))
+
+	tests := []struct {
+		path     string
+		pattern  string
+		pathVars map[string]string
+	}{
+		{"/files/a/b/c.txt", "/files/{rest...}", map[string]string{"rest": "a/b/c.txt"}},
+		{"/files/a/b/", "/files/{rest...}", map[string]string{"rest": "a/b/"}},
+		{"/files/", "/files/{rest...}", map[string]string{"rest": ""}},
+		{"/other/a", "/{...}", map[string]string{}},
+	}
+	for _, tt := range tests {
+		pattern, pathVars, _ := mux.Match(httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if pattern != tt.pattern || fmt.Sprint(pathVars) != fmt.Sprint(tt.pathVars) {
+			t.Errorf("%s = %q, %v, want %q, %v", tt.path, pattern, pathVars, tt.pattern, tt.pathVars)
+		}
+	}
+}
+
+func TestMatchedPattern(t *testing.T) {
+	setParallel(t)
+
+	var before, middleware, handler string
+	mux := NewServeMux()
+	mux.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			middleware = MatchedPattern(r.Context())
+			next.ServeHTTP(w, r)
+		})
+	})
+	mux.HandleFunc("GET /users/{id}", func(w http.ResponseWriter, r *http.Request) {
+		handler = MatchedPattern(r.Context())
+	})
+	outer := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		before = MatchedPattern(r.Context())
+		mux.ServeHTTP(w, r)
+	})
+
+	outer.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users/42", nil))
+	if before != "" {
+		t.Errorf("MatchedPattern before routing = %q, want empty", before)
+	}
+	if want := "GET /users/{id}"; middleware != want || handler != want {
+		t.Errorf("MatchedPattern = %q (middleware), %q (handler), want %q", middleware, handler, want)
+	}
+}
+
+func TestServeMuxHandleE(t *testing.T) {
+	setParallel(t)
+
+	mux := NewServeMux()
+	if err := mux.HandleE("GET /users/{id}", stringHandler("user")); err != nil {
+		t.Fatalf("HandleE() = %v", err)
+	}
+	if err := mux.HandleFuncE("POST /users/{id}", func(w http.ResponseWriter, r *http.Request) {}); err != nil {
+		t.Fatalf("HandleFuncE() = %v", err)
+	}
+
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{mux.HandleE("GET /users/{name}", stringHandler("dup")), `http.ServeMux: pattern "GET /users/{name}" conflicts with "GET /users/{id}"`},
+		{mux.HandleE("GET /bad/{", stringHandler("bad")), `http.ServeMux: each path element in a pattern path must either be a variable or not at position 9 in pattern "GET /bad/{": "{"`},
+		{mux.HandleE("/nil", nil), "http.ServeMux: nil handler"},
+		{mux.HandleFuncE("/nil", nil), "http.ServeMux: nil handler"},
+		{mux.HandleFuncE("POST /users/{name}", func(w http.ResponseWriter, r *http.Request) {}), `http.ServeMux: pattern "POST /users/{name}" conflicts with "POST /users/{id}"`},
+	}
+	for _, tt := range tests {
+		if tt.err == nil || tt.err.Error() != tt.want {
+			t.Errorf("error = %v, want %q", tt.err, tt.want)
+		}
+	}
+	if got, want := len(mux.AllRegisteredPatterns()), 2; got != want {
+		t.Errorf("registered %d patterns, want %d", got, want)
+	}
+}
+
+func BenchmarkMethodHandlerLookup(b *testing.B) {
+	methods := []string{
+		http.MethodConnect,
+		http.MethodDelete,
+		http.MethodGet,
+		http.MethodHead,
+		http.MethodOptions,
+		http.MethodPatch,
+		http.MethodPost,
+		http.MethodPut,
+		http.MethodTrace,
+		"PROPFIND",
+	}
+	for _, n := range []int{1, 3, 5, 10} {
+		m := map[string]*handlerTuple{}
+		mn := &serveMuxNode{}
+		for _, method := range methods[:n] {
+			ht := &handlerTuple{method: method}
+			m[method] = ht
+			mn.putMethodHandlerTuple(method, ht)
+		}
+		// Look up the last method, which is the worst case for the slice.
+		method := methods[n-1]
+
+		b.Run(fmt.Sprintf("Map/%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if m[method] == nil {
+					b.Fatal("not found")
+				}
+			}
+		})
+		b.Run(fmt.Sprintf("Slice/%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if mn.methodHandlerTuple(method) == nil {
+					b.Fatal("not found")
+				}
+			}
+		})
+	}
+}
+
+func TestServeMuxDrain(t *testing.T) {
+	setParallel(t)
+
+	started, release := make(chan struct{}), make(chan struct{})
+	mux := NewServeMux()
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.Header().Set("Result", "slow")
+	})
+	mux.Handle("/fast", stringHandler("fast"))
+
+	slow := httptest.NewRecorder()
+	served := make(chan struct{})
+	go func() {
+		mux.ServeHTTP(slow, httptest.NewRequest(http.MethodGet, "/slow", nil))
+		close(served)
+	}()
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := mux.Drain(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Drain() = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/fast", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("code while draining = %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+
+	close(release)
+	if err := mux.Drain(context.Background()); err != nil {
+		t.Errorf("Drain() = %v", err)
+	}
+	<-served
+	if got := slow.Header().Get("Result"); got != "slow" {
+		t.Errorf("in-flight request result = %q, want %q", got, "slow")
+	}
+}
+
+func TestServeMuxDrainConcurrent(t *testing.T) {
+	setParallel(t)
+
+	var running atomic.Int64
+	mux := NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		running.Add(1)
+		defer running.Add(-1)
+		time.Sleep(10 * time.Microsecond)
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				rec := httptest.NewRecorder()
+				mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+				if rec.Code != http.StatusOK && rec.Code != http.StatusServiceUnavailable {
+					t.Errorf("code = %d", rec.Code)
+				}
+			}
+		}()
+	}
+
+	time.Sleep(time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := mux.Drain(ctx); err != nil {
+		t.Errorf("Drain() = %v", err)
+	}
+	if n := running.Load(); n != 0 {
+		t.Errorf("running handlers after Drain = %d, want 0", n)
+	}
+	wg.Wait()
+}
+
+func TestServeMuxSwapTree(t *testing.T) {
+	setParallel(t)
+
+	mux := NewServeMux()
+	mux.Use(func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Middleware", "yes")
+			h.ServeHTTP(w, r)
+		})
+	})
+	mux.Handle("/old", stringHandler("old"))
+
+	newMux := NewServeMux()
+	newMux.Handle("/users/{id}/posts/{post}", stringHandler("post"))
+	newMux.Handle("example.net/", stringHandler("example.net/"))
+	newMux.HandleNamed("user", "/users/{id}", stringHandler("user"))
+	mux.SwapTree(newMux)
+	newMux.Handle("/later", stringHandler("later"))
+
+	for _, tt := range []struct {
+		url  string
+		code int
+		want string
+	}{
+		{"/old", http.StatusNotFound, ""},
+		{"/later", http.StatusNotFound, ""},
+		{"/users/1/posts/2", http.StatusOK, "post"},
+		{"http://example.net/", http.StatusOK, "example.net/"},
+		{"/users/1", http.StatusOK, "user"},
+	} {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.url, nil))
+		if got := rec.Header().Get("Result"); rec.Code != tt.code || got != tt.want {
+			t.Errorf("%s = %d %q, want %d %q", tt.url, rec.Code, got, tt.code, tt.want)
+		}
+		if tt.code == http.StatusOK && rec.Header().Get("Middleware") != "yes" {
+			t.Errorf("%s: middleware was not kept by SwapTree()", tt.url)
+		}
+	}
+	if u, err := mux.Reverse("user", map[string]string{"id": "1"}, nil); err != nil || u != "/users/1" {
+		t.Errorf("Reverse() = %q, %v, want %q", u, err, "/users/1")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("expected a nil mux to panic")
+		}
+	}()
+	mux.SwapTree(nil)
+}
+
+func TestServeMuxReset(t *testing.T) {
+	setParallel(t)
+
+	mux := NewServeMux()
+	mux.Use(func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Middleware", "yes")
+			h.ServeHTTP(w, r)
+		})
+	})
+	mux.Handle("/users/{id}/posts/{post}", stringHandler("post"))
+	mux.Handle("example.net/", stringHandler("example.net/"))
+	mux.Handle("*.example.org/", stringHandler("*.example.org/"))
+	mux.HandleNamed("user", "/users/{id}", stringHandler("user"))
+
+	mux.Reset()
+
+	for _, url := range []string{"/users/1/posts/2", "http://example.net/", "http://foo.example.org/", "/users/1"} {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, url, nil))
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("after Reset(), %s = %d, want %d", url, rec.Code, http.StatusNotFound)
+		}
+	}
+	if got := mux.AllRegisteredPatterns(); len(got) != 0 {
+		t.Errorf("after Reset(), registered patterns = %q", got)
+	}
+	if _, err := mux.Reverse("user", map[string]string{"id": "1"}, nil); err == nil {
+		t.Error("after Reset(), Reverse() succeeded")
+	}
+
+	mux.Handle("/users/{id}", stringHandler("user"))
+	mux.HandleNamed("user", "/users/{id}/profile", stringHandler("profile"))
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/users/1", nil))
+	if got := rec.Header().Get("Result"); got != "user" {
+		t.Errorf("re-registered /users/1 = %q, want %q", got, "user")
+	}
+	if got := rec.Header().Get("Middleware"); got != "yes" {
+		t.Error("middleware was not kept by Reset()")
+	}
+}
+
+func TestServeMuxAddPathVarValidator(t *testing.T) {
+	setParallel(t)
+
+	isDigits := func(v string) bool {
+		for i := 0; i < len(v); i++ {
+			if v[i] < '0' || v[i] > '9' {
+				return false
+			}
+		}
+		return v != ""
+	}
+
+	mux := NewServeMux()
+	mux.AddPathVarValidator("id", isDigits)
+	mux.AddPathVarValidator("id", func(v string) bool { return len(v) <= 3 })
+	mux.Handle("GET /users/{id}", stringHandler("id"))
+	mux.Handle("GET /users/{name...}", stringHandler("name"))
+	mux.Handle("GET /posts/{id}", stringHandler("post"))
+	mux.Handle("GET /posts/{id}/{rest...}", stringHandler("post-rest"))
+
+	for _, tt := range []struct {
+		path string
+		code int
+		want string
+	}{
+		{"/users/42", http.StatusOK, "id"},
+		{"/users/bob", http.StatusOK, "name"},
+		{"/users/1234", http.StatusOK, "name"},
+		{"/posts/7", http.StatusOK, "post"},
+		{"/posts/x", http.StatusNotFound, ""},
+		{"/posts/7/a/b", http.StatusOK, "post-rest"},
+		{"/posts/x/a/b", http.StatusNotFound, ""},
+	} {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if rec.Code != tt.code || rec.Header().Get("Result") != tt.want {
+			t.Errorf("%s = %d %q, want %d %q", tt.path, rec.Code, rec.Header().Get("Result"), tt.code, tt.want)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/posts/7", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST /posts/7 = %d, want %d", rec.Code, http.StatusMethodNotAllowed)
+	}
+
+	c := mux.Clone()
+	rec = httptest.NewRecorder()
+	c.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/posts/x", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("cloned /posts/x = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
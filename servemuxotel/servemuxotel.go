@@ -0,0 +1,113 @@
+// Package servemuxotel provides OpenTelemetry tracing for the
+// [servemux.ServeMux].
+package servemuxotel
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/aofei/servemux"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// WithOTelTracer returns a [servemux.Option] that makes a [servemux.ServeMux]
+// start a server span with the tracer for each request that matches a
+// registered pattern, and end it when the handler returns.
+//
+// The span is named "<METHOD> <route>", where the route is the matched
+// pattern without its method, so that the span names do not depend on the
+// values of path variables. The incoming trace context is extracted from the
+// request headers using the global [propagation.TextMapPropagator]. The span
+// has the attributes "http.method", "http.route" and "http.status_code".
+//
+// Since the span is started by a middleware (see the [servemux.ServeMux.Use]),
+// requests that match no pattern are not traced.
+func WithOTelTracer(tracer trace.Tracer) servemux.Option {
+	return func(mux *servemux.ServeMux) {
+		mux.Use(func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				route := servemux.MatchedPattern(r.Context())
+				if _, hostpath, ok := strings.Cut(route, " "); ok {
+					route = hostpath
+				}
+
+				ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+				ctx, span := tracer.Start(
+					ctx,
+					r.Method+" "+route,
+					trace.WithSpanKind(trace.SpanKindServer),
+					trace.WithAttributes(
+						attribute.String("http.method", r.Method),
+						attribute.String("http.route", route),
+					),
+				)
+				defer span.End()
+
+				sr := &statusRecorder{ResponseWriter: w}
+				defer func() {
+					code := sr.code
+					if code == 0 {
+						code = http.StatusOK
+					}
+					span.SetAttributes(attribute.Int("http.status_code", code))
+					if code >= http.StatusInternalServerError {
+						span.SetStatus(codes.Error, http.StatusText(code))
+					}
+				}()
+
+				next.ServeHTTP(sr, r.WithContext(ctx))
+			})
+		})
+	}
+}
+
+// statusRecorder is an [http.ResponseWriter] that records the status code of
+// the response. Handlers can reach the optional interfaces of the underlying
+// [http.ResponseWriter] through its Unwrap, as the [http.ResponseController]
+// does, and through its Flush and Hijack, as is common for streaming and
+// WebSocket handlers.
+type statusRecorder struct {
+	http.ResponseWriter
+	code int
+}
+
+// WriteHeader implements the [http.ResponseWriter].
+func (sr *statusRecorder) WriteHeader(code int) {
+	if sr.code == 0 && code >= 200 {
+		sr.code = code
+	}
+	sr.ResponseWriter.WriteHeader(code)
+}
+
+// Write implements the [http.ResponseWriter].
+func (sr *statusRecorder) Write(b []byte) (int, error) {
+	if sr.code == 0 {
+		sr.code = http.StatusOK
+	}
+	return sr.ResponseWriter.Write(b)
+}
+
+// Flush implements the [http.Flusher].
+func (sr *statusRecorder) Flush() {
+	if sr.code == 0 {
+		sr.code = http.StatusOK
+	}
+	http.NewResponseController(sr.ResponseWriter).Flush()
+}
+
+// Hijack implements the [http.Hijacker].
+func (sr *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(sr.ResponseWriter).Hijack()
+}
+
+// Unwrap returns the underlying [http.ResponseWriter], for the
+// [http.ResponseController].
+func (sr *statusRecorder) Unwrap() http.ResponseWriter {
+	return sr.ResponseWriter
+}
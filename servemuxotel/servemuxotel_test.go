@@ -0,0 +1,103 @@
+package servemuxotel
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aofei/servemux"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestWithOTelTracer(t *testing.T) {
+	sr := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+	mux := servemux.NewServeMux(WithOTelTracer(tp.Tracer("test")))
+
+	var handlerSpan trace.SpanContext
+	mux.HandleFunc("GET /users/{id}", func(w http.ResponseWriter, r *http.Request) {
+		handlerSpan = trace.SpanContextFromContext(r.Context())
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	mux.HandleFunc("/ok", func(w http.ResponseWriter, r *http.Request) {})
+
+	mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users/1", nil))
+	mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/ok", nil))
+	mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/nothing", nil))
+
+	spans := sr.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("got %d spans, want 2", len(spans))
+	}
+
+	tests := []struct {
+		name   string
+		route  string
+		method string
+		code   int64
+		status codes.Code
+	}{
+		{"GET /users/{id}", "/users/{id}", http.MethodGet, http.StatusInternalServerError, codes.Error},
+		{"POST /ok", "/ok", http.MethodPost, http.StatusOK, codes.Unset},
+	}
+	for i, tt := range tests {
+		span := spans[i]
+		if span.Name() != tt.name {
+			t.Errorf("span #%d name = %q, want %q", i, span.Name(), tt.name)
+		}
+		if span.SpanKind() != trace.SpanKindServer {
+			t.Errorf("span #%d kind = %v, want %v", i, span.SpanKind(), trace.SpanKindServer)
+		}
+		if span.Status().Code != tt.status {
+			t.Errorf("span #%d status = %v, want %v", i, span.Status().Code, tt.status)
+		}
+		attrs := map[attribute.Key]attribute.Value{}
+		for _, kv := range span.Attributes() {
+			attrs[kv.Key] = kv.Value
+		}
+		if got := attrs["http.method"].AsString(); got != tt.method {
+			t.Errorf("span #%d http.method = %q, want %q", i, got, tt.method)
+		}
+		if got := attrs["http.route"].AsString(); got != tt.route {
+			t.Errorf("span #%d http.route = %q, want %q", i, got, tt.route)
+		}
+		if got := attrs["http.status_code"].AsInt64(); got != tt.code {
+			t.Errorf("span #%d http.status_code = %d, want %d", i, got, tt.code)
+		}
+	}
+
+	if handlerSpan.SpanID() != spans[0].SpanContext().SpanID() {
+		t.Error("handler did not see the span in its context")
+	}
+}
+
+func TestWithOTelTracerPropagation(t *testing.T) {
+	sr := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+	mux := servemux.NewServeMux(WithOTelTracer(tp.Tracer("test")))
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {})
+
+	defer otel.SetTextMapPropagator(otel.GetTextMapPropagator())
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Traceparent", "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+	mux.ServeHTTP(httptest.NewRecorder(), r)
+
+	spans := sr.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("got %d spans, want 1", len(spans))
+	}
+	if got, want := spans[0].Parent().TraceID().String(), "0af7651916cd43dd8448eb211c80319c"; got != want {
+		t.Errorf("parent trace ID = %q, want %q", got, want)
+	}
+	if got, want := spans[0].Parent().SpanID().String(), "b7ad6b7169203331"; got != want {
+		t.Errorf("parent span ID = %q, want %q", got, want)
+	}
+}
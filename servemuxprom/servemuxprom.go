@@ -0,0 +1,88 @@
+// Package servemuxprom provides Prometheus metrics for the
+// [servemux.ServeMux].
+package servemuxprom
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aofei/servemux"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// WithPrometheus returns a [servemux.Option] that makes a [servemux.ServeMux]
+// maintain the following metrics in the reg for each request that matches a
+// registered pattern, all labeled by "method" and "route":
+//
+//   - http_request_duration_seconds, a histogram of the handler durations
+//   - http_requests_total, a counter of the handled requests
+//   - http_requests_in_flight, a gauge of the requests being handled
+//
+// The route is the matched pattern without its method, so that the label
+// values do not depend on the values of path variables. A nil reg means the
+// [prometheus.DefaultRegisterer]. Metrics already registered in the reg, such
+// as by another mux, are shared. WithPrometheus panics if the metrics cannot
+// be registered.
+//
+// Since the metrics are maintained by a middleware (see the
+// [servemux.ServeMux.Use]), requests that match no pattern are not counted.
+func WithPrometheus(reg prometheus.Registerer) servemux.Option {
+	if reg == nil {
+		reg = prometheus.DefaultRegisterer
+	}
+
+	labelNames := []string{"method", "route"}
+	duration := register(reg, prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "Duration of HTTP requests in seconds.",
+		Buckets: prometheus.DefBuckets,
+	}, labelNames))
+	total := register(reg, prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "Total number of HTTP requests.",
+	}, labelNames))
+	inFlight := register(reg, prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "http_requests_in_flight",
+		Help: "Number of HTTP requests being handled.",
+	}, labelNames))
+
+	return func(mux *servemux.ServeMux) {
+		mux.Use(func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				route := servemux.MatchedPattern(r.Context())
+				if _, hostpath, ok := strings.Cut(route, " "); ok {
+					route = hostpath
+				}
+
+				labels := prometheus.Labels{"method": r.Method, "route": route}
+				g := inFlight.With(labels)
+				g.Inc()
+				start := time.Now()
+				defer func() {
+					g.Dec()
+					duration.With(labels).Observe(time.Since(start).Seconds())
+					total.With(labels).Inc()
+				}()
+
+				next.ServeHTTP(w, r)
+			})
+		})
+	}
+}
+
+// register registers the c in the reg. It returns the already registered
+// collector if there is one.
+func register[C prometheus.Collector](reg prometheus.Registerer, c C) C {
+	if err := reg.Register(c); err != nil {
+		var are prometheus.AlreadyRegisteredError
+		if errors.As(err, &are) {
+			if existing, ok := are.ExistingCollector.(C); ok {
+				return existing
+			}
+		}
+		panic("servemuxprom: " + err.Error())
+	}
+	return c
+}
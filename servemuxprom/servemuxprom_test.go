@@ -0,0 +1,72 @@
+package servemuxprom
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aofei/servemux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestWithPrometheus(t *testing.T) {
+	reg := prometheus.NewRegistry()
+
+	var inFlight float64
+	mux := servemux.NewServeMux(WithPrometheus(reg))
+	mux.HandleFunc("GET /users/{id}", func(w http.ResponseWriter, r *http.Request) {
+		mfs, err := reg.Gather()
+		if err != nil {
+			t.Fatalf("Gather() = %v", err)
+		}
+		for _, mf := range mfs {
+			if mf.GetName() == "http_requests_in_flight" {
+				inFlight = mf.GetMetric()[0].GetGauge().GetValue()
+			}
+		}
+	})
+
+	for _, path := range []string{"/users/1", "/users/2", "/nothing"} {
+		mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+	if inFlight != 1 {
+		t.Errorf("in-flight requests during handling = %v, want 1", inFlight)
+	}
+
+	// A second mux shares the metrics.
+	other := servemux.NewServeMux(WithPrometheus(reg))
+	other.HandleFunc("GET /users/{id}", func(w http.ResponseWriter, r *http.Request) {})
+	other.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users/3", nil))
+
+	const want = `
+# HELP http_requests_in_flight Number of HTTP requests being handled.
+# TYPE http_requests_in_flight gauge
+http_requests_in_flight{method="GET",route="/users/{id}"} 0
+# HELP http_requests_total Total number of HTTP requests.
+# TYPE http_requests_total counter
+http_requests_total{method="GET",route="/users/{id}"} 3
+`
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(want), "http_requests_total", "http_requests_in_flight"); err != nil {
+		t.Error(err)
+	}
+	if got := testutil.CollectAndCount(reg, "http_request_duration_seconds"); got != 1 {
+		t.Errorf("got %d duration series, want 1", got)
+	}
+}
+
+func TestWithPrometheusRegistrationFailure(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "Something else.",
+	}))
+
+	defer func() {
+		if recover() == nil {
+			t.Error("WithPrometheus() did not panic")
+		}
+	}()
+	WithPrometheus(reg)
+}
@@ -0,0 +1,122 @@
+package servemuxtest
+
+import (
+	"math/rand"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// PatternFuzzer generates random patterns that are syntactically valid for the
+// [servemux.ServeMux], for property-based tests. They cover method-less,
+// host-only and path-only patterns, hosts with ports and variable labels, and
+// paths with any number of elements of every kind, including the
+// "{[name]...}", "{$}" and "{[name]?}" ones. Two patterns generated by it may
+// conflict with each other.
+type PatternFuzzer struct {
+	rand *rand.Rand
+}
+
+// NewPatternFuzzer returns a new [PatternFuzzer] that generates the same
+// patterns for the same seed.
+func NewPatternFuzzer(seed int64) *PatternFuzzer {
+	return &PatternFuzzer{rand: rand.New(rand.NewSource(seed))}
+}
+
+// fuzzerMethods is the methods used by the [PatternFuzzer], where "" means no
+// method.
+var fuzzerMethods = []string{"", "", "GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS", "PURGE"}
+
+// fuzzerHosts is the hosts used by the [PatternFuzzer], where "" means no
+// host.
+var fuzzerHosts = []string{
+	"", "", "", "",
+	"example.com",
+	"api.example.com",
+	"example.com:8080",
+	"127.0.0.1",
+	"{tenant}.example.com",
+	"*.example.com",
+	"{}.*.example.com",
+}
+
+// Next returns the next pattern generated by the pf.
+func (pf *PatternFuzzer) Next() string {
+	method := fuzzerMethods[pf.rand.Intn(len(fuzzerMethods))]
+	host := fuzzerHosts[pf.rand.Intn(len(fuzzerHosts))]
+
+	var path string
+	if host == "" || pf.rand.Intn(4) > 0 {
+		path = pf.path()
+	}
+
+	var b strings.Builder
+	if method != "" {
+		b.WriteString(method)
+		b.WriteByte(' ')
+	}
+	b.WriteString(host)
+	b.WriteString(path)
+	return b.String()
+}
+
+// path returns a random pattern path.
+func (pf *PatternFuzzer) path() string {
+	var (
+		b     strings.Builder
+		n     = pf.rand.Intn(5)
+		names int
+	)
+	name := func() string {
+		names++
+		return "v" + strconv.Itoa(names)
+	}
+	for i := 0; i < n; i++ {
+		b.WriteByte('/')
+		switch pf.rand.Intn(5) {
+		case 0:
+			b.WriteString("{" + name() + "}")
+		case 1:
+			b.WriteString("{}")
+		case 2:
+			b.WriteString("{" + name() + ":[0-9]+}")
+		default:
+			b.WriteString(pf.word())
+		}
+	}
+
+	switch pf.rand.Intn(6) {
+	case 0:
+		b.WriteString("/")
+	case 1:
+		b.WriteString("/{" + name() + "...}")
+	case 2:
+		b.WriteString("/{$}")
+	case 3:
+		if n > 0 {
+			b.WriteString("/{" + name() + "?}")
+		}
+	}
+	if b.Len() == 0 {
+		return "/"
+	}
+	return b.String()
+}
+
+// word returns a random non-variable path element.
+func (pf *PatternFuzzer) word() string {
+	const letters = "abcdefghijklmnopqrstuvwxyz0123456789-_~"
+	w := make([]byte, 1+pf.rand.Intn(8))
+	for i := range w {
+		w[i] = letters[pf.rand.Intn(len(letters))]
+	}
+	return string(w)
+}
+
+// RegisterFuzzCorpus adds the next 64 patterns generated by the pf to the seed
+// corpus of the f, for fuzz targets taking a single pattern string.
+func (pf *PatternFuzzer) RegisterFuzzCorpus(f *testing.F) {
+	for i := 0; i < 64; i++ {
+		f.Add(pf.Next())
+	}
+}
@@ -0,0 +1,60 @@
+package servemuxtest
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/aofei/servemux"
+)
+
+func TestPatternFuzzer(t *testing.T) {
+	pf := NewPatternFuzzer(1)
+	seen := map[string]bool{}
+	for i := 0; i < 2000; i++ {
+		pattern := pf.Next()
+		if err := servemux.ValidatePattern(pattern); err != nil {
+			t.Fatalf("generated invalid pattern %q: %v", pattern, err)
+		}
+		seen[pattern] = true
+	}
+
+	for _, want := range []string{"...}", "{$}", "?}", ":8080", "{}", ":[0-9]+}", "GET "} {
+		found := false
+		for pattern := range seen {
+			if strings.Contains(pattern, want) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			t.Errorf("no generated pattern contains %q", want)
+		}
+	}
+
+	pf1, pf2 := NewPatternFuzzer(42), NewPatternFuzzer(42)
+	for i := 0; i < 100; i++ {
+		if p1, p2 := pf1.Next(), pf2.Next(); p1 != p2 {
+			t.Fatalf("got %q and %q for the same seed", p1, p2)
+		}
+	}
+}
+
+func FuzzPatternRegistration(f *testing.F) {
+	NewPatternFuzzer(1).RegisterFuzzCorpus(f)
+	f.Fuzz(func(t *testing.T, pattern string) {
+		if servemux.ValidatePattern(pattern) != nil {
+			return
+		}
+		mux := servemux.NewServeMux()
+		if err := mux.HandleE(pattern, http.NotFoundHandler()); err != nil {
+			t.Errorf("HandleE(%q) = %v", pattern, err)
+		}
+		if !mux.Has(pattern) {
+			t.Errorf("Has(%q) = false after registering it", pattern)
+		}
+		if err := mux.Deregister(pattern); err != nil {
+			t.Errorf("Deregister(%q) = %v", pattern, err)
+		}
+	})
+}
@@ -0,0 +1,194 @@
+// Package servemuxtest provides utilities for testing code that uses the
+// [servemux.ServeMux].
+package servemuxtest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+
+	"github.com/aofei/servemux"
+)
+
+// TestRoute is a route registered by the [NewTestMux], along with a request
+// that is expected to match it.
+type TestRoute struct {
+	// Pattern is the registered pattern.
+	Pattern string
+
+	// Method, Host and Path describe a request that is expected to match
+	// the Pattern.
+	Method string
+	Host   string
+	Path   string
+
+	// PathVars is the expected path variables of the request.
+	PathVars map[string]string
+}
+
+// testRoutes is the routes registered by the [NewTestMux].
+var testRoutes = []TestRoute{
+	{"GET /{$}", "GET", "example.org", "/", nil},
+	{"GET /static", "GET", "example.org", "/static", nil},
+	{"GET /static/nested/file.txt", "GET", "example.org", "/static/nested/file.txt", nil},
+	{"GET /users/{id}", "GET", "example.org", "/users/42", map[string]string{"id": "42"}},
+	{"PUT /users/{id}", "PUT", "example.org", "/users/42", map[string]string{"id": "42"}},
+	{"DELETE /users/{id}", "DELETE", "example.org", "/users/42", map[string]string{"id": "42"}},
+	{"GET /users/{id}/posts/{post}", "GET", "example.org", "/users/42/posts/7", map[string]string{"id": "42", "post": "7"}},
+	{"GET /users/{id}/posts/latest", "GET", "example.org", "/users/42/posts/latest", map[string]string{"id": "42"}},
+	{"GET /files/{path...}", "GET", "example.org", "/files/a/b/c.txt", map[string]string{"path": "a/b/c.txt"}},
+	{"/assets/", "POST", "example.org", "/assets/css/site.css", nil},
+	{"/any", "PATCH", "example.org", "/any", nil},
+	{"GET example.com/", "GET", "example.com", "/about", nil},
+	{"GET example.com/users/{id}", "GET", "example.com", "/users/42", map[string]string{"id": "42"}},
+	{"GET *.example.net/", "GET", "tenant.example.net", "/dashboard", nil},
+	{"CONNECT example.com:8080", "CONNECT", "example.com:8080", "", nil},
+}
+
+// GetTestRoutes returns the routes registered by the [NewTestMux]. The returned
+// slice is a copy, so callers may modify it.
+func GetTestRoutes() []TestRoute {
+	routes := make([]TestRoute, len(testRoutes))
+	for i, route := range testRoutes {
+		routes[i] = route
+		if route.PathVars != nil {
+			routes[i].PathVars = make(map[string]string, len(route.PathVars))
+			for k, v := range route.PathVars {
+				routes[i].PathVars[k] = v
+			}
+		}
+	}
+	return routes
+}
+
+// NewTestMux returns a new [servemux.ServeMux] with all the routes returned by
+// the [GetTestRoutes] registered. Each registered handler sets the "Pattern"
+// response header to its pattern.
+func NewTestMux() *servemux.ServeMux {
+	mux := servemux.NewServeMux()
+	for _, route := range testRoutes {
+		pattern := route.Pattern
+		mux.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Pattern", pattern)
+		})
+	}
+	return mux
+}
+
+// MakeTestRequest returns a new request that is expected to match the route.
+// The returned request is configured to store path variables.
+func MakeTestRequest(route TestRoute) *http.Request {
+	target := "http://" + route.Host + route.Path
+	if route.Method == http.MethodConnect {
+		target = route.Host
+	}
+	r := httptest.NewRequest(route.Method, target, nil)
+	return servemux.ConfigureRequestToStorePathVars(r)
+}
+
+// RecordedRoute is a request dispatched by a [servemux.ServeMux] to a
+// registered pattern, as recorded by a [RouteRecorder].
+type RecordedRoute struct {
+	Method  string
+	Path    string
+	Pattern string
+}
+
+// RouteRecorder records the requests dispatched by a [servemux.ServeMux] to
+// its registered patterns, so that tests can verify that every pattern has
+// been exercised. Identical requests are recorded once along with how many
+// times they were dispatched, so the memory used by a RouteRecorder does not
+// grow with repeated requests. It is safe for concurrent use.
+type RouteRecorder struct {
+	mux     *servemux.ServeMux
+	mu      sync.Mutex
+	records []RecordedRoute
+	counts  map[RecordedRoute]int
+}
+
+// NewRecordingTestMux is like the [NewTestMux], but it also returns a
+// [RouteRecorder] that records the requests dispatched by the returned mux.
+func NewRecordingTestMux() (*servemux.ServeMux, *RouteRecorder) {
+	mux := NewTestMux()
+	return mux, NewRouteRecorder(mux)
+}
+
+// NewRouteRecorder returns a new [RouteRecorder] that records the requests
+// dispatched by the mux, using a middleware added by the
+// [servemux.ServeMux.Use]. Requests that match no pattern are not recorded.
+func NewRouteRecorder(mux *servemux.ServeMux) *RouteRecorder {
+	rr := &RouteRecorder{mux: mux, counts: map[RecordedRoute]int{}}
+	mux.Use(func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if pattern := servemux.MatchedPattern(r.Context()); pattern != "" {
+				record := RecordedRoute{r.Method, r.URL.Path, pattern}
+				rr.mu.Lock()
+				if rr.counts[record] == 0 {
+					rr.records = append(rr.records, record)
+				}
+				rr.counts[record]++
+				rr.mu.Unlock()
+			}
+			h.ServeHTTP(w, r)
+		})
+	})
+	return rr
+}
+
+// Records returns the distinct recorded routes in the order they were first
+// dispatched.
+func (rr *RouteRecorder) Records() []RecordedRoute {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+	return append([]RecordedRoute(nil), rr.records...)
+}
+
+// Count returns the number of requests dispatched to the pattern.
+func (rr *RouteRecorder) Count(pattern string) int {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+	n := 0
+	for record, count := range rr.counts {
+		if record.Pattern == pattern {
+			n += count
+		}
+	}
+	return n
+}
+
+// Covered returns the patterns that have been matched at least once, in
+// lexical order.
+func (rr *RouteRecorder) Covered() []string {
+	covered := rr.covered()
+	patterns := make([]string, 0, len(covered))
+	for pattern := range covered {
+		patterns = append(patterns, pattern)
+	}
+	sort.Strings(patterns)
+	return patterns
+}
+
+// Uncovered returns the patterns registered with the mux that have never been
+// matched, in lexical order.
+func (rr *RouteRecorder) Uncovered() []string {
+	covered := rr.covered()
+	patterns := []string{}
+	for _, pattern := range rr.mux.AllRegisteredPatterns() {
+		if !covered[pattern] {
+			patterns = append(patterns, pattern)
+		}
+	}
+	return patterns
+}
+
+// covered returns the set of the patterns that have been matched.
+func (rr *RouteRecorder) covered() map[string]bool {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+	covered := make(map[string]bool, len(rr.records))
+	for _, record := range rr.records {
+		covered[record.Pattern] = true
+	}
+	return covered
+}
@@ -0,0 +1,78 @@
+package servemuxtest
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/aofei/servemux"
+)
+
+func TestNewTestMux(t *testing.T) {
+	mux := NewTestMux()
+	for _, route := range GetTestRoutes() {
+		req := MakeTestRequest(route)
+		h, pattern := mux.Handler(req)
+		if got, want := pattern, route.Pattern; got != want {
+			t.Errorf("%s %s%s: pattern = %q, want %q", route.Method, route.Host, route.Path, got, want)
+			continue
+		}
+
+		pathVars := servemux.PathVars(req)
+		for k, want := range route.PathVars {
+			if got := pathVars[k]; got != want {
+				t.Errorf("%s %s%s: PathVars[%q] = %q, want %q", route.Method, route.Host, route.Path, k, got, want)
+			}
+		}
+
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if got, want := rec.Header().Get("Pattern"), route.Pattern; got != want {
+			t.Errorf("%s %s%s: Pattern = %q, want %q", route.Method, route.Host, route.Path, got, want)
+		}
+	}
+}
+
+func TestRouteRecorder(t *testing.T) {
+	mux, rr := NewRecordingTestMux()
+
+	routes := GetTestRoutes()
+	var wg sync.WaitGroup
+	for _, route := range routes[1:] {
+		wg.Add(1)
+		go func(route TestRoute) {
+			defer wg.Done()
+			mux.ServeHTTP(httptest.NewRecorder(), MakeTestRequest(route))
+		}(route)
+	}
+	wg.Wait()
+	mux.ServeHTTP(httptest.NewRecorder(), MakeTestRequest(TestRoute{Method: "GET", Host: "example.org", Path: "/missing"}))
+
+	mux.ServeHTTP(httptest.NewRecorder(), MakeTestRequest(routes[1]))
+
+	if got, want := rr.Count(routes[1].Pattern), 2; got != want {
+		t.Errorf("Count(%q) = %d, want %d", routes[1].Pattern, got, want)
+	}
+	if got, want := rr.Count(routes[2].Pattern), 1; got != want {
+		t.Errorf("Count(%q) = %d, want %d", routes[2].Pattern, got, want)
+	}
+	records := rr.Records()
+	if got, want := len(records), len(routes)-1; got != want {
+		t.Errorf("recorded %d distinct routes, want %d", got, want)
+	}
+	want := RecordedRoute{Method: "GET", Path: "/users/42", Pattern: "GET /users/{id}"}
+	found := false
+	for _, record := range records {
+		found = found || record == want
+	}
+	if !found {
+		t.Errorf("Records() = %v, want it to contain %v", records, want)
+	}
+	if got, want := len(rr.Covered()), len(routes)-1; got != want {
+		t.Errorf("covered %d patterns, want %d", got, want)
+	}
+	if got, want := rr.Uncovered(), []string{routes[0].Pattern}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Uncovered() = %q, want %q", got, want)
+	}
+}
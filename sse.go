@@ -0,0 +1,126 @@
+package servemux
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// SSEWriter writes Server-Sent Events to a client. See the
+// [ServeMux.HandleSSE].
+type SSEWriter interface {
+	// Send sends an event of the event type with the data, which may span
+	// multiple lines. An empty event sends an unnamed event, which
+	// clients receive as a "message" event.
+	Send(event, data string) error
+
+	// Comment sends the text as a comment, which clients ignore, such as
+	// to keep the connection alive.
+	Comment(text string) error
+
+	// Flush flushes any buffered data to the client.
+	Flush() error
+}
+
+// errSSEClosed is the error returned by an [SSEWriter] once the client has
+// disconnected.
+var errSSEClosed = errors.New("http.ServeMux: server-sent event stream closed")
+
+// HandleSSE registers the handler for the pattern to serve a Server-Sent Event
+// stream. The response headers for the stream are set and sent before the
+// handler is called in its own goroutine, and each event is flushed as soon as
+// it has been sent. When the client disconnects, the response is finished
+// without waiting for the handler, whose request context is done and whose
+// [SSEWriter] returns an error from then on.
+func (mux *ServeMux) HandleSSE(pattern string, handler func(sse SSEWriter, r *http.Request)) {
+	if handler == nil {
+		panic("http.ServeMux: nil handler")
+	}
+	mux.Handle(pattern, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := w.Header()
+		h.Set("Content-Type", "text/event-stream")
+		h.Set("Cache-Control", "no-cache")
+		if r.ProtoMajor == 1 {
+			h.Set("Connection", "keep-alive")
+		}
+		w.WriteHeader(http.StatusOK)
+
+		sw := &sseWriter{w: w, rc: http.NewResponseController(w)}
+		sw.Flush()
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			handler(sw, r)
+		}()
+		select {
+		case <-done:
+		case <-r.Context().Done():
+			sw.close()
+		}
+	}))
+}
+
+// sseWriter is the [SSEWriter] of the [ServeMux.HandleSSE].
+type sseWriter struct {
+	mu     sync.Mutex
+	w      http.ResponseWriter
+	rc     *http.ResponseController
+	closed bool
+}
+
+// Send implements the [SSEWriter].
+func (sw *sseWriter) Send(event, data string) error {
+	var b strings.Builder
+	if event != "" {
+		b.WriteString("event: " + event + "\n")
+	}
+	for _, line := range strings.Split(data, "\n") {
+		b.WriteString("data: " + line + "\n")
+	}
+	b.WriteString("\n")
+	return sw.write(b.String())
+}
+
+// Comment implements the [SSEWriter].
+func (sw *sseWriter) Comment(text string) error {
+	var b strings.Builder
+	for _, line := range strings.Split(text, "\n") {
+		b.WriteString(": " + line + "\n")
+	}
+	b.WriteString("\n")
+	return sw.write(b.String())
+}
+
+// Flush implements the [SSEWriter].
+func (sw *sseWriter) Flush() error {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	if sw.closed {
+		return errSSEClosed
+	}
+	return sw.rc.Flush()
+}
+
+// write writes the s to the client and flushes it.
+func (sw *sseWriter) write(s string) error {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	if sw.closed {
+		return errSSEClosed
+	}
+	if _, err := io.WriteString(sw.w, s); err != nil {
+		return err
+	}
+	return sw.rc.Flush()
+}
+
+// close makes the sw return an error from then on, so that the response is no
+// longer written after the handler of the stream has returned.
+func (sw *sseWriter) close() {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	sw.closed = true
+}
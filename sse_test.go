@@ -0,0 +1,53 @@
+package servemux
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestServeMuxHandleSSE(t *testing.T) {
+	setParallel(t)
+
+	mux := NewServeMux()
+	mux.HandleSSE("GET /events", func(sse SSEWriter, r *http.Request) {
+		sse.Comment("hello")
+		sse.Send("", "a")
+		sse.Send("update", "b\nc")
+	})
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/events", nil))
+	if got, want := rec.Header().Get("Content-Type"), "text/event-stream"; got != want {
+		t.Errorf("Content-Type = %q, want %q", got, want)
+	}
+	if got, want := rec.Header().Get("Cache-Control"), "no-cache"; got != want {
+		t.Errorf("Cache-Control = %q, want %q", got, want)
+	}
+	if !rec.Flushed {
+		t.Error("the stream was not flushed")
+	}
+	if got, want := rec.Body.String(), ": hello\n\ndata: a\n\nevent: update\ndata: b\ndata: c\n\n"; got != want {
+		t.Errorf("body = %q, want %q", got, want)
+	}
+
+	errc := make(chan error, 1)
+	release := make(chan struct{})
+	mux.HandleSSE("GET /forever", func(sse SSEWriter, r *http.Request) {
+		<-r.Context().Done()
+		<-release
+		errc <- sse.Send("", "late")
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/forever", nil).WithContext(ctx))
+	close(release)
+	if err := <-errc; err == nil {
+		t.Error("expected sending after the client disconnected to fail")
+	}
+	if got := rec.Body.String(); got != "" {
+		t.Errorf("body = %q, want empty", got)
+	}
+}
@@ -0,0 +1,61 @@
+package servemux
+
+import "sort"
+
+// ServeMuxStats is the statistics of the patterns registered with a
+// [ServeMux]. Internally registered patterns are not counted.
+type ServeMuxStats struct {
+	// TotalPatterns is the number of registered patterns.
+	TotalPatterns int
+
+	// PatternsByMethod is the number of registered patterns for each
+	// method. Patterns without a method are counted under "".
+	PatternsByMethod map[string]int
+
+	// HostPatterns is the number of registered patterns with a host.
+	HostPatterns int
+
+	// PathPatterns is the number of registered patterns without a host.
+	PathPatterns int
+
+	// MaxPathVarDepth is the largest number of variable path elements in
+	// a registered pattern.
+	MaxPathVarDepth int
+}
+
+// Stats returns the statistics of the patterns registered with the mux.
+func (mux *ServeMux) Stats() ServeMuxStats {
+	mux.mu.RLock()
+	defer mux.mu.RUnlock()
+
+	stats := ServeMuxStats{PatternsByMethod: map[string]int{}}
+	mux.walk(func(ht *handlerTuple) bool {
+		stats.TotalPatterns++
+		stats.PatternsByMethod[ht.method]++
+		if ht.host != "" {
+			stats.HostPatterns++
+		} else {
+			stats.PathPatterns++
+		}
+		if l := len(ht.pathVarNames); stats.MaxPathVarDepth < l {
+			stats.MaxPathVarDepth = l
+		}
+		return true
+	})
+	return stats
+}
+
+// AllRegisteredPatterns returns the patterns registered with the mux in
+// lexical order. Internally registered patterns are not included.
+func (mux *ServeMux) AllRegisteredPatterns() []string {
+	mux.mu.RLock()
+	defer mux.mu.RUnlock()
+
+	patterns := []string{}
+	mux.walk(func(ht *handlerTuple) bool {
+		patterns = append(patterns, ht.registeredPattern())
+		return true
+	})
+	sort.Strings(patterns)
+	return patterns
+}
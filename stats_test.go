@@ -0,0 +1,60 @@
+package servemux
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestServeMuxStats(t *testing.T) {
+	setParallel(t)
+
+	mux := NewServeMux()
+	mux.Handle("GET /users/{id}", stringHandler("user"))
+	mux.Handle("POST /users/{id}/posts/{post}", stringHandler("post"))
+	mux.Handle("/subtree/", stringHandler("subtree"))
+	mux.Handle("GET example.com/", stringHandler("example.com"))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users/1", nil))
+		}()
+	}
+	stats := mux.Stats()
+	wg.Wait()
+
+	want := ServeMuxStats{
+		TotalPatterns:    4,
+		PatternsByMethod: map[string]int{"": 1, "GET": 2, "POST": 1},
+		HostPatterns:     1,
+		PathPatterns:     3,
+		MaxPathVarDepth:  2,
+	}
+	if fmt.Sprint(stats) != fmt.Sprint(want) {
+		t.Errorf("Stats() = %+v, want %+v", stats, want)
+	}
+}
+
+func TestServeMuxAllRegisteredPatterns(t *testing.T) {
+	setParallel(t)
+
+	patterns := []string{"POST /b/{id}", "/a/", "example.com/", "GET /b/{id}", "*.example.org/c"}
+	want := fmt.Sprint([]string{"*.example.org/c", "/a/", "GET /b/{id}", "POST /b/{id}", "example.com/"})
+	for _, order := range [][]int{{0, 1, 2, 3, 4}, {4, 3, 2, 1, 0}} {
+		mux := NewServeMux()
+		if got := mux.AllRegisteredPatterns(); len(got) != 0 {
+			t.Errorf("AllRegisteredPatterns() = %q, want empty", got)
+		}
+		for _, i := range order {
+			mux.Handle(patterns[i], stringHandler(patterns[i]))
+		}
+		if got := fmt.Sprint(mux.AllRegisteredPatterns()); got != want {
+			t.Errorf("AllRegisteredPatterns() = %s, want %s", got, want)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package servemux
+
+import "context"
+
+// RouteEventType is the type of a [RouteEvent].
+type RouteEventType int
+
+// The route event types.
+const (
+	RouteRegistered RouteEventType = iota
+	RouteDeregistered
+)
+
+// String returns the name of the t.
+func (t RouteEventType) String() string {
+	switch t {
+	case RouteRegistered:
+		return "registered"
+	case RouteDeregistered:
+		return "deregistered"
+	}
+	return "unknown"
+}
+
+// RouteEvent is a change of the patterns registered with a [ServeMux], as
+// received from the [ServeMux.Watch].
+type RouteEvent struct {
+	Type    RouteEventType
+	Pattern string
+	Method  string
+	Host    string
+	Path    string
+}
+
+// Watch returns a channel that receives a [RouteEvent] whenever a pattern is
+// registered with or deregistered from the mux, including by the
+// [ServeMux.Reset] and the [ServeMux.SwapTree]. The channel has a buffer of
+// 64 events, and events are dropped rather than blocking the mux when it is
+// full. The channel is closed when the ctx is done. Each call returns a new
+// channel that receives all events independently.
+func (mux *ServeMux) Watch(ctx context.Context) <-chan RouteEvent {
+	ch := make(chan RouteEvent, 64)
+
+	mux.mu.Lock()
+	if mux.watchers == nil {
+		mux.watchers = map[chan RouteEvent]struct{}{}
+	}
+	mux.watchers[ch] = struct{}{}
+	mux.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		mux.mu.Lock()
+		delete(mux.watchers, ch)
+		mux.mu.Unlock()
+		close(ch)
+	}()
+
+	return ch
+}
+
+// notifyWatchers sends a [RouteEvent] of the typ for the pattern to all
+// watchers of the mux that are ready to receive it. The caller must hold the
+// mux.mu.
+func (mux *ServeMux) notifyWatchers(typ RouteEventType, pattern string) {
+	if len(mux.watchers) == 0 {
+		return
+	}
+	method, host, path := splitPattern(pattern)
+	re := RouteEvent{Type: typ, Pattern: pattern, Method: method, Host: host, Path: path}
+	for ch := range mux.watchers {
+		select {
+		case ch <- re:
+		default:
+		}
+	}
+}
+
+// notifyWatchersOfAll is like the [ServeMux.notifyWatchers], but for all
+// patterns registered with the mux. The caller must hold the mux.mu.
+func (mux *ServeMux) notifyWatchersOfAll(typ RouteEventType) {
+	if len(mux.watchers) == 0 {
+		return
+	}
+	mux.walk(func(ht *handlerTuple) bool {
+		mux.notifyWatchers(typ, ht.registeredPattern())
+		return true
+	})
+}
@@ -0,0 +1,44 @@
+package servemux
+
+import (
+	"context"
+	"testing"
+)
+
+func TestServeMuxWatch(t *testing.T) {
+	setParallel(t)
+
+	mux := NewServeMux()
+	ctx, cancel := context.WithCancel(context.Background())
+	ch1 := mux.Watch(ctx)
+	ch2 := mux.Watch(context.Background())
+
+	mux.Handle("GET example.com/users/{id}", stringHandler("user"))
+	if err := mux.Deregister("GET example.com/users/{id}"); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []RouteEvent{
+		{RouteRegistered, "GET example.com/users/{id}", "GET", "example.com", "/users/{id}"},
+		{RouteDeregistered, "GET example.com/users/{id}", "GET", "example.com", "/users/{id}"},
+	}
+	for _, ch := range []<-chan RouteEvent{ch1, ch2} {
+		for _, w := range want {
+			if got := <-ch; got != w {
+				t.Errorf("got %+v, want %+v", got, w)
+			}
+		}
+	}
+
+	cancel()
+	if _, ok := <-ch1; ok {
+		t.Error("expected the channel to be closed when the context is canceled")
+	}
+
+	for i := 0; i < 100; i++ {
+		mux.Handle("/"+string(rune('a'+i%26))+"/"+string(rune('a'+i/26)), stringHandler("x"))
+	}
+	if got := len(ch2); got != cap(ch2) {
+		t.Errorf("got %d buffered events, want %d", got, cap(ch2))
+	}
+}